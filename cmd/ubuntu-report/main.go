@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -32,6 +36,15 @@ func generateRootCmd() *cobra.Command {
 	var flagForce bool
 	var flagVerbosity int
 	var flagServerURL string
+	var flagSpool bool
+	var flagConfirmServer bool
+	var flagMaxBodyBytes int
+	var flagVersion bool
+	var flagAllowTest bool
+	var flagFormat string
+	var flagOutput string
+	var flagDiff bool
+	var flagIfChanged bool
 
 	var rootCmd = &cobra.Command{
 		Use:   "ubuntu-report",
@@ -51,7 +64,37 @@ func generateRootCmd() *cobra.Command {
 			}
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := sysmetrics.CollectAndSend(sysmetrics.ReportInteractive, flagForce, flagServerURL); err != nil {
+			if flagVersion {
+				if err := printVersion(flagFormat); err != nil {
+					log.Errorf(utils.ErrFormat, err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			if flagOutput != "-" {
+				if err := collectTo(flagOutput); err != nil {
+					log.Errorf(utils.ErrFormat, err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			var opts []sysmetrics.Option
+			if flagConfirmServer {
+				opts = append(opts, sysmetrics.WithServerConfirmation())
+			}
+			if flagMaxBodyBytes > 0 {
+				opts = append(opts, sysmetrics.WithMaxBodyBytes(flagMaxBodyBytes))
+			}
+			if flagAllowTest {
+				opts = append(opts, sysmetrics.WithTestReportsAllowed())
+			}
+			r := sysmetrics.ReportInteractive
+			if flagDiff {
+				r = sysmetrics.ReportInteractiveDiff
+			}
+			if err := sysmetrics.CollectAndSend(r, flagForce, flagServerURL, opts...); err != nil {
 				log.Errorf(utils.ErrFormat, err)
 				os.Exit(1)
 			}
@@ -61,20 +104,26 @@ func generateRootCmd() *cobra.Command {
 	rootCmd.PersistentFlags().BoolVarP(&flagForce, "force", "f", false, "collect and send new report even if already reported")
 
 	rootCmd.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	rootCmd.Flags().BoolVar(&flagConfirmServer, "confirm-server", false, "ask to confirm the destination host before sending to a non default server url")
+	rootCmd.Flags().BoolVar(&flagVersion, "version", false, "print version information and exit")
+	rootCmd.Flags().StringVar(&flagFormat, "format", "text", "output format of version information: text or json")
+	rootCmd.Flags().BoolVar(&flagAllowTest, "allow-test", false, "send the report even if it looks like test or placeholder data")
+	rootCmd.Flags().IntVar(&flagMaxBodyBytes, "max-body-bytes", 0, "refuse to send a report larger than this many bytes. 0 means no limit.")
+	rootCmd.Flags().BoolVar(&flagDiff, "diff", false, "only show what changed since the last report before asking to send it")
+	rootCmd.Flags().StringVarP(&flagOutput, "output", "o", "-", "write the collected report to this file instead of asking to send it. - keeps the interactive mode.")
 
 	show := &cobra.Command{
 		Use:   "show",
 		Short: "Only collect and display metrics without sending",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			data, err := sysmetrics.Collect()
-			if err != nil {
+			if err := collectTo(flagOutput); err != nil {
 				log.Errorf(utils.ErrFormat, err)
 				os.Exit(1)
 			}
-			fmt.Println(string(data))
 		},
 	}
+	show.Flags().StringVarP(&flagOutput, "output", "o", "-", "write the collected report to this file. - prints it on stdout.")
 	rootCmd.AddCommand(show)
 
 	send := &cobra.Command{
@@ -108,15 +157,119 @@ func generateRootCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
-			if err := sysmetrics.CollectAndSend(r, flagForce, flagServerURL); err != nil {
+			if flagSpool {
+				if r != sysmetrics.ReportAuto {
+					log.Error("Only reports with collected metrics can be spooled")
+					os.Exit(1)
+				}
+				r = sysmetrics.ReportSpool
+			}
+
+			var opts []sysmetrics.Option
+			if flagMaxBodyBytes > 0 {
+				opts = append(opts, sysmetrics.WithMaxBodyBytes(flagMaxBodyBytes))
+			}
+			if flagAllowTest {
+				opts = append(opts, sysmetrics.WithTestReportsAllowed())
+			}
+			if flagIfChanged {
+				opts = append(opts, sysmetrics.WithOnlyIfChanged())
+			}
+			err := sysmetrics.CollectAndSend(r, flagForce, flagServerURL, opts...)
+			if errors.Is(err, sysmetrics.ErrUnchanged) {
+				fmt.Println("Report unchanged since the last one, not sending it.")
+				return
+			}
+			if err != nil {
 				log.Errorf(utils.ErrFormat, err)
 				os.Exit(1)
 			}
 		},
 	}
 	send.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	send.Flags().BoolVar(&flagAllowTest, "allow-test", false, "send the report even if it looks like test or placeholder data")
+	send.Flags().IntVar(&flagMaxBodyBytes, "max-body-bytes", 0, "refuse to send a report larger than this many bytes. 0 means no limit.")
+	send.Flags().BoolVar(&flagIfChanged, "if-changed", false, "send the report again only if it changed since the last one sent for this version")
+	send.Flags().BoolVarP(&flagSpool, "spool", "s", false, "queue the report in the spool directory instead of sending it. Use flush-spool to upload it.")
 	rootCmd.AddCommand(send)
 
+	flushSpool := &cobra.Command{
+		Use:   "flush-spool",
+		Short: "Send every report previously queued in the spool directory",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := sysmetrics.FlushSpool(flagServerURL); err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+		},
+	}
+	flushSpool.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	rootCmd.AddCommand(flushSpool)
+
+	sendPending := &cobra.Command{
+		Use:   "send-pending",
+		Short: "Send the pending report which couldn't be sent previously",
+		Long: `Send the pending report which couldn't be sent previously, like when the network was unavailable.
+It backs off exponentially until the report is successfully sent.
+If a previous run gave up, it doesn't try again before its next attempt time.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := sysmetrics.SendPendingReport(flagServerURL)
+			if errors.Is(err, sysmetrics.ErrNoPendingReport) {
+				fmt.Println("No pending report to send.")
+				return
+			}
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			fmt.Println("Pending report sent.")
+		},
+	}
+	sendPending.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	rootCmd.AddCommand(sendPending)
+
+	selftest := &cobra.Command{
+		Use:   "selftest",
+		Short: "Check which metrics collectors are available on this machine, without sending anything",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			r, err := sysmetrics.SelfTest()
+			for _, c := range r {
+				name := c.Name
+				if c.Mandatory {
+					name += " (mandatory)"
+				}
+				fmt.Printf("%-28s %s\n", name, c.Status)
+			}
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+		},
+	}
+	rootCmd.AddCommand(selftest)
+
+	verify := &cobra.Command{
+		Use:   "verify FILE",
+		Short: "Check that a saved report is well-formed, as it would be before sending it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				log.Errorf(utils.ErrFormat, err)
+				os.Exit(1)
+			}
+			if err := sysmetrics.ValidateReport(data); err != nil {
+				log.Errorf("%s isn't a valid report: "+utils.ErrFormat, args[0], err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s is a valid report\n", args[0])
+		},
+	}
+	rootCmd.AddCommand(verify)
+
 	service := &cobra.Command{
 		Use:    "service",
 		Short:  "Try to send periodically previously unsent but collected data once network is available",
@@ -139,11 +292,57 @@ func generateRootCmd() *cobra.Command {
 		Run:   rootCmd.Run,
 	}
 	interactiveCmd.Flags().StringVarP(&flagServerURL, "url", "u", sender.BaseURL, "server url to send report to. Leave empty for default.")
+	interactiveCmd.Flags().BoolVar(&flagConfirmServer, "confirm-server", false, "ask to confirm the destination host before sending to a non default server url")
+	interactiveCmd.Flags().BoolVar(&flagAllowTest, "allow-test", false, "send the report even if it looks like test or placeholder data")
+	interactiveCmd.Flags().IntVar(&flagMaxBodyBytes, "max-body-bytes", 0, "refuse to send a report larger than this many bytes. 0 means no limit.")
+	interactiveCmd.Flags().BoolVar(&flagDiff, "diff", false, "only show what changed since the last report before asking to send it")
 	rootCmd.AddCommand(interactiveCmd)
 
 	return rootCmd
 }
 
+// printVersion prints build metadata in the given format
+func printVersion(format string) error {
+	switch format {
+	case "text":
+		fmt.Printf("ubuntu-report %s\n", utils.Version)
+	case "json":
+		d, err := json.Marshal(struct {
+			Version   string `json:"version"`
+			Commit    string `json:"commit"`
+			BuildDate string `json:"builddate"`
+		}{utils.Version, utils.Commit, utils.BuildDate})
+		if err != nil {
+			return fmt.Errorf("couldn't format version information: %v", err)
+		}
+		fmt.Println(string(d))
+	default:
+		return fmt.Errorf("unknown version format '%s', expected text or json", format)
+	}
+	return nil
+}
+
+// collectTo collects metrics and writes them to p, creating its parent directories.
+// "-" prints them on stdout.
+func collectTo(p string) error {
+	data, err := sysmetrics.Collect()
+	if err != nil {
+		return err
+	}
+	if p == "-" {
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("couldn't create parent directory of %s: %v", p, err)
+	}
+	if err := ioutil.WriteFile(p, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("couldn't write collected report to %s: %v", p, err)
+	}
+	return nil
+}
+
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -52,6 +53,133 @@ func TestShow(t *testing.T) {
 	}
 }
 
+func TestOutput(t *testing.T) {
+	helper.SkipIfShort(t)
+
+	testCases := []struct {
+		name    string
+		subcmd  string
+		outputP string
+	}{
+		{"show to stdout", "show", "-"},
+		{"show to file", "show", "report.json"},
+		{"show to file in new directory", "show", "some/sub/dir/report.json"},
+		{"root to file", "", "report.json"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			stdout, restoreStdout := helper.CaptureStdout(t)
+			defer restoreStdout()
+
+			p := tc.outputP
+			if p != "-" {
+				p = filepath.Join(out, p)
+			}
+			var args []string
+			if tc.subcmd != "" {
+				args = append(args, tc.subcmd)
+			}
+			cmd := generateRootCmd()
+			cmd.SetArgs(append(args, "--output", p))
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				err := cmd.Execute()
+				restoreStdout() // close stdout to release ReadAll()
+				return err
+			})
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("got an error when expecting none:", err)
+			}
+			gotStdout, err := ioutil.ReadAll(stdout)
+			if err != nil {
+				t.Error("couldn't read from stdout", err)
+			}
+
+			got := gotStdout
+			if p != "-" {
+				if len(gotStdout) != 0 {
+					t.Errorf("Expected nothing on stdout when writing to a file, got: %s", gotStdout)
+				}
+				if got, err = ioutil.ReadFile(p); err != nil {
+					t.Fatal("couldn't read output file", err)
+				}
+			}
+			if !strings.Contains(string(got), expectedReportItem) {
+				t.Errorf("Expected %s to be in output, but got: %s", expectedReportItem, string(got))
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+
+		wantJSON bool
+		wantErr  bool
+	}{
+		{"default format", "", false, false},
+		{"text format", "text", false, false},
+		{"json format", "json", true, false},
+		{"unknown format", "yaml", false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			a := helper.Asserter{T: t}
+
+			if tc.wantErr {
+				a.CheckWantedErr(printVersion(tc.format), true)
+				return
+			}
+
+			stdout, restoreStdout := helper.CaptureStdout(t)
+			defer restoreStdout()
+
+			cmd := generateRootCmd()
+			args := []string{"--version"}
+			if tc.format != "" {
+				args = append(args, "--format", tc.format)
+			}
+			cmd.SetArgs(args)
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				err := cmd.Execute()
+				restoreStdout() // close stdout to release ReadAll()
+				return err
+			})
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("got an error when expecting none:", err)
+			}
+			got, err := ioutil.ReadAll(stdout)
+			if err != nil {
+				t.Error("couldn't read from stdout", err)
+			}
+
+			if !tc.wantJSON {
+				a.Equal(string(got), "ubuntu-report dev\n")
+				return
+			}
+			var v map[string]string
+			if err := json.Unmarshal(got, &v); err != nil {
+				t.Fatalf("version output isn't valid json: %v (%s)", err, got)
+			}
+			for _, k := range []string{"version", "commit", "builddate"} {
+				if _, ok := v[k]; !ok {
+					t.Errorf("expected %q key in version output, got: %s", k, got)
+				}
+			}
+			a.Equal(v["version"], "dev")
+		})
+	}
+}
+
 // Test Verbosity level with Show
 func TestVerbosity(t *testing.T) {
 	helper.SkipIfShort(t)
@@ -102,7 +230,7 @@ func TestVerbosity(t *testing.T) {
 					l := scanner.Text()
 					if strings.Contains(l, "level=info") {
 						allowedLog := false
-						for _, msg := range []string{"/telemetry", "DCD", "GPU info", "Disk info", "Screen info", "CPU info", "autologin information", "/sys/class/dmi/id/", "hwcap"} {
+						for _, msg := range []string{"/telemetry", "DCD", "GPU info", "GPU driver info", "Disk info", "Screen info", "CPU info", "autologin information", "/sys/class/dmi/id/", "hwcap", "failed units", "EDID", "WWAN", "deployment tag", "render driver", "NPU", "root filesystem", "hostname", "encrypted volumes", "UX profile", "rotational information", "apt sources", "virtualization", "EFI boot entr", "Secure Boot", "desktop version", "battery information", "init system", "cgroup version", "firmware date", "snaps information", "high contrast", "screen reader", "large text", "bootloader", "keyboard layout", "cloud provider", "installed packages", "disk encryption", "default browser", "default terminal"} {
 							if strings.Contains(l, msg) {
 								allowedLog = true
 							}
@@ -110,7 +238,7 @@ func TestVerbosity(t *testing.T) {
 						if allowedLog {
 							continue
 						}
-						t.Errorf("Expected no log output with -v apart from missing telemetry, GPU, Disk, Screen, sys and autologin information, but got: %s", l)
+						t.Errorf("Expected no log output with -v apart from missing telemetry, GPU, Disk, Screen, sys, failed units and autologin information, but got: %s", l)
 					}
 				}
 			case "-vv":
@@ -406,6 +534,152 @@ func TestService(t *testing.T) {
 	}
 }
 
+func TestSendPending(t *testing.T) {
+	helper.SkipIfShort(t)
+
+	testCases := []struct {
+		name       string
+		hasPending bool
+
+		shouldHitServer bool
+	}{
+		{"regular send", true, true},
+		{"nothing pending", false, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			out = filepath.Join(out, "ubuntu-report")
+
+			pendingReportPath := filepath.Join(out, "pending")
+			var pendingReportData []byte
+			if tc.hasPending {
+				var err error
+				pendingReportData, err = ioutil.ReadFile(filepath.Join("testdata", "good", "ubuntu-report", "pending"))
+				if err != nil {
+					t.Fatalf("couldn't open pending report file: %v", err)
+				}
+				if err := os.MkdirAll(out, 0700); err != nil {
+					t.Fatal("couldn't create parent directory of pending report", err)
+				}
+				if err := ioutil.WriteFile(pendingReportPath, pendingReportData, 0644); err != nil {
+					t.Fatalf("couldn't copy pending report file to cache directory: %v", err)
+				}
+			}
+
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			cmd := generateRootCmd()
+			args := []string{"send-pending", "--url", ts.URL}
+			cmd.SetArgs(args)
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				var err error
+				_, err = cmd.ExecuteC()
+				return err
+			})
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("got an error when expecting none:", err)
+			}
+
+			a.Equal(serverHit, tc.shouldHitServer)
+
+			if _, err := os.Stat(pendingReportPath); !os.IsNotExist(err) {
+				t.Errorf("we expected no pending report to be left, got: %v", err)
+			}
+			if !tc.hasPending {
+				return
+			}
+
+			p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+			got, err := ioutil.ReadFile(p)
+			if err != nil {
+				t.Fatalf("couldn't open report file %s", out)
+			}
+			a.Equal(got, pendingReportData)
+		})
+	}
+}
+
+func TestFlushSpool(t *testing.T) {
+	helper.SkipIfShort(t)
+
+	testCases := []struct {
+		name string
+
+		shouldHitServer bool
+	}{
+		{"regular send", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+			out = filepath.Join(out, "ubuntu-report")
+
+			spoolDir := filepath.Join(out, "spool")
+			if err := os.MkdirAll(spoolDir, 0700); err != nil {
+				t.Fatal("couldn't create spool directory", err)
+			}
+			reportData := []byte(`{ "Version": "18.04" }`)
+			spooledReport := append([]byte(`{"Distro":"ubuntu","Version":"18.04"}`+"\n"), reportData...)
+			if err := ioutil.WriteFile(filepath.Join(spoolDir, "ubuntu.18.04.1"), spooledReport, 0644); err != nil {
+				t.Fatalf("couldn't create spooled report: %v", err)
+			}
+
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			cmd := generateRootCmd()
+			args := []string{"flush-spool", "--url", ts.URL}
+			cmd.SetArgs(args)
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				var err error
+				_, err = cmd.ExecuteC()
+				return err
+			})
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("got an error when expecting none:", err)
+			}
+
+			a.Equal(serverHit, tc.shouldHitServer)
+
+			files, err := ioutil.ReadDir(spoolDir)
+			if err != nil {
+				t.Fatalf("couldn't scan %s: %v", spoolDir, err)
+			}
+			if len(files) != 0 {
+				t.Errorf("we expected the spool directory to be emptied, but got: %v", files)
+			}
+
+			got, err := ioutil.ReadFile(filepath.Join(out, "ubuntu.18.04"))
+			if err != nil {
+				t.Fatalf("couldn't open report file: %v", err)
+			}
+			a.Equal(got, reportData)
+		})
+	}
+}
+
 // scanLinesOrQuestion is copy of ScanLines, adding the expected question string as we don't return here
 func scanLinesOrQuestion(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
@@ -434,3 +708,37 @@ func dropCR(data []byte) []byte {
 	}
 	return data
 }
+
+func TestVerify(t *testing.T) {
+	a := helper.Asserter{T: t}
+	stdout, restoreStdout := helper.CaptureStdout(t)
+	defer restoreStdout()
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	p := filepath.Join(out, "ubuntu.18.04")
+	if err := ioutil.WriteFile(p, []byte(`{"Version": "18.04", "Install": {"Type": "GTK"}}`), 0644); err != nil {
+		t.Fatalf("couldn't create report: %v", err)
+	}
+
+	cmd := generateRootCmd()
+	cmd.SetArgs([]string{"verify", p})
+
+	var c *cobra.Command
+	cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+		var err error
+		c, err = cmd.ExecuteC()
+		restoreStdout() // close stdout to release ReadAll()
+		return err
+	})
+
+	if err := <-cmdErrs; err != nil {
+		t.Fatal("got an error when expecting none:", err)
+	}
+	a.Equal(c.Name(), "verify")
+	got, err := ioutil.ReadAll(stdout)
+	if err != nil {
+		t.Error("couldn't read from stdout", err)
+	}
+	a.Equal(string(got), p+" is a valid report\n")
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -40,6 +41,50 @@ func TestMetricsHelperProcess(*testing.T) {
 	cmd, args := args[0], args[1:]
 	switch cmd {
 	case "lspci":
+		if args[0] == "-nk" {
+			driverOutput := `00:00.0 0600: 8086:0104 (rev 09)
+	Subsystem: 17aa:21cf
+	Kernel driver in use: snb_uncore
+00:02.0 0300: 8086:0126 (rev 09)
+	Subsystem: 17aa:21cf
+	Kernel driver in use: i915
+	Kernel modules: i915
+00:16.0 0780: 8086:1c3a (rev 04)
+	Subsystem: 17aa:21cf
+	Kernel driver in use: mei_me
+	Kernel modules: mei_me`
+			switch args[1] {
+			case "one gpu with driver":
+				fmt.Println(driverOutput)
+			case "one gpu without driver":
+				fmt.Println(`00:02.0 0300: 8086:0126 (rev 09)
+	Subsystem: 17aa:21cf
+	Kernel modules: i915
+00:16.0 0780: 8086:1c3a (rev 04)
+	Kernel driver in use: mei_me`)
+			case "intel nvidia gpus with driver":
+				fmt.Println(`00:02.0 0300: 8086:9bc4 (rev 05)
+	Kernel driver in use: i915
+01:00.0 0300: 10de:1f91 (rev a1)
+	Kernel driver in use: nvidia
+	Kernel modules: nouveau, nvidia_drm, nvidia`)
+			case "intel nvidia offload gpus with driver":
+				fmt.Println(`00:02.0 0300: 8086:9bc4 (rev 05)
+	Kernel driver in use: i915
+01:00.0 0302: 10de:1f91 (rev a1)
+	Kernel driver in use: nvidia
+	Kernel modules: nouveau, nvidia_drm, nvidia`)
+			case "another gpu":
+				fmt.Println(`03:00.0 0300: 1002:67df (rev c7)
+	Kernel driver in use: amdgpu`)
+			case "garbage":
+				fmt.Println(garbageOutput)
+			case "fail":
+				fmt.Println(driverOutput) // still print content
+				os.Exit(1)
+			}
+			return
+		}
 		if args[0] != "-n" {
 			fmt.Fprintf(os.Stderr, "Unexpected lspci arguments: %v\n", args)
 			os.Exit(1)
@@ -64,6 +109,30 @@ func TestMetricsHelperProcess(*testing.T) {
 00:19.0 0200: 8086:1502 (rev 04)`)
 		case "hexa numbers":
 			fmt.Println("00:02.0 0300: 8b86:a126 (rev 09)")
+		case "intel npu":
+			fmt.Println(regularOutput)
+			fmt.Println("00:0b.0 1200: 8086:7d1d (rev 04)")
+		case "amd npu":
+			fmt.Println(regularOutput)
+			fmt.Println("c4:00.1 1180: 1022:1502")
+		case "amd gpu":
+			fmt.Println("03:00.0 0300: 1002:67df (rev c7)")
+		case "hybrid gpus":
+			fmt.Println(`00:02.0 0300: 8086:3e9b
+01:00.0 0300: 1002:67df (rev c7)`)
+		case "intel nvidia gpus", "two gpus hybrid":
+			fmt.Println(`00:02.0 0300: 8086:9bc4 (rev 05)
+01:00.0 0300: 10de:1f91 (rev a1)`)
+		case "intel nvidia offload gpus":
+			fmt.Println(`00:02.0 0300: 8086:9bc4 (rev 05)
+00:14.0 0c03: 8086:a3af
+01:00.0 0302: 10de:1f91 (rev a1)`)
+		case "amd apu amd gpu":
+			fmt.Println(`03:00.0 0380: 1002:73ff (rev c3)
+05:00.0 0300: 1002:1638 (rev c5)`)
+		case "dual nvidia gpus":
+			fmt.Println(`17:00.0 0300: 10de:2204 (rev a1)
+65:00.0 0300: 10de:2204 (rev a1)`)
 		case "empty":
 		case "malformed gpu line":
 			fmt.Println("00:02.0 0300: 80860127 (rev 09)")
@@ -109,12 +178,23 @@ func TestMetricsHelperProcess(*testing.T) {
    ]
 }`
 		switch args[1] {
+		case "hang":
+			time.Sleep(10 * time.Second)
+		case "slow":
+			time.Sleep(2 * time.Second)
+			fmt.Println(regularOutput)
 		case "regular":
 			fmt.Println(regularOutput)
 		case "missing one expected field":
 			fmt.Println(strings.Replace(regularOutput, "Vendor ID:", "", -1))
 		case "missing one optional field":
 			fmt.Println(strings.Replace(regularOutput, "Virtualization vendor:", "", -1))
+		case "rounded max frequency":
+			fmt.Println(strings.Replace(regularOutput, `"4000.0000"`, `"4749.0000"`, 1))
+		case "low max frequency":
+			fmt.Println(strings.Replace(regularOutput, `"4000.0000"`, `"200.0000"`, 1))
+		case "invalid max frequency":
+			fmt.Println(strings.Replace(regularOutput, `"4000.0000"`, `"-"`, 1))
 		case "virtualized":
 			fmt.Println(regularOutput)
 			fmt.Println(`{"field": "Hypervisor vendor:", "data": "KVM"},
@@ -148,6 +228,39 @@ func TestMetricsHelperProcess(*testing.T) {
       {"field":"NUMA node0 CPU(s):","data":"0-7"},
       {"field":"Flags:","data":"fpu vme de pse tsc msr pae mce cx8 apic sep mtrr pge mca cmov pat pse36 clflush dts acpi mmx fxsr sse sse2 ss ht tm pbe syscall nx pdpe1gb rdtscp lm constant_tsc art arch_perfmon pebs bts rep_good nopl xtopology nonstop_tsc cpuid aperfmperf tsc_known_freq pni pclmulqdq dtes64 monitor ds_cpl vmx est tm2 ssse3 sdbg fma cx16 xtpr pdcm pcid sse4_1 sse4_2 x2apic movbe popcnt tsc_deadline_timer aes xsave avx f16c rdrand lahf_lm abm 3dnowprefetch cpuid_fault epb invpcid_single pti ibrs ibpb stibp tpr_shadow vnmi flexpriority ept vpid fsgsbase tsc_adjust bmi1 avx2 smep bmi2 erms invpcid mpx rdseed adx smap clflushopt intel_pt xsaveopt xsavec xgetbv1 xsaves dtherm ida arat pln pts hwp hwp_notify hwp_act_window hwp_epp"}
    ]
+}`)
+		case "many cores":
+			fmt.Println(`{
+   "lscpu": [
+      {"field": "Architecture:", "data": "x86_64"},
+      {"field": "CPU op-mode(s):", "data": "32-bit, 64-bit"},
+      {"field": "CPU(s):", "data": "128"},
+      {"field": "Thread(s) per core:", "data": "2"},
+      {"field": "Core(s) per socket:", "data": "32"},
+      {"field": "Socket(s):", "data": "2"},
+      {"field": "Vendor ID:", "data": "AuthenticAMD"},
+      {"field": "CPU family:", "data": "23"},
+      {"field": "Model:", "data": "49"},
+      {"field": "Model name:", "data": "AMD EPYC 7502 32-Core Processor"},
+      {"field": "Stepping:", "data": "0"},
+      {"field": "Virtualization:", "data": "AMD-V"},
+   ]
+}`)
+		case "arm":
+			fmt.Println(`{
+   "lscpu": [
+      {"field": "Architecture:", "data": "aarch64"},
+      {"field": "CPU op-mode(s):", "data": "32-bit, 64-bit"},
+      {"field": "CPU(s):", "data": "8"},
+      {"field": "Vendor ID:", "data": "ARM"},
+      {"field": "Model:", "data": "3"},
+      {"field": "Model name:", "data": "Cortex-A72"},
+      {"field": "Stepping:", "data": "r0p3"},
+      {"field": "Thread(s) per core:", "data": "1"},
+      {"field": "Core(s) per cluster:", "data": "4"},
+      {"field": "Socket(s):", "data": "-"},
+      {"field": "Cluster(s):", "data": "2"},
+   ]
 }`)
 		case "empty":
 		case "garbage":
@@ -174,6 +287,21 @@ DP-1 disconnected (normal left inverted right x axis y axis)`
    1920x1080     60.00*+
    1600x1200     60.00  
    1680x1050     59.95  `)
+		case "two screens":
+			fmt.Println(`Screen 0: minimum 320 x 200, current 4480 x 1440, maximum 16384 x 16384
+eDP-1 connected primary 1920x1080+0+360 (normal left inverted right x axis y axis) 344mm x 194mm
+   1920x1080    144.00*+  60.01    59.97
+   1680x1050     59.95    59.88
+HDMI-1 disconnected 2560x1440+1920+0 (normal left inverted right x axis y axis) 0mm x 0mm
+   2560x1440     59.95*
+DP-1 connected 2560x1440+1920+0 (normal left inverted right x axis y axis) 597mm x 336mm
+   2560x1440     59.95 +  74.97*
+   1920x1080     60.00    50.00
+DP-2 disconnected (normal left inverted right x axis y axis)`)
+		case "size missing on second screen":
+			fmt.Println(regularOutput)
+			fmt.Println(`VGA-1 connected 1920x1080+0+0 (normal left inverted right x axis y axis)
+   1920x1080     60.00*+`)
 		case "no screen":
 			fmt.Println("")
 		case "chosen resolution not first":
@@ -218,6 +346,41 @@ DP-1 disconnected (normal left inverted right x axis y axis)`
 		}
 
 	case "df":
+		if args[0] == "--output=source,fstype" {
+			regularFSTypeOutput := `Sys. de fichiers Type
+udev             devtmpfs
+tmpfs            tmpfs
+/dev/sda5        ext4
+tmpfs            tmpfs
+tmpfs            tmpfs`
+			switch args[1] {
+			case "ext4 root":
+				fmt.Println(regularFSTypeOutput)
+			case "btrfs root":
+				fmt.Println(strings.Replace(regularFSTypeOutput, " ext4\n", " btrfs\n", 1))
+			case "multiple partitions":
+				fmt.Println(regularFSTypeOutput)
+				fmt.Println(`/dev/sdc2        xfs`)
+			case "missing partition":
+				fmt.Println(`/dev/sdc2        xfs`)
+			case "filters loop devices":
+				fmt.Println(regularFSTypeOutput)
+				fmt.Println(`/dev/loop0       squashfs
+/dev/loop2       squashfs`)
+			case "nvme and mapper partitions":
+				fmt.Println(`/dev/nvme0n1p2   btrfs
+/dev/mapper/vgubuntu-home ext4`)
+			case "empty":
+			case "malformed":
+				fmt.Println(`/dev/sda5`)
+			case "garbage":
+				fmt.Println(garbageOutput)
+			case "fail":
+				fmt.Println(regularFSTypeOutput) // still print content
+				os.Exit(1)
+			}
+			break
+		}
 		regularOutput := `Sys. de fichiers blocs de 1K   Utilisé Disponible Uti% Monté sur
 udev                 3992524         0    3992524   0% /dev
 tmpfs                 804812      2104     802708   1% /run
@@ -236,6 +399,12 @@ tmpfs                   5120         4       5116   1% /run/lock`
 			fmt.Println(regularOutput)
 			fmt.Println(`/dev/loop0            132480    132480          0 100% /snap/gnome-3-26-1604/27
 /dev/loop2             83584     83584          0 100% /snap/core/4110`)
+		case "user mount":
+			fmt.Println(regularOutput)
+			fmt.Println(`/dev/sdc2          309681364 102492784    2816880   5% /home/alice/my data`)
+		case "nvme and mapper partitions":
+			fmt.Println(`/dev/nvme0n1p2     159431364 142492784    8816880  95% /
+/dev/mapper/vgubuntu-home 309681364 102492784 2816880 5% /home`)
 		case "empty":
 		case "malformed partition line string":
 			fmt.Println(`/dev/sda5          a159431364 142492784    8816880  95% /`)
@@ -457,5 +626,296 @@ Legacy HWCAP subdirectories under library search path directories:
 			fmt.Println(regularOutput)
 			os.Exit(1)
 		}
+
+	case "systemctl":
+		if args[0] != "--failed" || args[1] != "--no-legend" {
+			fmt.Fprintf(os.Stderr, "Unexpected systemctl arguments: %v\n", args)
+			os.Exit(1)
+		}
+		switch args[2] {
+		case "no failure", "empty":
+		case "several failures":
+			fmt.Println(`● bolt.service          loaded failed failed Thunderbolt system service
+● cups.service          loaded failed failed CUPS Scheduler
+● snapd.seeded.service  loaded failed failed Wait until snapd is fully seeded`)
+		case "fail":
+			fmt.Println("● cups.service          loaded failed failed CUPS Scheduler") // still print content
+			os.Exit(1)
+		}
+
+	case "mmcli":
+		if args[0] != "-L" {
+			fmt.Fprintf(os.Stderr, "Unexpected mmcli arguments: %v\n", args)
+			os.Exit(1)
+		}
+		regularOutput := `    /org/freedesktop/ModemManager1/Modem/0 [Sierra Wireless, Incorporated] EM7455`
+		switch args[1] {
+		case "one modem":
+			fmt.Println(regularOutput)
+		case "no modem":
+			fmt.Println("No modems were found")
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println(regularOutput) // still print content
+			os.Exit(1)
+		}
+
+	case "eglinfo":
+		if args[0] != "-B" {
+			fmt.Fprintf(os.Stderr, "Unexpected eglinfo arguments: %v\n", args)
+			os.Exit(1)
+		}
+		intelOutput := `GBM platform:
+EGL API version: 1.5
+EGL vendor string: Mesa Project
+EGL version string: 1.5
+EGL client APIs: OpenGL OpenGL_ES
+EGL driver name: iris
+OpenGL core profile vendor: Intel
+OpenGL core profile renderer: Mesa Intel(R) UHD Graphics 630 (CFL GT2)`
+		amdOutput := `GBM platform:
+EGL API version: 1.5
+EGL vendor string: Mesa Project
+EGL version string: 1.5
+EGL client APIs: OpenGL OpenGL_ES
+EGL driver name: radeonsi
+OpenGL core profile vendor: AMD
+OpenGL core profile renderer: AMD Radeon RX 580 Series (polaris10, LLVM 15.0.7, DRM 3.49, 6.2.0-26-generic)`
+		switch args[1] {
+		case "intel iris":
+			fmt.Println(intelOutput)
+		case "amd radeonsi":
+			fmt.Println(amdOutput)
+		case "hybrid":
+			fmt.Println(intelOutput)
+			fmt.Println("\nDevice platform:")
+			fmt.Println(amdOutput)
+		case "zink":
+			fmt.Println(strings.Replace(intelOutput, "EGL driver name: iris", "EGL driver name: zink", 1))
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println(intelOutput) // still print content
+			os.Exit(1)
+		}
+	case "uname":
+		if args[0] != "-r" {
+			fmt.Fprintf(os.Stderr, "Unexpected uname arguments: %v\n", args)
+			os.Exit(1)
+		}
+		switch args[1] {
+		case "regular":
+			fmt.Println("5.4.0-42-generic")
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println("5.4.0-42-generic") // still print content
+			os.Exit(1)
+		}
+	case "gnome-shell":
+		if args[0] != "--version" {
+			fmt.Fprintf(os.Stderr, "Unexpected gnome-shell arguments: %v\n", args)
+			os.Exit(1)
+		}
+		switch args[1] {
+		case "regular":
+			fmt.Println("GNOME Shell 46.0")
+		case "older":
+			fmt.Println("GNOME Shell 3.38.4")
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println("GNOME Shell 46.0") // still print content
+			os.Exit(1)
+		}
+	case "plasmashell":
+		if args[0] != "--version" {
+			fmt.Fprintf(os.Stderr, "Unexpected plasmashell arguments: %v\n", args)
+			os.Exit(1)
+		}
+		switch args[1] {
+		case "regular":
+			fmt.Println("plasmashell 5.27.11")
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println("plasmashell 5.27.11") // still print content
+			os.Exit(1)
+		}
+	case "xdg-settings":
+		if args[0] != "get" || args[1] != "default-web-browser" {
+			fmt.Fprintf(os.Stderr, "Unexpected xdg-settings arguments: %v\n", args)
+			os.Exit(1)
+		}
+		switch args[2] {
+		case "regular":
+			fmt.Println("firefox_firefox.desktop")
+		case "deb":
+			fmt.Println("google-chrome.desktop")
+		case "flatpak":
+			fmt.Println("org.chromium.Chromium.desktop")
+		case "user desktop file":
+			fmt.Println("/home/alice/.local/share/applications/my browser.desktop")
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println("firefox_firefox.desktop") // still print content
+			os.Exit(1)
+		}
+	case "update-alternatives":
+		if args[0] != "--query" || args[1] != "x-terminal-emulator" {
+			fmt.Fprintf(os.Stderr, "Unexpected update-alternatives arguments: %v\n", args)
+			os.Exit(1)
+		}
+		queryOutput := `Name: x-terminal-emulator
+Link: /usr/bin/x-terminal-emulator
+Slaves:
+ x-terminal-emulator.1.gz /usr/share/man/man1/x-terminal-emulator.1.gz
+Status: auto
+Best: /usr/bin/gnome-terminal.wrapper
+Value: %s
+
+Alternative: /usr/bin/gnome-terminal.wrapper
+Priority: 40
+Slaves:
+ x-terminal-emulator.1.gz /usr/share/man/man1/gnome-terminal.1.gz
+`
+		switch args[2] {
+		case "regular":
+			fmt.Printf(queryOutput, "/usr/bin/gnome-terminal.wrapper")
+		case "konsole":
+			fmt.Printf(queryOutput, "/usr/bin/konsole")
+		case "user binary":
+			fmt.Printf(queryOutput, "/home/alice/bin/My Terminal")
+		case "no value":
+			fmt.Println(`Name: x-terminal-emulator
+Link: /usr/bin/x-terminal-emulator
+Status: auto
+Best: none`)
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Printf(queryOutput, "/usr/bin/gnome-terminal.wrapper") // still print content
+			os.Exit(1)
+		}
+	case "efibootmgr":
+		if args[0] != "-v" {
+			fmt.Fprintf(os.Stderr, "Unexpected efibootmgr arguments: %v\n", args)
+			os.Exit(1)
+		}
+		switch args[1] {
+		case "regular":
+			fmt.Println(`BootCurrent: 0001
+Timeout: 0 seconds
+BootOrder: 0001,0002,0003
+Boot0001* ubuntu	HD(1,GPT,2c0c8e45-ae4b-4b6c-9a33-0d21e0c2bd7e,0x800,0x100000)/File(\EFI\ubuntu\shimx64.efi)
+Boot0002* UEFI: PXE IPv4 Intel(R) Ethernet Connection	PciRoot(0x0)/Pci(0x1f,0x6)/MAC(8c1645a1b2c3,0)/IPv4(0.0.0.00.0.0.0,0,0)..BO
+Boot0003* USB HDD	VenMedia(b6fef66d-1e11-4b2e-8b8f-b8f7a0d5e3b9)..BO`)
+		case "dual boot":
+			fmt.Println(`BootCurrent: 0001
+Timeout: 0 seconds
+BootOrder: 0001,0000,0002
+Boot0000* Windows Boot Manager	HD(1,GPT,2c0c8e45-ae4b-4b6c-9a33-0d21e0c2bd7e,0x800,0x100000)/File(\EFI\Microsoft\Boot\bootmgfw.efi)WINDOWS.........x...B.C.D.O.B.J.E.C.T.=.{.9.d.e.a.8.6.2.c.-.5.c.d.d.-.4.e.7.0.-.a.c.c.1.-.f.3.2.b.3.4.4.d.4.7.9.5.}...a................
+Boot0001* ubuntu	HD(1,GPT,2c0c8e45-ae4b-4b6c-9a33-0d21e0c2bd7e,0x800,0x100000)/File(\EFI\ubuntu\shimx64.efi)
+Boot0002* UEFI: PXE IPv4 Intel(R) Ethernet Connection	PciRoot(0x0)/Pci(0x1f,0x6)/MAC(8c1645a1b2c3,0)/IPv4(0.0.0.00.0.0.0,0,0)..BO`)
+		case "firmware only":
+			fmt.Println(`BootCurrent: 0002
+Timeout: 1 seconds
+BootOrder: 0002
+Boot0002* UEFI: PXE IPv4 Intel(R) Ethernet Connection	PciRoot(0x0)/Pci(0x1f,0x6)/MAC(8c1645a1b2c3,0)/IPv4(0.0.0.00.0.0.0,0,0)..BO`)
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println(`BootCurrent: 0001
+Boot0001* ubuntu	HD(1,GPT,2c0c8e45-ae4b-4b6c-9a33-0d21e0c2bd7e,0x800,0x100000)/File(\EFI\ubuntu\shimx64.efi)`) // still print content
+			os.Exit(1)
+		}
+	case "systemd-detect-virt":
+		switch args[0] {
+		case "regular":
+			fmt.Println("kvm")
+		case "container":
+			fmt.Println("lxc")
+		case "none":
+			fmt.Println("none")
+			os.Exit(1)
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println("kvm") // still print content
+			os.Exit(1)
+		}
+	case "gsettings":
+		if args[0] == "get" {
+			gsettingsGetMock(args[1:])
+			return
+		}
+		if args[0] != "list-recursively" || args[1] != "org.gnome.desktop.interface" {
+			fmt.Fprintf(os.Stderr, "Unexpected gsettings arguments: %v\n", args)
+			os.Exit(1)
+		}
+		switch args[2] {
+		case "regular":
+			fmt.Println(`org.gnome.desktop.interface clock-format '24h'
+org.gnome.desktop.interface color-scheme 'default'
+org.gnome.desktop.interface enable-animations true
+org.gnome.desktop.interface gtk-theme 'Yaru'
+org.gnome.desktop.interface scaling-factor uint32 0
+org.gnome.desktop.interface text-scaling-factor 1.0`)
+		case "dark scaled":
+			fmt.Println(`org.gnome.desktop.interface clock-format '24h'
+org.gnome.desktop.interface color-scheme 'prefer-dark'
+org.gnome.desktop.interface enable-animations false
+org.gnome.desktop.interface gtk-theme 'Yaru-dark'
+org.gnome.desktop.interface scaling-factor uint32 0
+org.gnome.desktop.interface text-scaling-factor 1.5`)
+		case "dark gtk theme only":
+			fmt.Println(`org.gnome.desktop.interface gtk-theme 'Adwaita-dark'`)
+		case "partial":
+			fmt.Println(`org.gnome.desktop.interface enable-animations garbage
+org.gnome.desktop.interface text-scaling-factor 1.25`)
+		case "empty":
+		case "garbage":
+			fmt.Println(garbageOutput)
+		case "fail":
+			fmt.Println(`org.gnome.desktop.interface color-scheme 'prefer-dark'`) // still print content
+			os.Exit(1)
+		}
+	}
+}
+
+// gsettingsGetMock prints the value of a single setting, depending on the requested case
+func gsettingsGetMock(args []string) {
+	enabled, disabled := "true", "false"
+	switch args[0] + " " + args[1] {
+	case "org.gnome.desktop.a11y.interface high-contrast", "org.gnome.desktop.a11y.applications screen-reader-enabled":
+	case "org.gnome.desktop.interface text-scaling-factor":
+		enabled, disabled = "1.25", "1.0"
+	default:
+		fmt.Fprintf(os.Stderr, "Unexpected gsettings get arguments: %v\n", args)
+		os.Exit(1)
+	}
+
+	switch args[2] {
+	case "enabled":
+		fmt.Println(enabled)
+	case "disabled":
+		fmt.Println(disabled)
+	case "empty":
+	case "garbage":
+		fmt.Println(garbageOutput)
+	case "fail":
+		fmt.Println(enabled) // still print content
+		os.Exit(1)
 	}
 }
@@ -1,49 +1,171 @@
 package metrics
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"io/ioutil"
+	"math"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 	"github.com/ubuntu/ubuntu-report/internal/utils"
 )
 
-func (m Metrics) getGPU() []gpuInfo {
-	var gpus []gpuInfo
+// getGPU returns the VGA compatible GPUs, in the order lspci lists them, and separately the render offload ones.
+// The latter have no display output, and are thus listed as 3D or display controllers, like the discrete GPU
+// of an AMD APU laptop. They are not part of the GPU list and are only used to detect hybrid graphics.
+func (m Metrics) getGPU() ([]GPUInfo, []GPUInfo) {
+	var gpus, offload []GPUInfo
 
-	r := runCmd(m.gpuInfoCmd)
+	r := m.runCmd(m.gpuInfoCmd)
 
-	results, err := filterAll(r, `^.* 0300: ([a-zA-Z0-9]+:[a-zA-Z0-9]+)( \(rev .*\))?$`)
-	if err != nil {
-		log.Infof("couldn't get GPU info: "+utils.ErrFormat, err)
+	for result := range filter(r, pciGPURe.String(), true) {
+		if result.err != nil {
+			m.infof("couldn't get GPU info: "+utils.ErrFormat, result.err)
+			return nil, nil
+		}
+		g := GPUInfo{Vendor: result.r[1], Model: result.r[2]}
+		if result.r[0] != pciVGAClass {
+			offload = append(offload, g)
+			continue
+		}
+		gpus = append(gpus, g)
+	}
+	if len(gpus) < 1 {
+		m.infof("couldn't get GPU info: "+utils.ErrFormat, errors.Errorf("couldn't find any VGA controller line matching %s", pciGPURe))
+		return nil, nil
+	}
+
+	return gpus, offload
+}
+
+// hasHybridGraphics returns true if gpus are from at least two different vendors, or if they are assisted by
+// offload GPUs.
+// nil is returned when there is no GPU.
+func hasHybridGraphics(gpus, offload []GPUInfo) *bool {
+	if len(gpus) == 0 {
 		return nil
 	}
+	hybrid := len(offload) > 0
+	for _, g := range gpus[1:] {
+		if g.Vendor != gpus[0].Vendor {
+			hybrid = true
+			break
+		}
+	}
+	return &hybrid
+}
+
+// pciVGAClass is the PCI class of VGA compatible controllers, the only ones listed as GPUs.
+// Render offload GPUs are listed as 3D (0302) or display (0380) controllers.
+const pciVGAClass = "0300"
 
-	for _, gpuinfo := range results {
-		i := strings.SplitN(gpuinfo, ":", 2)
-		if len(i) != 2 {
-			log.Infof("GPU info should of form vendor:model, got: %s", gpuinfo)
+var (
+	pciGPURe    = regexp.MustCompile(`^\S+ (030[02]|0380): ([a-zA-Z0-9]+):([a-zA-Z0-9]+)( \(rev .*\))?$`)
+	pciDeviceRe = regexp.MustCompile(`^\S+ [a-zA-Z0-9]+: `)
+	pciDriverRe = regexp.MustCompile(`^\s+Kernel driver in use: (\S+)$`)
+)
+
+// addGPUDrivers annotates gpus with the kernel driver bound to them.
+// GPUs are listed in the same order than in the PCI devices listing they were collected from.
+func (m Metrics) addGPUDrivers(gpus []GPUInfo) {
+	if m.gpuDriverCmd == nil || len(gpus) == 0 {
+		return
+	}
+
+	var drivers []GPUInfo
+	r := m.runCmd(m.gpuDriverCmd)
+	scanner := bufio.NewScanner(r)
+	current := -1
+	for scanner.Scan() {
+		l := scanner.Text()
+		if i := pciGPURe.FindStringSubmatch(l); i != nil && i[1] == pciVGAClass {
+			drivers = append(drivers, GPUInfo{Vendor: i[2], Model: i[3]})
+			current = len(drivers) - 1
 			continue
 		}
-		gpus = append(gpus, gpuInfo{Vendor: i[0], Model: i[1]})
+		if pciDeviceRe.MatchString(l) {
+			current = -1
+			continue
+		}
+		if i := pciDriverRe.FindStringSubmatch(l); i != nil && current >= 0 {
+			drivers[current].Driver = i[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		m.infof("couldn't get GPU driver info: "+utils.ErrFormat, err)
+		return
+	}
+	if len(drivers) != len(gpus) {
+		m.infof("couldn't get GPU driver info: found %d GPUs, expected %d", len(drivers), len(gpus))
+		return
 	}
 
-	return gpus
+	for i := range gpus {
+		if gpus[i].Vendor != drivers[i].Vendor || gpus[i].Model != drivers[i].Model {
+			m.infof("couldn't get GPU driver info: expected GPU %s:%s, got %s:%s", gpus[i].Vendor, gpus[i].Model, drivers[i].Vendor, drivers[i].Model)
+			return
+		}
+	}
+	for i := range gpus {
+		gpus[i].Driver = drivers[i].Driver
+	}
 }
 
-func (m Metrics) getCPU() cpuInfo {
-	c := cpuInfo{}
+// driversVendor maps Mesa DRI drivers to the PCI vendor ID of the hardware they drive.
+// Drivers not listed here (zink, llvmpipe…) are only attributed on single GPU systems.
+var driversVendor = map[string]string{
+	"i915":     "8086",
+	"i965":     "8086",
+	"crocus":   "8086",
+	"iris":     "8086",
+	"r300":     "1002",
+	"r600":     "1002",
+	"radeonsi": "1002",
+	"nouveau":  "10de",
+}
 
-	r := runCmd(m.cpuInfoCmd)
+// addRenderDrivers annotates gpus with the DRI driver used for rendering on them
+func (m Metrics) addRenderDrivers(gpus []GPUInfo) {
+	if m.renderInfoCmd == nil || len(gpus) == 0 {
+		return
+	}
+
+	r := m.runCmd(m.renderInfoCmd)
+
+	drivers, err := filterAll(r, `^EGL driver name: (.+)$`)
+	if err != nil {
+		m.infof("couldn't get GPU render driver info: "+utils.ErrFormat, err)
+		return
+	}
+
+	for _, d := range drivers {
+		vendor, known := driversVendor[d]
+		for i := range gpus {
+			if gpus[i].RenderDriver != "" {
+				continue
+			}
+			if (known && gpus[i].Vendor == vendor) || (!known && len(gpus) == 1) {
+				gpus[i].RenderDriver = d
+			}
+		}
+	}
+}
+
+func (m Metrics) getCPU() CPUInfo {
+	c := CPUInfo{}
+
+	r := m.runCmd(m.cpuInfoCmd)
 
 	for result := range filter(r, `{"field": *"(.*)", *"data": *"(.*)"},`, true) {
 		if result.err != nil {
-			log.Infof("Couldn't get CPU info: "+utils.ErrFormat, result.err)
-			return cpuInfo{}
+			m.infof("Couldn't get CPU info: "+utils.ErrFormat, result.err)
+			return CPUInfo{}
 		}
 
 		key, v := result.r[0], result.r[1]
@@ -55,10 +177,13 @@ func (m Metrics) getCPU() cpuInfo {
 			c.CPUs = v
 		case "Thread(s) per core:":
 			c.Threads = v
+			c.ThreadsPerCore = cpuCount(v)
 		case "Core(s) per socket:":
 			c.Cores = v
+			c.CoresPerSocket = cpuCount(v)
 		case "Socket(s):":
 			c.Sockets = v
+			c.SocketCount = cpuCount(v)
 		case "Vendor ID:":
 			c.Vendor = v
 		case "CPU family:":
@@ -75,87 +200,251 @@ func (m Metrics) getCPU() cpuInfo {
 			c.Hypervisor = v
 		case "Virtualization type:":
 			c.VirtualizationType = v
+		case "CPU max MHz:":
+			c.maxFreq = m.cpuFreqBucket(v)
 		}
 	}
 
 	return c
 }
 
-func (m Metrics) getScreens() []screenInfo {
-	var screens []screenInfo
+// cpuCount returns the positive count in v, or 0 if it isn't a number (like "-" on ARM)
+func cpuCount(v string) int {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// cpuFreqBucket returns the frequency in MHz v, rounded to the nearest 500 MHz to limit precision.
+// 0 is returned if v isn't a frequency.
+func (m Metrics) cpuFreqBucket(v string) int {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		m.infof("CPU max frequency should be a positive number, got: %s", v)
+		return 0
+	}
+	b := int(math.Round(f/500)) * 500
+	if b == 0 {
+		b = 500
+	}
+	return b
+}
+
+func (m Metrics) getScreens() []ScreenInfo {
+	var screens []ScreenInfo
 
-	r := runCmd(m.screenInfoCmd)
+	r := m.runCmd(m.screenInfoCmd)
 
 	var results []string
-	results, err := filterAll(r, `^(?: +(.*)\*|.* connected .* (\d+mm x \d+mm))`)
+	results, err := filterAll(r, `^(?: +(.*)\*|(\S+ (?:dis)?connected .*))`)
 	if err != nil {
-		log.Infof("couldn't get Screen info: "+utils.ErrFormat, err)
+		m.infof("couldn't get Screen info: "+utils.ErrFormat, err)
 		return nil
 	}
 
-	var lastSize string
+	var lastSize, lastVendor string
+	var disconnected bool
 	for _, screeninfo := range results {
-		if strings.Index(screeninfo, "mm") > -1 {
-			lastSize = strings.Replace(screeninfo, " ", "", -1)
+		// output header: only connected outputs with a physical size are reported
+		if f := strings.Fields(screeninfo); len(f) > 1 && (f[1] == "connected" || f[1] == "disconnected") {
+			lastSize, lastVendor = "", ""
+			disconnected = f[1] == "disconnected"
+			if !disconnected && screenSizeRe.MatchString(screeninfo) {
+				lastSize = strings.Join(f[len(f)-3:], "")
+				lastVendor = m.getScreenVendor(f[0])
+			}
+			continue
+		}
+		if disconnected {
+			// modes can still be listed for an output disconnected since the last configuration
 			continue
 		}
 		i := strings.Fields(screeninfo)
 		if len(i) < 2 {
-			log.Infof("screen info should be either a screen physical size (connected) or a a resolution + freq, got: %s", screeninfo)
+			m.infof("screen info should be either a screen physical size (connected) or a a resolution + freq, got: %s", screeninfo)
 			continue
 		}
 		if lastSize == "" {
-			log.Infof("We couldn't get physical info size prior to Resolution and Frequency information.")
+			m.infof("We couldn't get physical info size prior to Resolution and Frequency information.")
 			continue
 		}
-		screens = append(screens, screenInfo{Size: lastSize, Resolution: i[0], Frequency: i[len(i)-1]})
+		screens = append(screens, ScreenInfo{Size: lastSize, Resolution: i[0], Frequency: i[len(i)-1], Vendor: lastVendor})
 	}
 
 	return screens
 }
 
-func (m Metrics) getPartitions() []float64 {
+var screenSizeRe = regexp.MustCompile(` \d+mm x \d+mm$`)
+
+// partitionMountRe matches the mount point ending a df line, after the use percentage
+var partitionMountRe = regexp.MustCompile(`\d+%\s+(.+)$`)
+
+// getPartitions returns the size of each partition, if it's on a "hdd", "ssd" or "unknown" device,
+// its filesystem type and mount point. Filesystem types are nil if they can't be listed.
+// Mount points can hint at user names and are only reported if requested.
+func (m Metrics) getPartitions() ([]float64, []string, []string, []string) {
 	var sizes []float64
+	var types []string
+	var fsTypes []string
+	var mounts []string
 
-	r := runCmd(m.spaceInfoCmd)
+	r := m.runCmd(m.spaceInfoCmd)
 
-	results, err := filterAll(r, `^/dev/([^\s]+ +[^\s]*).*$`)
+	results, err := filterAll(r, `^/dev/([^\s]+ +[^\s]*.*)$`)
 	if err != nil {
-		log.Infof("couldn't get Disk info: "+utils.ErrFormat, err)
-		return nil
+		m.infof("couldn't get Disk info: "+utils.ErrFormat, err)
+		return nil, nil, nil, nil
 	}
+	devFSTypes := m.getFSTypes()
 
-	for _, size := range results {
+	for _, line := range results {
 		// negative lookahead isn't supported in go, so exclude loop devices manually
-		if strings.HasPrefix(size, "loop") {
+		if strings.HasPrefix(line, "loop") {
 			continue
 		}
-		s := strings.Fields(size)
-		if len(s) != 2 {
-			log.Infof("partition size should be of form 'block device      size', got: %s", size)
+		s := strings.Fields(line)
+		if len(s) < 2 {
+			m.infof("partition size should be of form 'block device      size', got: %s", line)
 			continue
 		}
 		v, err := convKBToGB(s[1])
 		if err != nil {
-			log.Infof("partition size should be an integer: "+utils.ErrFormat, err)
+			m.infof("partition size should be an integer: "+utils.ErrFormat, err)
 			continue
 		}
+		var mount string
+		if match := partitionMountRe.FindStringSubmatch(line); match != nil {
+			mount = match[1]
+		}
 		sizes = append(sizes, v)
+		types = append(types, m.getPartitionType(s[0]))
+		if devFSTypes != nil {
+			t, ok := devFSTypes[s[0]]
+			if !ok {
+				t = "unknown"
+			}
+			fsTypes = append(fsTypes, t)
+		}
+		mounts = append(mounts, mount)
+	}
+
+	return sizes, types, fsTypes, mounts
+}
+
+// getFSTypes returns the filesystem type of each block device, like "sda5": "ext4".
+// nil is returned if they can't be listed.
+func (m Metrics) getFSTypes() map[string]string {
+	if m.fsTypeCmd == nil {
+		return nil
+	}
+
+	r := m.runCmd(m.fsTypeCmd)
+
+	results, err := filterAll(r, `^/dev/([^\s]+ +[^\s]+) *$`)
+	if err != nil {
+		m.infof("couldn't get filesystem types: "+utils.ErrFormat, err)
+		return nil
 	}
 
-	return sizes
+	t := make(map[string]string)
+	for _, line := range results {
+		s := strings.Fields(line)
+		t[s[0]] = s[1]
+	}
+	return t
+}
+
+// partitionDeviceRe matches partitions of nvme and mmc devices, suffixed with pX, then other partitions
+var partitionDeviceRe = regexp.MustCompile(`^(?:((?:nvme\d+n|mmcblk)\d+)p\d+|([a-z]+)\d+)$`)
+
+// getPartitionType returns if the device of partition is rotational ("hdd") or not ("ssd").
+// "unknown" is returned if the flag can't be read, like for device mapper partitions.
+func (m Metrics) getPartitionType(partition string) string {
+	dev := partition
+	if match := partitionDeviceRe.FindStringSubmatch(partition); match != nil {
+		dev = match[1] + match[2]
+	}
+
+	v, err := getFromFileTrimmed(filepath.Join(m.root, "sys/block", dev, "queue/rotational"))
+	if err != nil {
+		m.infof("couldn't get rotational information of %s: "+utils.ErrFormat, partition, err)
+		return "unknown"
+	}
+	switch v {
+	case "0":
+		return "ssd"
+	case "1":
+		return "hdd"
+	}
+	m.infof("unexpected rotational information for %s: %s", partition, v)
+	return "unknown"
 }
 
 func (m Metrics) getArch() string {
-	b, err := m.archCmd.CombinedOutput()
+	cmd, cancel := m.commandWithTimeout(m.archCmd)
+	defer cancel()
+	b, err := cmd.CombinedOutput()
 	if err != nil {
-		log.Infof("couldn't get Architecture: "+utils.ErrFormat, err)
+		m.infof("couldn't get Architecture: "+utils.ErrFormat, err)
 		return ""
 	}
 
 	return strings.TrimSpace(string(b))
 }
 
+// getKernel returns the running kernel release, like 5.4.0-42-generic
+func (m Metrics) getKernel() string {
+	if m.kernelCmd == nil {
+		return ""
+	}
+
+	cmd, cancel := m.commandWithTimeout(m.kernelCmd)
+	defer cancel()
+	b, err := cmd.Output()
+	if err != nil {
+		m.infof("couldn't get kernel release: "+utils.ErrFormat, err)
+		return ""
+	}
+
+	v := strings.TrimSpace(string(b))
+	if strings.Contains(v, "\n") {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed kernel release, command returned: %s", v))
+		return ""
+	}
+	return v
+}
+
+// getVirtualization returns the virtualization or container environment, "none" on bare metal
+func (m Metrics) getVirtualization() string {
+	if m.virtCmd == nil {
+		return ""
+	}
+
+	cmd, cancel := m.commandWithTimeout(m.virtCmd)
+	defer cancel()
+	b, err := cmd.Output()
+	v := strings.TrimSpace(string(b))
+	if _, ok := err.(*exec.Error); ok {
+		m.infof("couldn't detect virtualization, considering bare metal: "+utils.ErrFormat, err)
+		return "none"
+	}
+	// systemd-detect-virt exits in error when no virtualization is detected
+	if v == "none" {
+		return v
+	}
+	if err != nil {
+		m.infof("couldn't detect virtualization: "+utils.ErrFormat, err)
+		return ""
+	}
+	if v == "" || strings.ContainsAny(v, " \n") {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed virtualization, command returned: %s", v))
+		return ""
+	}
+	return v
+}
+
 func (m Metrics) getHwCap() string {
 	if m.hwCapCmd == nil {
 		// if no data return empty string. This is caused by an
@@ -163,12 +452,12 @@ func (m Metrics) getHwCap() string {
 		return ""
 	}
 
-	rSupported := runCmd(m.hwCapCmd)
+	rSupported := m.runCmd(m.hwCapCmd)
 
 	// check if there is any hwcap output
 	bytesSupported, err := ioutil.ReadAll(rSupported)
 	if err != nil {
-		log.Infof("Couldn't get hwcap: "+utils.ErrFormat, err)
+		m.infof("Couldn't get hwcap: "+utils.ErrFormat, err)
 		return ""
 	}
 
@@ -193,18 +482,351 @@ func (m Metrics) getHwCap() string {
 	// now find which version is supported
 	resultSupported, err := filterFirst(newSupported, `^(?:(.*) +.*supported, searched.*)`, false)
 	if err != nil {
-		log.Infof("No supported hwcap: "+utils.ErrFormat, err)
+		m.infof("No supported hwcap: "+utils.ErrFormat, err)
 		return "-"
 	}
 
 	return resultSupported
 }
 
-func runCmd(cmd *exec.Cmd) io.Reader {
+func (m Metrics) getFailedUnitsCount() *int {
+	if m.failedUnitsCmd == nil {
+		return nil
+	}
+
+	r := m.runCmd(m.failedUnitsCmd)
+
+	// only count failed units, we don't want to report their names
+	var n int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		m.infof("couldn't get failed units: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	return &n
+}
+
+var (
+	bootEntryRe = regexp.MustCompile(`^Boot[0-9A-Fa-f]{4}\*?\s`)
+	// OS entries load a file from disk, firmware entries (network, removable devices, shell…) don't
+	osBootEntryRe = regexp.MustCompile(`\bHD\([^)]*\)/File\(`)
+)
+
+// getBootEntryCount returns the number of EFI boot entries loading an OS from disk.
+// Entries labels and paths aren't collected.
+func (m Metrics) getBootEntryCount() *int {
+	if m.bootEntriesCmd == nil {
+		return nil
+	}
+
+	r := m.runCmd(m.bootEntriesCmd)
+
+	var n int
+	var found bool
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		l := scanner.Text()
+		if !bootEntryRe.MatchString(l) {
+			continue
+		}
+		found = true
+		if osBootEntryRe.MatchString(l) {
+			n++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		m.infof("couldn't get EFI boot entries: "+utils.ErrFormat, err)
+		return nil
+	}
+	if !found {
+		m.infof("couldn't find any EFI boot entry")
+		return nil
+	}
+
+	return &n
+}
+
+// hasWWAN checks for a cellular modem in network interfaces, then in ModemManager.
+// No modem identifier is collected.
+func (m Metrics) hasWWAN() bool {
+	if ifaces, err := filepath.Glob(filepath.Join(m.root, "sys/class/net/wwan*")); err == nil && len(ifaces) > 0 {
+		return true
+	}
+
+	if m.wwanInfoCmd == nil {
+		return false
+	}
+
+	r := m.runCmd(m.wwanInfoCmd)
+
+	// no modem listed is the common case, and not an error
+	found := false
+	for result := range filter(r, `^\s*(/org/freedesktop/ModemManager1/Modem/\d+)`, false) {
+		if result.err != nil {
+			m.infof("couldn't get WWAN modem info: "+utils.ErrFormat, result.err)
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// getNPU returns if an AI accelerator is present and its PCI vendor ID.
+// Accelerators registered in the kernel accel subsystem are checked first, then the PCI devices.
+func (m Metrics) getNPU() (bool, string) {
+	if vendors, err := filepath.Glob(filepath.Join(m.root, "sys/class/accel/accel*/device/vendor")); err == nil && len(vendors) > 0 {
+		v, err := getFromFileTrimmed(vendors[0])
+		if err != nil {
+			m.infof("couldn't get NPU vendor: "+utils.ErrFormat, err)
+		}
+		return true, strings.TrimPrefix(v, "0x")
+	}
+
+	if m.npuInfoCmd == nil {
+		return false, ""
+	}
+
+	r := m.runCmd(m.npuInfoCmd)
+
+	// processing accelerators (1200) or AMD XDNA signal processing controllers (1180)
+	results, err := filterAll(r, `^.* (?:1200: ([a-zA-Z0-9]+):[a-zA-Z0-9]+|1180: (1022):(?:1502|17f0))( \(rev .*\))?$`)
+	if err != nil {
+		m.infof("couldn't get NPU info: "+utils.ErrFormat, err)
+		return false, ""
+	}
+	return true, results[0]
+}
+
+// getUXProfile returns desktop scaling, theme and animations settings.
+// Each setting is left empty if it can't be found.
+func (m Metrics) getUXProfile() *UXProfile {
+	if m.uxProfileCmd == nil {
+		return nil
+	}
+
+	r := m.runCmd(m.uxProfileCmd)
+
+	results, err := filterAll(r, `^org\.gnome\.desktop\.interface ((?:scaling-factor|text-scaling-factor|color-scheme|gtk-theme|enable-animations) .+)$`)
+	if err != nil {
+		m.infof("couldn't get UX profile: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	var p UXProfile
+	var colorScheme, gtkTheme string
+	for _, l := range results {
+		kv := strings.SplitN(l, " ", 2)
+		k := kv[0]
+		// strip GVariant type annotation and string quotes
+		v := strings.Trim(strings.TrimPrefix(kv[1], "uint32 "), "'")
+		switch k {
+		case "scaling-factor":
+			p.ScalingFactor = v
+		case "text-scaling-factor":
+			p.TextScalingFactor = v
+		case "color-scheme":
+			colorScheme = v
+		case "gtk-theme":
+			gtkTheme = v
+		case "enable-animations":
+			if b, err := strconv.ParseBool(v); err == nil {
+				p.Animations = &b
+			}
+		}
+	}
+
+	switch {
+	case colorScheme == "prefer-dark":
+		p.Theme = "dark"
+	case colorScheme == "prefer-light":
+		p.Theme = "light"
+	case strings.HasSuffix(strings.ToLower(gtkTheme), "-dark"):
+		p.Theme = "dark"
+	case gtkTheme != "":
+		p.Theme = "light"
+	}
+
+	if p == (UXProfile{}) {
+		return nil
+	}
+	return &p
+}
+
+// getAccessibility returns which accessibility features are enabled.
+// Each feature is left unset if its setting can't be read, and nil is returned if none can.
+func (m Metrics) getAccessibility() *Accessibility {
+	var a Accessibility
+	a.HighContrast = m.gsettingsBool(m.highContrastCmd, "high contrast")
+	a.ScreenReader = m.gsettingsBool(m.screenReaderCmd, "screen reader")
+
+	if m.largeTextCmd != nil {
+		if v, err := m.gsettingsValue(m.largeTextCmd); err != nil {
+			m.infof("couldn't get large text setting: "+utils.ErrFormat, err)
+		} else if f, err := strconv.ParseFloat(v, 64); err != nil {
+			m.infof(utils.ErrFormat, errors.Errorf("malformed large text setting, command returned: %s", v))
+		} else {
+			// large text is any text scaling factor above normal size
+			largeText := f > 1
+			a.LargeText = &largeText
+		}
+	}
+
+	if a == (Accessibility{}) {
+		return nil
+	}
+	return &a
+}
+
+// gsettingsBool returns the boolean value of a setting read by cmd, or nil if it can't be read
+func (m Metrics) gsettingsBool(cmd *exec.Cmd, desc string) *bool {
+	if cmd == nil {
+		return nil
+	}
+	v, err := m.gsettingsValue(cmd)
+	if err != nil {
+		m.infof("couldn't get %s setting: "+utils.ErrFormat, desc, err)
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed %s setting, command returned: %s", desc, v))
+		return nil
+	}
+	return &b
+}
+
+// gsettingsValue runs a gsettings get command and returns the setting value
+func (m Metrics) gsettingsValue(cmd *exec.Cmd) (string, error) {
+	cmd, cancel := m.commandWithTimeout(cmd)
+	defer cancel()
+	b, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "'%s' return an error", cmd.Args)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+var (
+	gnomeShellVersionRe  = regexp.MustCompile(`^GNOME Shell (\d+(?:\.\w+)*)$`)
+	plasmaShellVersionRe = regexp.MustCompile(`^plasmashell (\d+(?:\.\w+)*)$`)
+)
+
+// desktopShellCmd returns the command printing the version of the desktop the session is running,
+// and how to parse it. The command is nil for unknown desktops.
+func (m Metrics) desktopShellCmd() (*exec.Cmd, *regexp.Regexp) {
+	for _, de := range strings.Split(m.getenv("XDG_CURRENT_DESKTOP"), ":") {
+		switch strings.ToUpper(de) {
+		case "GNOME":
+			return m.gnomeShellCmd, gnomeShellVersionRe
+		case "KDE":
+			return m.plasmaShellCmd, plasmaShellVersionRe
+		}
+	}
+	return nil, nil
+}
+
+// getDesktopVersion returns the version of the GNOME Shell or KDE Plasma desktop the session is running, if any
+func (m Metrics) getDesktopVersion() string {
+	cmd, re := m.desktopShellCmd()
+	if cmd == nil {
+		return ""
+	}
+
+	cmd, cancel := m.commandWithTimeout(cmd)
+	defer cancel()
+	b, err := cmd.Output()
+	if err != nil {
+		m.infof("couldn't get desktop version: "+utils.ErrFormat, err)
+		return ""
+	}
+	v := re.FindStringSubmatch(strings.TrimSpace(string(b)))
+	if v == nil {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed desktop version, command returned: %s", b))
+		return ""
+	}
+	return v[1]
+}
+
+// appNameRe matches package like application names, never paths
+var appNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]*$`)
+
+// getDefaultBrowser returns the default web browser, as a package like name normalized from its desktop file,
+// like "firefox" for firefox_firefox.desktop or "chromium" for org.chromium.Chromium.desktop
+func (m Metrics) getDefaultBrowser() string {
+	if m.browserCmd == nil {
+		return ""
+	}
+
+	cmd, cancel := m.commandWithTimeout(m.browserCmd)
+	defer cancel()
+	b, err := cmd.Output()
+	if err != nil {
+		m.infof("couldn't get default browser: "+utils.ErrFormat, err)
+		return ""
+	}
+
+	v := strings.TrimSuffix(strings.TrimSpace(string(b)), ".desktop")
+	// snap desktop files are named <snap>_<app>
+	if i := strings.Index(v, "_"); i > 0 {
+		v = v[:i]
+	}
+	// flatpak desktop files are named after their reverse DNS application ID
+	if strings.Count(v, ".") >= 2 {
+		v = v[strings.LastIndex(v, ".")+1:]
+	}
+	v = strings.ToLower(v)
+	if !appNameRe.MatchString(v) {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed default browser, command returned: %s", b))
+		return ""
+	}
+	return v
+}
+
+// getDefaultTerminal returns the x-terminal-emulator alternative, as the name of its binary,
+// like "gnome-terminal" for /usr/bin/gnome-terminal.wrapper. Its path is never reported.
+func (m Metrics) getDefaultTerminal() string {
+	if m.terminalCmd == nil {
+		return ""
+	}
+
+	cmd, cancel := m.commandWithTimeout(m.terminalCmd)
+	defer cancel()
+	b, err := cmd.Output()
+	if err != nil {
+		m.infof("couldn't get default terminal: "+utils.ErrFormat, err)
+		return ""
+	}
+
+	p, err := filterFirst(bytes.NewReader(b), `^Value: (.+)$`, false)
+	if err != nil {
+		m.infof("couldn't get default terminal: "+utils.ErrFormat, err)
+		return ""
+	}
+
+	v := strings.TrimSuffix(filepath.Base(p), ".wrapper")
+	if !appNameRe.MatchString(v) {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed default terminal: %s", v))
+		return ""
+	}
+	return v
+}
+
+// runCmd runs cmd in the background, streaming its standard output through the returned reader.
+// The reader returns an error if the command fails or is killed after the command timeout.
+func (m Metrics) runCmd(cmd *exec.Cmd) io.Reader {
+	cmd, cancel := m.commandWithTimeout(cmd)
 	pr, pw := io.Pipe()
 	cmd.Stdout = pw
 
 	go func() {
+		defer cancel()
 		err := cmd.Run()
 		if err != nil {
 			pw.CloseWithError(errors.Wrapf(err, "'%s' return an error", cmd.Args))
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"os/exec"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/ubuntu/ubuntu-report/internal/helper"
@@ -16,6 +17,15 @@ func WithRootAt(p string) func(*Metrics) error {
 	}
 }
 
+// WithMemInfoFile tweaks the meminfo file, which is under the root directory by default
+func WithMemInfoFile(p string) func(*Metrics) error {
+	log.Debugf("Setting meminfo file to %s", p)
+	return func(m *Metrics) error {
+		m.memInfoFile = p
+		return nil
+	}
+}
+
 // WithCPUInfoCommand tweaks the default cpu info command
 func WithCPUInfoCommand(cmd *exec.Cmd) func(*Metrics) error {
 	log.Debugf("Setting cpu info command to '%s'", cmd.Args)
@@ -52,6 +62,15 @@ func WithSpaceInfoCommand(cmd *exec.Cmd) func(*Metrics) error {
 	}
 }
 
+// WithFSTypeCommand tweaks the default filesystem type command
+func WithFSTypeCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting filesystem type command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.fsTypeCmd = cmd
+		return nil
+	}
+}
+
 // WithArchitectureCommand tweaks the current given architecture
 func WithArchitectureCommand(cmd *exec.Cmd) func(*Metrics) error {
 	log.Debugf("Setting architecture command to '%s'", cmd.Args)
@@ -79,6 +98,160 @@ func WithHwCapCommand(cmd *exec.Cmd) func(*Metrics) error {
 	}
 }
 
+// WithFailedUnitsCommand tweaks the command listing failed systemd units
+func WithFailedUnitsCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting failed units command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.failedUnitsCmd = cmd
+		return nil
+	}
+}
+
+// WithWWANInfoCommand tweaks the command listing cellular modems
+func WithWWANInfoCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting wwan info command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.wwanInfoCmd = cmd
+		return nil
+	}
+}
+
+// WithGPUDriverCommand tweaks the command listing PCI devices with their kernel driver
+func WithGPUDriverCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting gpu driver command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.gpuDriverCmd = cmd
+		return nil
+	}
+}
+
+// WithRenderInfoCommand tweaks the command reporting the DRI driver in use
+func WithRenderInfoCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting render info command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.renderInfoCmd = cmd
+		return nil
+	}
+}
+
+// WithNPUInfoCommand tweaks the command listing PCI devices to find NPUs
+func WithNPUInfoCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting npu info command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.npuInfoCmd = cmd
+		return nil
+	}
+}
+
+// WithKernelCommand tweaks the command returning the running kernel release
+func WithKernelCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting kernel command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.kernelCmd = cmd
+		return nil
+	}
+}
+
+// WithGNOMEShellCommand tweaks the command returning the GNOME Shell version
+func WithGNOMEShellCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting GNOME Shell command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.gnomeShellCmd = cmd
+		return nil
+	}
+}
+
+// WithPlasmaShellCommand tweaks the command returning the KDE Plasma version
+func WithPlasmaShellCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting Plasma Shell command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.plasmaShellCmd = cmd
+		return nil
+	}
+}
+
+// WithBrowserCommand tweaks the command returning the default web browser
+func WithBrowserCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting default browser command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.browserCmd = cmd
+		return nil
+	}
+}
+
+// WithTerminalCommand tweaks the command returning the default terminal
+func WithTerminalCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting default terminal command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.terminalCmd = cmd
+		return nil
+	}
+}
+
+// WithHighContrastCommand tweaks the command returning the high contrast setting
+func WithHighContrastCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting high contrast command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.highContrastCmd = cmd
+		return nil
+	}
+}
+
+// WithScreenReaderCommand tweaks the command returning the screen reader setting
+func WithScreenReaderCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting screen reader command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.screenReaderCmd = cmd
+		return nil
+	}
+}
+
+// WithLargeTextCommand tweaks the command returning the text scaling setting
+func WithLargeTextCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting large text command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.largeTextCmd = cmd
+		return nil
+	}
+}
+
+// WithUXProfileCommand tweaks the command listing desktop interface settings
+func WithUXProfileCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting UX profile command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.uxProfileCmd = cmd
+		return nil
+	}
+}
+
+// WithVirtCommand tweaks the command detecting the virtualization or container environment
+func WithVirtCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting virtualization command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.virtCmd = cmd
+		return nil
+	}
+}
+
+// WithBootEntriesCommand tweaks the command listing EFI boot entries
+func WithBootEntriesCommand(cmd *exec.Cmd) func(*Metrics) error {
+	log.Debugf("Setting boot entries command to '%s'", cmd.Args)
+	return func(m *Metrics) error {
+		m.bootEntriesCmd = cmd
+		return nil
+	}
+}
+
+// WithCollectionTimeLimits tweaks the collection duration buckets limits
+func WithCollectionTimeLimits(fast, slow time.Duration) func(*Metrics) error {
+	log.Debugf("Setting collection time limits to %s and %s", fast, slow)
+	return func(m *Metrics) error {
+		m.fastCollection = fast
+		m.slowCollection = slow
+		return nil
+	}
+}
+
 // WithMapForEnv replace system getenv with given environ hashmap
 func WithMapForEnv(env map[string]string) func(*Metrics) error {
 	log.Debugf("Setting new environment to '%v'", env)
@@ -1,13 +1,18 @@
 package metrics
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
 	"math"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -15,45 +20,265 @@ import (
 )
 
 func (m Metrics) getVersion() string {
-	v, err := matchFromFile(filepath.Join(m.root, "etc/os-release"), `^VERSION_ID="(.*)"$`, false)
+	v, err := matchFromFile(filepath.Join(m.root, "etc/os-release"), osReleaseVersionIDRe, false)
 	if err != nil {
-		log.Infof("couldn't get version information from os-release: "+utils.ErrFormat, err)
+		m.infof("couldn't get version information from os-release: "+utils.ErrFormat, err)
 		return ""
 	}
-	return v
+	return unquoteOSRelease(v)
 }
 
 func (m Metrics) getRAM() *float64 {
-	s, err := matchFromFile(filepath.Join(m.root, "proc/meminfo"), `^MemTotal: +(\d+) kB$`, false)
+	s, err := matchFromFile(m.memInfoPath(), `^MemTotal: +(\d+) kB$`, false)
 	if err != nil {
-		log.Infof("couldn't get RAM information from meminfo: "+utils.ErrFormat, err)
+		m.infof("couldn't get RAM information from meminfo: "+utils.ErrFormat, err)
 		return nil
 	}
 	v, err := convKBToGB(s)
 	if err != nil {
-		log.Infof("partition size should be an integer: "+utils.ErrFormat, err)
+		m.infof("partition size should be an integer: "+utils.ErrFormat, err)
 		return nil
 	}
 	return &v
 }
 
+// getMem returns the total memory in GiB, rounded to the nearest GiB and to at least 1 GiB,
+// so that the exact amount can't be used to fingerprint a machine.
+// 0 is returned if it can't be read.
+func (m Metrics) getMem() int {
+	s, err := matchFromFile(m.memInfoPath(), `^MemTotal: +(\d+) kB$`, false)
+	if err != nil {
+		m.infof("couldn't get memory information from meminfo: "+utils.ErrFormat, err)
+		return 0
+	}
+	kb, err := strconv.Atoi(s)
+	if err != nil {
+		m.infof("memory size should be an integer: "+utils.ErrFormat, err)
+		return 0
+	}
+	return int(math.Max(1, math.Round(float64(kb)/(1024*1024))))
+}
+
+// memInfoPath is the meminfo file set by options, or the one under the root directory
+func (m Metrics) memInfoPath() string {
+	if m.memInfoFile != "" {
+		return m.memInfoFile
+	}
+	return filepath.Join(m.root, "proc/meminfo")
+}
+
+// getSwap returns the total size of active swap and if it's compressed.
+// nil is returned when there is no swap.
+func (m Metrics) getSwap() *SwapInfo {
+	b, err := getFromFile(filepath.Join(m.root, "proc/swaps"))
+	if err != nil {
+		m.infof("couldn't get swap information: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	var total int
+	var zram bool
+	// first line is the header
+	for _, l := range strings.Split(string(b), "\n")[1:] {
+		f := strings.Fields(l)
+		if len(f) < 3 {
+			continue
+		}
+		v, err := strconv.Atoi(f[2])
+		if err != nil {
+			m.infof("swap size should be an integer: "+utils.ErrFormat, err)
+			return nil
+		}
+		total += v
+		if strings.HasPrefix(f[0], "/dev/zram") {
+			if _, err := os.Stat(filepath.Join(m.root, "sys/block", filepath.Base(f[0]))); err == nil {
+				zram = true
+			}
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+
+	size, err := convKBToGB(strconv.Itoa(total))
+	if err != nil {
+		m.infof("swap size should be an integer: "+utils.ErrFormat, err)
+		return nil
+	}
+	zswap, _ := getFromFileTrimmed(filepath.Join(m.root, "sys/module/zswap/parameters/enabled"))
+	return &SwapInfo{Size: size, Compressed: zram || zswap == "Y"}
+}
+
+// arphrdEther is the link type of ethernet and wireless interfaces
+const arphrdEther = "1"
+
+// getNetwork counts network interfaces per kind. Loopback and other link types are ignored.
+// nil is returned if there is no such interface.
+func (m Metrics) getNetwork() *NetworkInfo {
+	netP := filepath.Join(m.root, "sys/class/net")
+	ifaces, err := ioutil.ReadDir(netP)
+	if err != nil {
+		m.infof("couldn't get network interfaces information: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	var n NetworkInfo
+	for _, i := range ifaces {
+		p := filepath.Join(netP, i.Name())
+		t, err := getFromFileTrimmed(filepath.Join(p, "type"))
+		if err != nil {
+			m.infof("couldn't get network interface type: "+utils.ErrFormat, err)
+			continue
+		}
+		if t != arphrdEther {
+			continue
+		}
+
+		switch {
+		case pathExists(filepath.Join(p, "wireless")) || pathExists(filepath.Join(p, "phy80211")):
+			n.Wireless++
+		case !pathExists(filepath.Join(p, "device")):
+			// bridges, containers and VPN interfaces have no backing hardware
+			n.Virtual++
+		default:
+			n.Wired++
+		}
+	}
+	if n == (NetworkInfo{}) {
+		return nil
+	}
+	return &n
+}
+
+// zoneInfoDir is the part of the /etc/localtime symlink target preceding the zone name
+const zoneInfoDir = "zoneinfo/"
+
+// getTimeZone returns the timezone region, like "Europe", without the city to limit precision.
+// /etc/timezone is preferred, then the /etc/localtime symlink target.
 func (m Metrics) getTimeZone() string {
 	v, err := getFromFileTrimmed(filepath.Join(m.root, "etc/timezone"))
 	if err != nil {
-		log.Infof("couldn't get timezone information: "+utils.ErrFormat, err)
+		m.infof("couldn't get timezone information from /etc/timezone: "+utils.ErrFormat, err)
+		if v, err = m.getLocaltimeZone(); err != nil {
+			m.infof("couldn't get timezone information: "+utils.ErrFormat, err)
+			return ""
+		}
+	}
+	if v == "" || strings.ContainsAny(v, "\n ") {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed timezone information: %s", v))
+		return ""
+	}
+	return strings.SplitN(v, "/", 2)[0]
+}
+
+// getLocaltimeZone returns the zone name, like "Europe/Paris", /etc/localtime links to
+func (m Metrics) getLocaltimeZone() (string, error) {
+	t, err := os.Readlink(filepath.Join(m.root, "etc/localtime"))
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndex(t, zoneInfoDir)
+	if i < 0 {
+		return "", errors.Errorf("/etc/localtime doesn't link to a zoneinfo file: %s", t)
+	}
+	return t[i+len(zoneInfoDir):], nil
+}
+
+// keyboardLayoutRe matches a single xkb layout code, like "us" or "latam"
+var keyboardLayoutRe = regexp.MustCompile(`^[a-z]+$`)
+
+// getKeyboardLayout returns the primary keyboard layout, like "fr", from the console and X keyboard configuration.
+// Additional layouts, variants and options are never reported.
+func (m Metrics) getKeyboardLayout() string {
+	v, err := matchFromFile(filepath.Join(m.root, "etc/default/keyboard"), `^XKBLAYOUT=(.*)$`, false)
+	if err != nil {
+		m.infof("couldn't get keyboard layout information: "+utils.ErrFormat, err)
+		return ""
+	}
+	v = strings.SplitN(strings.Trim(v, `"' `), ",", 2)[0]
+	if !keyboardLayoutRe.MatchString(v) {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed keyboard layout information: %s", v))
+		return ""
+	}
+	return v
+}
+
+// getUptimeBucket returns for how long the system is up, only as a coarse bucket
+func (m Metrics) getUptimeBucket() string {
+	s, err := matchFromFile(filepath.Join(m.root, "proc/uptime"), `^(\d+)(?:\.\d+)? `, false)
+	if err != nil {
+		m.infof("couldn't get uptime information: "+utils.ErrFormat, err)
+		return ""
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		m.infof("uptime should be an integer: "+utils.ErrFormat, err)
+		return ""
+	}
+
+	switch uptime := time.Duration(v) * time.Second; {
+	case uptime < time.Hour:
+		return "under-1h"
+	case uptime < 24*time.Hour:
+		return "under-1d"
+	case uptime < 7*24*time.Hour:
+		return "under-1w"
+	}
+	return "over-1w"
+}
+
+// getDeploymentTag returns the environment label set by the fleet operator, if any
+func (m Metrics) getDeploymentTag() string {
+	v, err := getFromFileTrimmed(filepath.Join(m.root, deploymentTagPath))
+	if err != nil {
+		m.infof("no deployment tag set: "+utils.ErrFormat, err)
 		return ""
 	}
 	if strings.Contains(v, "\n") {
-		log.Infof(utils.ErrFormat, errors.Errorf("malformed timezone information, file contains: %s", v))
+		m.infof(utils.ErrFormat, errors.Errorf("malformed deployment tag, file contains: %s", v))
+		return ""
+	}
+	if len(v) > maxDeploymentTagLength {
+		m.infof(utils.ErrFormat, errors.Errorf("deployment tag is longer than %d characters: %s", maxDeploymentTagLength, v))
 		return ""
 	}
 	return v
 }
 
+// defaultHostnameRe matches hostnames set by installers when the user didn't pick one
+var defaultHostnameRe = regexp.MustCompile(`^(ubuntu|localhost|.+-(desktop|laptop|virtual-machine))$`)
+
+// hasCustomHostname returns true if the hostname doesn't follow an installer generated pattern.
+// The hostname itself is never reported nor logged.
+func (m Metrics) hasCustomHostname() *bool {
+	h, err := getFromFileTrimmed(filepath.Join(m.root, "etc/hostname"))
+	if err != nil {
+		m.infof("couldn't get hostname: "+utils.ErrFormat, err)
+		return nil
+	}
+	if h == "" || strings.Contains(h, "\n") {
+		m.infof("hostname file is empty or malformed")
+		return nil
+	}
+
+	custom := !defaultHostnameRe.MatchString(h)
+	// installers generate <user>-<product name> hostnames
+	if p, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/product_name")); custom && err == nil && p != "" {
+		p = strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '-'
+		}, strings.ToLower(p))
+		custom = !strings.HasSuffix(strings.ToLower(h), "-"+p)
+	}
+	return &custom
+}
+
 func (m Metrics) getAutologin() bool {
 	v, err := matchFromFile(filepath.Join(m.root, "etc/gdm3/custom.conf"), `^AutomaticLoginEnable ?= ?(.*)$`, true)
 	if err != nil {
-		log.Infof("couldn't get autologin information from gdm: "+utils.ErrFormat, err)
+		m.infof("couldn't get autologin information from gdm: "+utils.ErrFormat, err)
 		return false
 	}
 	if strings.ToLower(v) != "true" {
@@ -62,58 +287,147 @@ func (m Metrics) getAutologin() bool {
 	return true
 }
 
-func (m Metrics) getOEM() (string, string, string, string) {
-	v, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/sys_vendor"))
+// dmiPlaceholders are values left by manufacturers which don't identify anything
+var dmiPlaceholders = []string{"to be filled by o.e.m.", "default string", "system manufacturer",
+	"system product name", "system version", "not specified", "not applicable", "none", "0123456789"}
+
+// dmiSerialRe matches values looking like serial numbers or UUIDs: long single words mixing letters and digits
+var dmiSerialRe = regexp.MustCompile(`^(?:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|(?:[A-Za-z]+[0-9]|[0-9]+[A-Za-z])[A-Za-z0-9]{10,})$`)
+
+// getDMI returns the DMI field name, described as desc in logs.
+// Placeholders and serial-like values are redacted as empty.
+func (m Metrics) getDMI(name, desc string) string {
+	v, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id", name))
 	if err != nil {
-		log.Infof("couldn't get sys vendor information: "+utils.ErrFormat, err)
+		m.infof("couldn't get %s information: "+utils.ErrFormat, desc, err)
+		return ""
 	}
 	if strings.Contains(v, "\n") {
-		log.Infof(utils.ErrFormat, errors.Errorf("malformed sys vendor information, file contains: %s", v))
-		v = ""
+		m.infof(utils.ErrFormat, errors.Errorf("malformed %s information, file contains: %s", desc, v))
+		return ""
 	}
-	p, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/product_name"))
-	if err != nil {
-		log.Infof("couldn't get sys product name information: "+utils.ErrFormat, err)
+	for _, p := range dmiPlaceholders {
+		if strings.ToLower(v) == p {
+			log.Debugf("ignoring %s placeholder: %s", desc, v)
+			return ""
+		}
 	}
-	if strings.Contains(p, "\n") {
-		log.Infof(utils.ErrFormat, errors.Errorf("malformed sys product name information, file contains: %s", p))
-		p = ""
+	if dmiSerialRe.MatchString(v) {
+		log.Debugf("redacting %s looking like a serial number", desc)
+		return ""
 	}
-	f, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/product_family"))
+	return v
+}
+
+func (m Metrics) getOEM() (string, string, string, string, string) {
+	v := m.getDMI("sys_vendor", "sys vendor")
+	p := m.getDMI("product_name", "sys product name")
+	f := m.getDMI("product_family", "sys product family")
+	ve := m.getDMI("product_version", "sys product version")
+	dcd, err := matchFromFile(filepath.Join(m.root, "var/lib/ubuntu_dist_channel"), `^([^\s#]+)$`, true)
 	if err != nil {
-		log.Infof("couldn't get sys product family information: "+utils.ErrFormat, err)
+		m.infof("no DCD information: "+utils.ErrFormat, err)
 	}
-	if strings.Contains(f, "\n") {
-		log.Infof(utils.ErrFormat, errors.Errorf("malformed sys product family information, file contains: %s", f))
-		f = ""
+	return v, p, f, ve, dcd
+}
+
+// biosDateRe matches the MM/DD/YYYY firmware release date format of DMI
+var biosDateRe = regexp.MustCompile(`^(\d{2})/(\d{2})/(\d{4})$`)
+
+// azureAssetTag is the chassis asset tag set by Azure, distinguishing it from local Hyper-V virtual machines
+const azureAssetTag = "7783-7084-3265-9085-8269-3286-77"
+
+// getCloud returns the cloud provider the machine is running on, "aws", "gce", "azure" or "none".
+// It's only guessed from DMI information: no metadata endpoint is ever queried.
+// Empty is returned if DMI information isn't available.
+func (m Metrics) getCloud() string {
+	dmi := func(name string) string {
+		v, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id", name))
+		if err != nil {
+			return ""
+		}
+		return strings.ToLower(v)
 	}
-	dcd, err := matchFromFile(filepath.Join(m.root, "var/lib/ubuntu_dist_channel"), `^([^\s#]+)$`, true)
-	if err != nil {
-		log.Infof("no DCD information: "+utils.ErrFormat, err)
+
+	vendor := dmi("sys_vendor")
+	if vendor == "" {
+		m.infof("couldn't get cloud provider information: no DMI sys vendor")
+		return ""
 	}
-	return v, p, f, dcd
+
+	switch {
+	case vendor == "amazon ec2", strings.Contains(dmi("bios_version"), "amazon"):
+		return "aws"
+	case vendor == "google", dmi("product_name") == "google compute engine":
+		return "gce"
+	case vendor == "microsoft corporation" && dmi("chassis_asset_tag") == azureAssetTag:
+		return "azure"
+	}
+	return "none"
 }
 
 func (m Metrics) getBIOS() (string, string) {
 	vd, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/bios_vendor"))
 	if err != nil {
-		log.Infof("couldn't get bios vendor information: "+utils.ErrFormat, err)
+		m.infof("couldn't get bios vendor information: "+utils.ErrFormat, err)
 		vd = ""
 	}
 	if strings.Contains(vd, "\n") {
-		log.Infof(utils.ErrFormat, errors.Errorf("malformed bios vendor information, file contains: %s", vd))
+		m.infof(utils.ErrFormat, errors.Errorf("malformed bios vendor information, file contains: %s", vd))
 		vd = ""
 	}
+	return vd, m.getBIOSVersion()
+}
+
+func (m Metrics) getBIOSVersion() string {
 	ve, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/bios_version"))
 	if err != nil {
-		log.Infof("couldn't get bios version: "+utils.ErrFormat, err)
-		ve = ""
+		m.infof("couldn't get bios version: "+utils.ErrFormat, err)
+		return ""
 	}
 	if strings.Contains(ve, "\n") {
-		log.Infof(utils.ErrFormat, errors.Errorf("malformed bios version information, file contains: %s", ve))
-		ve = ""
+		m.infof(utils.ErrFormat, errors.Errorf("malformed bios version information, file contains: %s", ve))
+		return ""
+	}
+	return ve
+}
+
+// getFirmware returns the firmware version and release date, as YYYY-MM-DD
+func (m Metrics) getFirmware() (string, string) {
+	var d string
+	if v, err := getFromFileTrimmed(filepath.Join(m.root, "sys/class/dmi/id/bios_date")); err != nil {
+		m.infof("couldn't get firmware date: "+utils.ErrFormat, err)
+	} else if r := biosDateRe.FindStringSubmatch(v); r != nil {
+		d = r[3] + "-" + r[1] + "-" + r[2]
+	} else if v != "" {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed firmware date information, file contains: %s", v))
+	}
+	return m.getBIOSVersion(), d
+}
+
+// oemConfigPaths are left on OEM factory installs by oem-config, which finishes the setup on first boot
+var oemConfigPaths = []string{
+	"var/lib/oem-config",
+	"usr/sbin/oem-config-firstboot",
+	"usr/lib/oem-config",
+}
+
+// isOEMInstall returns if the system was pre-installed in factory with oem-config.
+// nil is returned if the system state directory isn't available.
+func (m Metrics) isOEMInstall() *bool {
+	if p := filepath.Join(m.root, "var/lib"); !pathExists(p) {
+		m.infof(utils.ErrFormat, errors.Errorf("couldn't get OEM install information: %s doesn't exist", p))
+		return nil
+	}
+
+	oem := false
+	for _, p := range oemConfigPaths {
+		if pathExists(filepath.Join(m.root, p)) {
+			oem = true
+			break
+		}
 	}
-	return vd, ve
+	return &oem
 }
 
 func (m Metrics) getLivePatch() bool {
@@ -123,13 +437,80 @@ func (m Metrics) getLivePatch() bool {
 	return true
 }
 
+// getSnapCount returns the number of installed snaps, never their names nor revisions.
+// Snaps are counted from snapd downloaded files, or from their mount points if those aren't available.
+// nil is returned on systems without snapd.
+func (m Metrics) getSnapCount() *int {
+	names := make(map[string]bool)
+
+	if p := filepath.Join(m.root, "var/lib/snapd/snaps"); pathExists(p) {
+		paths, err := filepath.Glob(filepath.Join(p, "*.snap"))
+		if err != nil {
+			m.infof("couldn't get snaps information: "+utils.ErrFormat, err)
+			return nil
+		}
+		// files are named <snap>_<revision>.snap, with one file per kept revision
+		for _, p := range paths {
+			n := strings.TrimSuffix(filepath.Base(p), ".snap")
+			if i := strings.LastIndex(n, "_"); i > 0 {
+				n = n[:i]
+			}
+			names[n] = true
+		}
+		c := len(names)
+		return &c
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(m.root, "snap"))
+	if err != nil {
+		m.infof("couldn't get snaps information: "+utils.ErrFormat, err)
+		return nil
+	}
+	for _, e := range entries {
+		// bin contains the command wrappers of all snaps
+		if !e.IsDir() || e.Name() == "bin" {
+			continue
+		}
+		names[e.Name()] = true
+	}
+	c := len(names)
+	return &c
+}
+
+// getPackageCount returns the number of installed deb packages, never their names nor versions.
+// nil is returned on systems without dpkg.
+func (m Metrics) getPackageCount() *int {
+	p := filepath.Join(m.root, "var/lib/dpkg/status")
+	f, err := os.Open(p)
+	if err != nil {
+		m.infof("couldn't get installed packages information: "+utils.ErrFormat, errors.Wrapf(err, "couldn't open %s", p))
+		return nil
+	}
+	defer f.Close()
+
+	c := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// removed packages with remaining configuration files are listed too, and held packages are installed
+		l := scanner.Text()
+		if strings.HasPrefix(l, "Status: ") && strings.HasSuffix(l, " installed") {
+			c++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		m.infof("couldn't get installed packages information: "+utils.ErrFormat, errors.Wrapf(err, "couldn't read %s", p))
+		return nil
+	}
+	return &c
+}
+
 func (m Metrics) getDisks() []float64 {
 	var sizes []float64
 
 	blockFolder := filepath.Join(m.root, "sys/block")
 	dirs, err := ioutil.ReadDir(blockFolder)
 	if err != nil {
-		log.Infof("couldn't get disk block information: "+utils.ErrFormat, err)
+		m.infof("couldn't get disk block information: "+utils.ErrFormat, err)
 		return nil
 	}
 
@@ -140,23 +521,23 @@ func (m Metrics) getDisks() []float64 {
 
 		v, err := getFromFileTrimmed(filepath.Join(blockFolder, d.Name(), "size"))
 		if err != nil {
-			log.Infof("couldn't get disk block information for %s: "+utils.ErrFormat, d.Name(), err)
+			m.infof("couldn't get disk block information for %s: "+utils.ErrFormat, d.Name(), err)
 			continue
 		}
 		s, err := strconv.Atoi(v)
 		if err != nil {
-			log.Infof("number of block for disk %s isn't an integer: "+utils.ErrFormat, d.Name(), err)
+			m.infof("number of block for disk %s isn't an integer: "+utils.ErrFormat, d.Name(), err)
 			continue
 		}
 
 		v, err = getFromFileTrimmed(filepath.Join(blockFolder, d.Name(), "queue/logical_block_size"))
 		if err != nil {
-			log.Infof("couldn't get disk block information for %s: "+utils.ErrFormat, d.Name(), err)
+			m.infof("couldn't get disk block information for %s: "+utils.ErrFormat, d.Name(), err)
 			continue
 		}
 		bs, err := strconv.Atoi(v)
 		if err != nil {
-			log.Infof("block size for disk %s isn't an integer: "+utils.ErrFormat, d.Name(), err)
+			m.infof("block size for disk %s isn't an integer: "+utils.ErrFormat, d.Name(), err)
 			continue
 		}
 
@@ -170,12 +551,356 @@ func (m Metrics) getDisks() []float64 {
 	return sizes
 }
 
+// isImmutableRoot returns if the root filesystem is an overlay or backed by a loop device,
+// as on immutable images
+func (m Metrics) isImmutableRoot() *bool {
+	p := filepath.Join(m.root, "proc/mounts")
+	b, err := getFromFile(p)
+	if err != nil {
+		m.infof("couldn't get root filesystem information: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	var device, fsType string
+	for _, l := range strings.Split(string(b), "\n") {
+		f := strings.Fields(l)
+		// last mount on / is the one in use
+		if len(f) < 3 || f[1] != "/" {
+			continue
+		}
+		device, fsType = f[0], f[2]
+	}
+	if fsType == "" {
+		m.infof(utils.ErrFormat, errors.Errorf("no root filesystem found in %s", p))
+		return nil
+	}
+
+	immutable := fsType == "overlay" || strings.HasPrefix(device, "/dev/loop")
+	return &immutable
+}
+
+// hasTPMDiskUnlock returns if encrypted volumes are unlocked by the TPM rather than by a passphrase.
+// nil is returned on systems without any encrypted volume.
+func (m Metrics) hasTPMDiskUnlock() *bool {
+	p := filepath.Join(m.root, "etc/crypttab")
+	b, err := getFromFile(p)
+	if err != nil {
+		m.infof("couldn't get encrypted volumes information: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	var encrypted, tpm bool
+	for _, l := range strings.Split(string(b), "\n") {
+		f := strings.Fields(l)
+		if len(f) < 2 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		encrypted = true
+		// options are the optional fourth field
+		if len(f) < 4 {
+			continue
+		}
+		for _, o := range strings.Split(f[3], ",") {
+			if strings.HasPrefix(o, "tpm2-device=") {
+				tpm = true
+			}
+		}
+	}
+	if !encrypted {
+		return nil
+	}
+	return &tpm
+}
+
+// isEncrypted returns if any block device is a LUKS encrypted volume, from device mapper uuids,
+// or if a crypt device is set up in /dev/mapper. Volume names are never reported.
+// nil is returned if block devices aren't exposed.
+func (m Metrics) isEncrypted() *bool {
+	if _, err := os.Stat(filepath.Join(m.root, "sys/block")); err != nil {
+		m.infof("couldn't get disk encryption information: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	encrypted := false
+	paths, err := filepath.Glob(filepath.Join(m.root, "sys/block/*/dm/uuid"))
+	if err != nil {
+		m.infof("couldn't get disk encryption information: "+utils.ErrFormat, err)
+		return nil
+	}
+	for _, p := range paths {
+		// dm-crypt uuids are like CRYPT-LUKS2-<luks uuid>-<name>
+		if uuid, err := getFromFileTrimmed(p); err == nil && strings.HasPrefix(uuid, "CRYPT-LUKS") {
+			encrypted = true
+			break
+		}
+	}
+
+	if !encrypted {
+		entries, _ := ioutil.ReadDir(filepath.Join(m.root, "dev/mapper"))
+		for _, e := range entries {
+			// crypt devices are named <device>_crypt by the installer, or dm_crypt-<n> on LVM layouts
+			if strings.HasSuffix(e.Name(), "_crypt") || strings.HasPrefix(e.Name(), "dm_crypt-") {
+				encrypted = true
+				break
+			}
+		}
+	}
+	return &encrypted
+}
+
+// getBattery returns if the system has a battery, and the form factor guessed from it.
+// Charge levels and serials are never read. Nothing is returned if power supplies aren't exposed.
+func (m Metrics) getBattery() (*bool, string) {
+	p := filepath.Join(m.root, "sys/class/power_supply")
+	if _, err := os.Stat(p); err != nil {
+		m.infof("couldn't get battery information: "+utils.ErrFormat, err)
+		return nil, ""
+	}
+
+	paths, err := filepath.Glob(filepath.Join(p, "BAT*"))
+	if err != nil {
+		m.infof("couldn't get battery information: "+utils.ErrFormat, err)
+		return nil, ""
+	}
+	hasBattery := len(paths) > 0
+	if hasBattery {
+		return &hasBattery, "laptop"
+	}
+	return &hasBattery, "desktop"
+}
+
+// initSystems maps PID 1 command names to the init system they belong to
+var initSystems = map[string]string{
+	"systemd":     "systemd",
+	"upstart":     "upstart",
+	"init":        "init",
+	"openrc-init": "openrc",
+	"openrc":      "openrc",
+	"runit":       "runit",
+	"s6-svscan":   "s6",
+}
+
+// getInit returns the init system running as PID 1.
+// Unknown commands, like applications running as PID 1 in containers, are reported as "other".
+func (m Metrics) getInit() string {
+	v, err := getFromFileTrimmed(filepath.Join(m.root, "proc/1/comm"))
+	if err != nil {
+		m.infof("couldn't get init system: "+utils.ErrFormat, err)
+		return ""
+	}
+	if v == "" || strings.Contains(v, "\n") {
+		m.infof(utils.ErrFormat, errors.Errorf("malformed init system information, file contains: %s", v))
+		return ""
+	}
+	if name, ok := initSystems[v]; ok {
+		return name
+	}
+	return "other"
+}
+
+// getCgroupVersion returns 2 on unified cgroup hierarchies, 1 otherwise.
+// 0 is returned if cgroups aren't mounted.
+func (m Metrics) getCgroupVersion() int {
+	p := filepath.Join(m.root, "sys/fs/cgroup")
+	if _, err := os.Stat(p); err != nil {
+		m.infof("couldn't get cgroup version: "+utils.ErrFormat, err)
+		return 0
+	}
+	if pathExists(filepath.Join(p, "cgroup.controllers")) {
+		return 2
+	}
+	return 1
+}
+
+// getCPUVulnerabilities returns the coarse mitigation status of each CPU vulnerability known by the kernel,
+// and if a microcode was loaded. Mitigation details and microcode revisions are never reported.
+func (m Metrics) getCPUVulnerabilities() (map[string]string, *bool) {
+	p := filepath.Join(m.root, "sys/devices/system/cpu")
+	if _, err := os.Stat(p); err != nil {
+		m.infof("couldn't get CPU vulnerabilities: "+utils.ErrFormat, err)
+		return nil, nil
+	}
+	microcode := pathExists(filepath.Join(p, "cpu0/microcode/version"))
+
+	paths, err := filepath.Glob(filepath.Join(p, "vulnerabilities", "*"))
+	if err != nil {
+		m.infof("couldn't get CPU vulnerabilities: "+utils.ErrFormat, err)
+		return nil, &microcode
+	}
+	var vulns map[string]string
+	for _, vp := range paths {
+		v, err := getFromFileTrimmed(vp)
+		if err != nil {
+			m.infof("couldn't get CPU vulnerability status: "+utils.ErrFormat, err)
+			continue
+		}
+		if vulns == nil {
+			vulns = make(map[string]string)
+		}
+		vulns[filepath.Base(vp)] = vulnerabilityStatus(v)
+	}
+	return vulns, &microcode
+}
+
+// vulnerabilityStatus reduces the kernel status of a CPU vulnerability to
+// "Not affected", "Mitigation", "Vulnerable" or "Unknown".
+func vulnerabilityStatus(v string) string {
+	switch {
+	case strings.HasPrefix(v, "Not affected"):
+		return "Not affected"
+	// some status are prefixed, like "KVM: Mitigation: VMX disabled"
+	case strings.Contains(v, "Mitigation"):
+		return "Mitigation"
+	case strings.Contains(strings.ToLower(v), "vulnerable"):
+		return "Vulnerable"
+	}
+	return "Unknown"
+}
+
+// isSecureBoot returns if the EFI firmware enforces Secure Boot.
+// nil is returned on legacy BIOS systems.
+func (m Metrics) isSecureBoot() *bool {
+	efiP := filepath.Join(m.root, "sys/firmware/efi")
+	if _, err := os.Stat(efiP); err != nil {
+		m.infof("couldn't get Secure Boot status, not an EFI system: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	enabled := false
+	paths, err := filepath.Glob(filepath.Join(efiP, "efivars", "SecureBoot-*"))
+	if err != nil || len(paths) == 0 {
+		// firmware without Secure Boot support
+		return &enabled
+	}
+	b, err := ioutil.ReadFile(paths[0])
+	if err != nil {
+		m.infof("couldn't get Secure Boot status: "+utils.ErrFormat, err)
+		return nil
+	}
+	// EFI variables start with 4 bytes of attributes, followed by their value
+	if len(b) != 5 {
+		m.infof(utils.ErrFormat, errors.Errorf("Secure Boot variable %s has an unexpected size: %d", paths[0], len(b)))
+		return nil
+	}
+	enabled = b[4] == 1
+	return &enabled
+}
+
+// bootloaders are checked in order, as GRUB files can be left behind after switching to another bootloader
+var bootloaders = []struct {
+	name  string
+	paths []string
+}{
+	{"systemd-boot", []string{"boot/efi/EFI/systemd", "efi/EFI/systemd", "boot/EFI/systemd"}},
+	{"refind", []string{"boot/efi/EFI/refind", "efi/EFI/refind", "boot/EFI/refind"}},
+	{"grub", []string{"boot/grub", "boot/grub2"}},
+}
+
+// getBootloader returns the bootloader in use, "grub", "systemd-boot" or "refind",
+// from the files it installed on the system. Empty is returned if it can't be determined.
+func (m Metrics) getBootloader() string {
+	for _, b := range bootloaders {
+		for _, p := range b.paths {
+			if pathExists(filepath.Join(m.root, p)) {
+				return b.name
+			}
+		}
+	}
+	m.infof("couldn't determine the bootloader in use")
+	return ""
+}
+
+// Coarse classification of apt sources. URLs are never reported.
+const (
+	aptSourceDefault       = "default"
+	aptSourceCountryMirror = "country-mirror"
+	aptSourceMirror        = "mirror"
+	aptSourceProxy         = "proxy"
+)
+
+var (
+	// aptProxyRe matches both Acquire::http::Proxy "…"; and Acquire::http { Proxy "…"; } forms
+	aptProxyRe = regexp.MustCompile(`(?i)Acquire\s*::\s*http\s*(?:::\s*|\{\s*)Proxy\s+"([^"]*)"`)
+	// aptURIRe matches one line style and deb822 style sources
+	aptURIRe            = regexp.MustCompile(`(?m)^\s*(?:deb(?:-src)?\s+(?:\[[^\]]*\]\s+)?|URIs:\s*)([a-z+]+://[^\s]+)`)
+	ubuntuDefaultHostRe = regexp.MustCompile(`^(archive|security|ports)\.ubuntu\.com$`)
+	ubuntuCountryHostRe = regexp.MustCompile(`^[a-z]{2}\.(archive|ports)\.ubuntu\.com$`)
+)
+
+// getAptSource returns if apt is set to go through a local proxy, or to use the default archive,
+// a country mirror or another mirror of the Ubuntu archive.
+func (m Metrics) getAptSource() string {
+	confs, _ := filepath.Glob(filepath.Join(m.root, "etc/apt/apt.conf.d/*"))
+	for _, p := range append([]string{filepath.Join(m.root, "etc/apt/apt.conf")}, confs...) {
+		b, err := getFromFile(p)
+		if err != nil {
+			continue
+		}
+		for _, l := range strings.Split(string(b), "\n") {
+			l = strings.TrimSpace(l)
+			if strings.HasPrefix(l, "//") || strings.HasPrefix(l, "#") {
+				continue
+			}
+			match := aptProxyRe.FindStringSubmatch(l)
+			if match == nil {
+				continue
+			}
+			// explicitly disabled proxies
+			if v := strings.ToLower(match[1]); v != "" && v != "direct" && v != "false" {
+				return aptSourceProxy
+			}
+		}
+	}
+
+	sources, _ := filepath.Glob(filepath.Join(m.root, "etc/apt/sources.list.d/*.list"))
+	deb822, _ := filepath.Glob(filepath.Join(m.root, "etc/apt/sources.list.d/*.sources"))
+	sources = append(append([]string{filepath.Join(m.root, "etc/apt/sources.list")}, sources...), deb822...)
+
+	var r string
+	rank := map[string]int{"": 0, aptSourceDefault: 1, aptSourceCountryMirror: 2, aptSourceMirror: 3}
+	for _, p := range sources {
+		b, err := getFromFile(p)
+		if err != nil {
+			continue
+		}
+		for _, match := range aptURIRe.FindAllStringSubmatch(string(b), -1) {
+			u, err := url.Parse(match[1])
+			if err != nil {
+				m.infof("couldn't parse apt source: "+utils.ErrFormat, err)
+				continue
+			}
+			var c string
+			switch h := u.Hostname(); {
+			case ubuntuDefaultHostRe.MatchString(h):
+				c = aptSourceDefault
+			case ubuntuCountryHostRe.MatchString(h):
+				c = aptSourceCountryMirror
+			// apt-cacher-ng is usually referenced directly in sources, on its default port
+			case u.Port() == "3142":
+				return aptSourceProxy
+			// only consider mirrors of the Ubuntu archive, not third party repositories
+			case strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/ubuntu"),
+				strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/ubuntu-ports"):
+				c = aptSourceMirror
+			}
+			if rank[c] > rank[r] {
+				r = c
+			}
+		}
+	}
+
+	if r == "" {
+		m.infof("couldn't find any Ubuntu archive in apt sources")
+	}
+	return r
+}
+
 func (m Metrics) installerInfo() json.RawMessage {
-	return getAndValidateJSONFromFile(filepath.Join(m.root, installerLogsPath), "install")
+	return m.getAndValidateJSONFromFile(filepath.Join(m.root, installerLogsPath), "install")
 }
 
 func (m Metrics) upgradeInfo() json.RawMessage {
-	return getAndValidateJSONFromFile(filepath.Join(m.root, upgradeLogsPath), "upgrade")
+	return m.getAndValidateJSONFromFile(filepath.Join(m.root, upgradeLogsPath), "upgrade")
 }
 
 func matchFromFile(p, regex string, notFoundOk bool) (string, error) {
@@ -211,15 +936,120 @@ func getFromFileTrimmed(p string) (string, error) {
 	return strings.TrimSpace(string(b)), nil
 }
 
-func getAndValidateJSONFromFile(p string, errmsg string) json.RawMessage {
+func (m Metrics) getAndValidateJSONFromFile(p string, errmsg string) json.RawMessage {
 	b, err := getFromFile(p)
 	if err != nil {
-		log.Infof("no %s data found: "+utils.ErrFormat, errmsg, err)
+		m.infof("no %s data found: "+utils.ErrFormat, errmsg, err)
 		return nil
 	}
 	if !json.Valid(b) {
-		log.Infof("%s data found, but not valid json.", errmsg)
+		m.infof("%s data found, but not valid json.", errmsg)
 		return nil
 	}
 	return json.RawMessage(b)
 }
+
+// getScreenVendor returns the PNP manufacturer ID from the EDID of the given connector.
+// Only the vendor is extracted: serial number and product name are never read.
+func (m Metrics) getScreenVendor(connector string) string {
+	p := filepath.Join(m.root, "sys/class/drm", "card*-"+connector, "edid")
+	edids, err := filepath.Glob(p)
+	if err != nil || len(edids) < 1 {
+		m.infof("couldn't find EDID for screen %s", connector)
+		return ""
+	}
+
+	b, err := ioutil.ReadFile(edids[0])
+	if err != nil {
+		m.infof("couldn't read EDID for screen %s: "+utils.ErrFormat, connector, err)
+		return ""
+	}
+
+	v, err := edidVendor(b)
+	if err != nil {
+		m.infof("couldn't get screen vendor from %s: "+utils.ErrFormat, edids[0], err)
+		return ""
+	}
+	return v
+}
+
+// edidVendor decodes the 3 letters PNP ID, packed in bytes 8-9 of the EDID base block
+func edidVendor(b []byte) (string, error) {
+	header := []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+	if len(b) < 10 || !bytes.Equal(b[:8], header) {
+		return "", errors.New("invalid EDID header")
+	}
+
+	id := uint16(b[8])<<8 | uint16(b[9])
+	var v []byte
+	for _, shift := range []uint{10, 5, 0} {
+		c := (id >> shift) & 0x1f
+		if c < 1 || c > 26 {
+			return "", errors.Errorf("invalid manufacturer ID: %#04x", id)
+		}
+		v = append(v, byte('A'+c-1))
+	}
+	return string(v), nil
+}
+
+// addVRAM annotates gpus with their video memory size, when the kernel driver exposes it (amdgpu does).
+// Sizes are bucketed to avoid being too precise.
+func (m Metrics) addVRAM(gpus []GPUInfo) {
+	if len(gpus) == 0 {
+		return
+	}
+
+	devices, err := filepath.Glob(filepath.Join(m.root, "sys/class/drm/card*/device"))
+	if err != nil {
+		m.infof("couldn't list drm cards: "+utils.ErrFormat, err)
+		return
+	}
+
+	for _, d := range devices {
+		// connectors, like card0-DP-1, point to the same device than their card
+		if strings.Contains(filepath.Base(filepath.Dir(d)), "-") {
+			continue
+		}
+
+		v, err := getFromFileTrimmed(filepath.Join(d, "mem_info_vram_total"))
+		if err != nil {
+			continue
+		}
+		size, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || size == 0 {
+			m.infof("invalid VRAM size for %s: %q", d, v)
+			continue
+		}
+
+		vendor, errVendor := getFromFileTrimmed(filepath.Join(d, "vendor"))
+		model, errModel := getFromFileTrimmed(filepath.Join(d, "device"))
+		if errVendor != nil || errModel != nil {
+			m.infof("couldn't identify GPU for %s", d)
+			continue
+		}
+		vendor = strings.ToLower(strings.TrimPrefix(vendor, "0x"))
+		model = strings.ToLower(strings.TrimPrefix(model, "0x"))
+
+		for i := range gpus {
+			if gpus[i].VRAM == 0 && gpus[i].Vendor == vendor && gpus[i].Model == model {
+				gpus[i].VRAM = vramBucket(size)
+				break
+			}
+		}
+	}
+}
+
+// vramBucket returns the size in GB, rounded up to the next power of 2
+func vramBucket(size uint64) int {
+	gb := 1
+	for uint64(gb)<<30 < size {
+		gb *= 2
+	}
+	return gb
+}
+
+// pathExists returns if p exists, following symlinks
+func pathExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
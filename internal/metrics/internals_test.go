@@ -6,7 +6,9 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ubuntu/ubuntu-report/internal/helper"
 )
@@ -84,6 +86,8 @@ func TestGetVersion(t *testing.T) {
 		want string
 	}{
 		{"regular", "testdata/good", "18.04"},
+		{"unquoted", "testdata/specials/ids/pop", "22.04"},
+		{"single quoted", "testdata/specials/ids/quoted", "16"},
 		{"empty file", "testdata/empty", ""},
 		{"missing", "testdata/missing-fields/ids/version", ""},
 		{"empty", "testdata/empty-fields/ids/version", ""},
@@ -136,19 +140,1320 @@ func TestGetRAM(t *testing.T) {
 	}
 }
 
+func TestGetMem(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		root        string
+		memInfoFile string
+
+		want int
+	}{
+		{"regular", "testdata/good", "", 8},
+		{"rounded to the nearest GiB", "testdata/specials/ram/rounded", "", 16},
+		{"less than 1 GiB", "testdata/specials/ram/small", "", 1},
+		{"meminfo file outside of root", "testdata/none", "testdata/specials/ram/rounded/proc/meminfo", 16},
+		{"meminfo file overrides root", "testdata/good", "testdata/specials/ram/small/proc/meminfo", 1},
+		{"empty file", "testdata/empty", "", 0},
+		{"missing", "testdata/missing-fields/ram", "", 0},
+		{"malformed", "testdata/specials/ram/malformed", "", 0},
+		{"doesn't exist", "testdata/none", "", 0},
+		{"meminfo file doesn't exist", "testdata/good", "testdata/none/proc/meminfo", 0},
+		{"garbage content", "testdata/garbage", "", 0},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root), WithMemInfoFile(tc.memInfoFile))
+			got := m.getMem()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetSwap(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want *SwapInfo
+	}{
+		{"regular", "testdata/good", &SwapInfo{2.1, false}},
+		{"swapfile", "testdata/specials/swap/swapfile", &SwapInfo{2.1, false}},
+		{"partition and file", "testdata/specials/swap/partition-and-file", &SwapInfo{10.5, false}},
+		{"zram", "testdata/specials/swap/zram", &SwapInfo{4, true}},
+		{"zswap", "testdata/specials/swap/zswap", &SwapInfo{4.2, true}},
+		{"zswap disabled", "testdata/specials/swap/zswap-disabled", &SwapInfo{4.2, false}},
+		{"no swap", "testdata/specials/swap/none", nil},
+		{"malformed", "testdata/specials/swap/malformed", nil},
+		{"doesn't exist", "testdata/none", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getSwap()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetNetwork(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want *NetworkInfo
+	}{
+		{"regular", "testdata/good", &NetworkInfo{Wired: 1, Wireless: 1}},
+		{"laptop", "testdata/specials/network/laptop", &NetworkInfo{Wireless: 1, Virtual: 1}},
+		{"server", "testdata/specials/network/server", &NetworkInfo{Wired: 2, Virtual: 2}},
+		{"loopback only", "testdata/specials/network/loopback-only", nil},
+		{"missing type", "testdata/specials/network/missing-type", &NetworkInfo{Wired: 1}},
+		{"doesn't exist", "testdata/none", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getNetwork()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetUptimeBucket(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want string
+	}{
+		{"regular", "testdata/good", "under-1w"},
+		{"less than an hour", "testdata/specials/uptime/hour", "under-1h"},
+		{"less than a day", "testdata/specials/uptime/day", "under-1d"},
+		{"more than a week", "testdata/specials/uptime/week", "over-1w"},
+		{"malformed", "testdata/specials/uptime/malformed", ""},
+		{"empty file", "testdata/empty", ""},
+		{"doesn't exist", "testdata/none", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getUptimeBucket()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
 func TestGetTimeZone(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
 		name string
-		root string
+		root string
+
+		want string
+	}{
+		{"regular", "testdata/good", "Europe"},
+		{"nested zone", "testdata/specials/timezone/america", "America"},
+		{"zone without region", "testdata/specials/timezone/utc", "UTC"},
+		{"localtime symlink", "testdata/specials/timezone/localtime", "Asia"},
+		{"relative localtime symlink", "testdata/specials/timezone/relative-localtime", "Australia"},
+		{"localtime not linking to zoneinfo", "testdata/specials/timezone/not-zoneinfo", ""},
+		{"localtime isn't a symlink", "testdata/specials/timezone/localtime-file", ""},
+		{"empty file", "testdata/empty", ""},
+		{"doesn't exist", "testdata/none", ""},
+		{"garbage content", "testdata/garbage", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getTimeZone()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetKeyboardLayout(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want string
+	}{
+		{"regular", "testdata/good", "fr"},
+		{"single layout", "testdata/specials/keyboard/single", "de"},
+		{"unquoted layout", "testdata/specials/keyboard/unquoted", "gb"},
+		{"empty layout", "testdata/specials/keyboard/empty-layout", ""},
+		{"no layout", "testdata/specials/keyboard/no-layout", ""},
+		{"garbage", "testdata/specials/keyboard/garbage", ""},
+		{"doesn't exist", "testdata/none", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getKeyboardLayout()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetDeploymentTag(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want string
+	}{
+		{"regular", "testdata/good", "production"},
+		{"empty file", "testdata/empty", ""},
+		{"doesn't exist", "testdata/none", ""},
+		{"too long", "testdata/specials/deployment-tag/too-long", ""},
+		{"garbage content", "testdata/garbage", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getDeploymentTag()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestHasTPMDiskUnlock(t *testing.T) {
+	t.Parallel()
+
+	tpm := true
+	passphrase := false
+	testCases := []struct {
+		name string
+		root string
+
+		want *bool
+	}{
+		{"tpm unlock", "testdata/specials/tpm-unlock/tpm", &tpm},
+		{"passphrase unlock", "testdata/specials/tpm-unlock/passphrase", &passphrase},
+		{"no encrypted volume", "testdata/specials/tpm-unlock/none", nil},
+		{"doesn't exist", "testdata/none", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.hasTPMDiskUnlock()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetInit(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		wantInit          string
+		wantCgroupVersion int
+	}{
+		{"systemd and cgroup v2", "testdata/good", "systemd", 2},
+		{"openrc and cgroup v1", "testdata/specials/init/openrc-cgroupv1", "openrc", 1},
+		{"unknown init", "testdata/specials/init/container-app", "other", 0},
+		{"garbage", "testdata/specials/init/garbage", "", 0},
+		{"empty file", "testdata/empty", "", 0},
+		{"doesn't exist", "testdata/none", "", 0},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+
+			a.Equal(m.getInit(), tc.wantInit)
+			a.Equal(m.getCgroupVersion(), tc.wantCgroupVersion)
+		})
+	}
+}
+
+func TestGetBattery(t *testing.T) {
+	t.Parallel()
+
+	hasBattery := true
+	noBattery := false
+	testCases := []struct {
+		name string
+		root string
+
+		wantHasBattery *bool
+		wantFormFactor string
+	}{
+		{"regular", "testdata/good", &hasBattery, "laptop"},
+		{"desktop with a peripheral battery", "testdata/specials/battery/desktop", &noBattery, "desktop"},
+		{"several batteries", "testdata/specials/battery/several", &hasBattery, "laptop"},
+		{"doesn't exist", "testdata/none", nil, ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			gotHasBattery, gotFormFactor := m.getBattery()
+
+			a.Equal(gotHasBattery, tc.wantHasBattery)
+			a.Equal(gotFormFactor, tc.wantFormFactor)
+		})
+	}
+}
+
+func TestGetCPUVulnerabilities(t *testing.T) {
+	t.Parallel()
+
+	loaded := true
+	notLoaded := false
+	testCases := []struct {
+		name string
+		root string
+
+		want          map[string]string
+		wantMicrocode *bool
+	}{
+		{"patched", "testdata/good",
+			map[string]string{"itlb_multihit": "Mitigation", "meltdown": "Not affected", "spectre_v1": "Mitigation", "spectre_v2": "Mitigation"},
+			&loaded},
+		{"unpatched", "testdata/specials/cpu-vulnerabilities/unpatched",
+			map[string]string{"itlb_multihit": "Vulnerable", "mds": "Vulnerable", "meltdown": "Vulnerable", "spectre_v1": "Vulnerable", "spectre_v2": "Vulnerable"},
+			&notLoaded},
+		{"unknown status", "testdata/specials/cpu-vulnerabilities/unknown-status",
+			map[string]string{"empty": "Unknown", "gather_data_sampling": "Unknown"},
+			&notLoaded},
+		{"no vulnerabilities listed", "testdata/specials/cpu-vulnerabilities/no-vulnerabilities", nil, &loaded},
+		{"doesn't exist", "testdata/none", nil, nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got, gotMicrocode := m.getCPUVulnerabilities()
+
+			a.Equal(got, tc.want)
+			a.Equal(gotMicrocode, tc.wantMicrocode)
+		})
+	}
+}
+
+func TestGetSnapCount(t *testing.T) {
+	t.Parallel()
+
+	noSnap := 0
+	twoSnaps := 2
+	threeSnaps := 3
+
+	testCases := []struct {
+		name string
+		root string
+
+		want *int
+	}{
+		{"regular", "testdata/good", &threeSnaps},
+		{"only snap mount points", "testdata/specials/snaps/snap-mount-only", &twoSnaps},
+		{"snapd without snaps", "testdata/specials/snaps/no-snap", &noSnap},
+		{"no snapd", "testdata/none", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getSnapCount()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+	t.Parallel()
+
+	encrypted := true
+	notEncrypted := false
+
+	testCases := []struct {
+		name string
+		root string
+
+		want *bool
+	}{
+		{"regular", "testdata/good", &notEncrypted},
+		{"luks volume", "testdata/specials/encryption/luks", &encrypted},
+		{"crypt device in mapper", "testdata/specials/encryption/mapper", &encrypted},
+		{"lvm without encryption", "testdata/specials/encryption/lvm", &notEncrypted},
+		{"no block devices", "testdata/none", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.isEncrypted()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetPackageCount(t *testing.T) {
+	t.Parallel()
+
+	noPackage := 0
+	fourPackages := 4
+
+	testCases := []struct {
+		name string
+		root string
+
+		want *int
+	}{
+		{"regular", "testdata/good", &fourPackages},
+		{"dpkg without package", "testdata/specials/packages/no-package", &noPackage},
+		{"no dpkg", "testdata/none", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getPackageCount()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetCloud(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want string
+	}{
+		{"bare metal", "testdata/good", "none"},
+		{"aws", "testdata/specials/cloud/aws", "aws"},
+		{"aws on xen", "testdata/specials/cloud/aws-xen", "aws"},
+		{"gce", "testdata/specials/cloud/gce", "gce"},
+		{"azure", "testdata/specials/cloud/azure", "azure"},
+		{"local hyper-v", "testdata/specials/cloud/hyperv", "none"},
+		{"doesn't exist", "testdata/none", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getCloud()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestIsOEMInstall(t *testing.T) {
+	t.Parallel()
+
+	oem := true
+	notOEM := false
+	testCases := []struct {
+		name string
+		root string
+
+		want *bool
+	}{
+		{"regular", "testdata/good", &notOEM},
+		{"oem-config state directory", "testdata/specials/oem-install/state-dir", &oem},
+		{"oem-config first boot binary", "testdata/specials/oem-install/binary", &oem},
+		{"not an oem install", "testdata/specials/oem-install/not-oem", &notOEM},
+		{"doesn't exist", "testdata/none", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.isOEMInstall()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetBootloader(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want string
+	}{
+		{"grub", "testdata/good", "grub"},
+		{"systemd-boot", "testdata/specials/bootloader/systemd-boot", "systemd-boot"},
+		{"systemd-boot with esp mounted on boot", "testdata/specials/bootloader/esp-on-boot", "systemd-boot"},
+		{"systemd-boot with grub leftovers", "testdata/specials/bootloader/systemd-boot-after-grub", "systemd-boot"},
+		{"refind", "testdata/specials/bootloader/refind", "refind"},
+		{"unknown bootloader", "testdata/specials/bootloader/unknown", ""},
+		{"doesn't exist", "testdata/none", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getBootloader()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestIsSecureBoot(t *testing.T) {
+	t.Parallel()
+
+	enabled := true
+	disabled := false
+	testCases := []struct {
+		name string
+		root string
+
+		want *bool
+	}{
+		{"enabled", "testdata/specials/secureboot/enabled", &enabled},
+		{"disabled", "testdata/specials/secureboot/disabled", &disabled},
+		{"no secure boot variable", "testdata/specials/secureboot/no-variable", &disabled},
+		{"legacy bios", "testdata/specials/secureboot/legacy", nil},
+		{"garbage", "testdata/specials/secureboot/garbage", nil},
+		{"doesn't exist", "testdata/none", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.isSecureBoot()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestHasCustomHostname(t *testing.T) {
+	t.Parallel()
+
+	custom := true
+	generated := false
+	testCases := []struct {
+		name string
+		root string
+
+		want *bool
+	}{
+		{"user and product name", "testdata/good", &generated},
+		{"custom", "testdata/specials/hostname/custom", &custom},
+		{"ubuntu", "testdata/specials/hostname/ubuntu", &generated},
+		{"user and desktop", "testdata/specials/hostname/desktop", &generated},
+		{"empty file", "testdata/empty", nil},
+		{"doesn't exist", "testdata/none", nil},
+		{"garbage content", "testdata/garbage", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.hasCustomHostname()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetAptSource(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want string
+	}{
+		{"regular", "testdata/good", "country-mirror"},
+		{"default archive", "testdata/specials/apt-source/default", "default"},
+		{"country mirror", "testdata/specials/apt-source/country-mirror", "country-mirror"},
+		{"other mirror", "testdata/specials/apt-source/mirror", "mirror"},
+		{"deb822 sources", "testdata/specials/apt-source/deb822", "country-mirror"},
+		{"proxy configuration", "testdata/specials/apt-source/proxy", "proxy"},
+		{"proxy in sources", "testdata/specials/apt-source/proxy-in-sources", "proxy"},
+		{"disabled proxy", "testdata/specials/apt-source/disabled-proxy", "country-mirror"},
+		{"third party only", "testdata/specials/apt-source/third-party", ""},
+		{"garbage content", "testdata/garbage", ""},
+		{"doesn't exist", "testdata/none", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getAptSource()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestIsImmutableRoot(t *testing.T) {
+	t.Parallel()
+
+	immutable := true
+	traditional := false
+	testCases := []struct {
+		name string
+		root string
+
+		want *bool
+	}{
+		{"regular ext4 root", "testdata/good", &traditional},
+		{"overlay root", "testdata/specials/immutable-root/overlay", &immutable},
+		{"loop device root", "testdata/specials/immutable-root/loop", &immutable},
+		{"empty file", "testdata/empty", nil},
+		{"doesn't exist", "testdata/none", nil},
+		{"garbage content", "testdata/garbage", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.isImmutableRoot()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetAutologin(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want bool
+	}{
+		{"regular", "testdata/good", false},
+		{"empty file", "testdata/empty", false},
+		{"missing", "testdata/missing-fields/autologin", false},
+		{"empty", "testdata/empty-fields/autologin", false},
+		{"enabled", "testdata/specials/autologin/true", true},
+		{"disabled", "testdata/specials/autologin/false", false},
+		{"enabled no space", "testdata/specials/autologin/true-no-space", true},
+		{"uppercase", "testdata/specials/autologin/true-uppercase", true},
+		{"doesn't exist", "testdata/none", false},
+		{"garbage content", "testdata/garbage", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getAutologin()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetOEM(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		wantVendor  string
+		wantProduct string
+		wantFamily  string
+		wantVersion string
+		wantDCD     string
+	}{
+		{"regular", "testdata/good", "DID", "4287CTO", "Thinkpad", "ThinkPad T430", ""},
+		{"laptop", "testdata/specials/oem/laptop", "LENOVO", "20L5CTO1WW", "ThinkPad T480", "ThinkPad T480", ""},
+		{"server", "testdata/specials/oem/server", "Dell Inc.", "PowerEdge R740", "", "", ""},
+		{"placeholders", "testdata/specials/oem/placeholders", "", "", "", "", ""},
+		{"serial-like values", "testdata/specials/oem/serial", "QEMU", "Standard PC (Q35 + ICH9, 2009)", "", "", ""},
+		{"with dcd", "testdata/specials/oem/with-dcd", "", "", "", "", "canonical-oem-somerville-xenial-amd64-20160624-2"},
+		{"empty vendor", "testdata/empty-fields/oem/vendor", "", "4287CTO", "Thinkpad", "", ""},
+		{"empty product", "testdata/empty-fields/oem/product", "DID", "", "Thinkpad", "", ""},
+		{"empty family", "testdata/empty-fields/oem/family", "DID", "4287CTO", "", "", ""},
+		{"empty dcd", "testdata/empty-fields/oem/dcd", "DID", "4287CTO", "Thinkpad", "", ""},
+		{"empty both", "testdata/empty", "", "", "", "", ""},
+		{"doesn't exist", "testdata/none", "", "", "", "", ""},
+		{"garbage content", "testdata/garbage", "", "", "", "", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			vendor, product, family, version, dcd := m.getOEM()
+
+			a.Equal(vendor, tc.wantVendor)
+			a.Equal(product, tc.wantProduct)
+			a.Equal(family, tc.wantFamily)
+			a.Equal(version, tc.wantVersion)
+			a.Equal(dcd, tc.wantDCD)
+		})
+	}
+}
+
+func TestGetBIOS(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		wantVendor  string
+		wantVersion string
+	}{
+		{"regular", "testdata/good", "DID", "42 (maybe 43)"},
+		{"empty vendor", "testdata/empty-fields/bios/vendor", "", "42 (maybe 43)"},
+		{"empty product", "testdata/empty-fields/bios/version", "DID", ""},
+		{"empty both", "testdata/empty", "", ""},
+		{"doesn't exist", "testdata/none", "", ""},
+		{"garbage content", "testdata/garbage", "", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			vendor, version := m.getBIOS()
+
+			a.Equal(vendor, tc.wantVendor)
+			a.Equal(version, tc.wantVersion)
+		})
+	}
+}
+
+func TestGetFirmware(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		wantVersion string
+		wantDate    string
+	}{
+		{"regular", "testdata/good", "42 (maybe 43)", "2019-08-13"},
+		{"empty version", "testdata/empty-fields/bios/version", "", "2019-08-13"},
+		{"empty date", "testdata/empty-fields/bios/date", "42 (maybe 43)", ""},
+		{"malformed date", "testdata/specials/bios/malformed-date", "42 (maybe 43)", ""},
+		{"empty both", "testdata/empty", "", ""},
+		{"doesn't exist", "testdata/none", "", ""},
+		{"garbage content", "testdata/garbage", "", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			version, date := m.getFirmware()
+
+			a.Equal(version, tc.wantVersion)
+			a.Equal(date, tc.wantDate)
+		})
+	}
+}
+
+func TestGetLivePatch(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		want bool
+	}{
+		{"regular", "testdata/good", true},
+		{"disabled", "testdata/none", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			enabled := m.getLivePatch()
+
+			a.Equal(enabled, tc.want)
+		})
+	}
+}
+
+func TestGetDisks(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		wantSize []float64
+	}{
+		{"one disk", "testdata/good", []float64{240.1}},
+		{"multiple disks", "testdata/specials/disks/multiple", []float64{240.1, 500.1}},
+		{"all supported formats", "testdata/specials/disks/all-formats", []float64{500.1, 240.1, 192.9}},
+		{"no disks", "testdata/specials/disks/no-disks", nil},
+		{"filters undesired devices", "testdata/specials/disks/filter-devices", []float64{240.1}},
+		{"no block numbers", "testdata/empty-fields/disks/block-numbers", nil},
+		{"no block logical size", "testdata/empty-fields/disks/block-logical-size", nil},
+		{"none", "testdata/none", nil},
+		{"garbage block numbers", "testdata/specials/disks/garbage-block-numbers", nil},
+		{"garbage block size", "testdata/specials/disks/garbage-block-size", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			disks := m.getDisks()
+
+			a.Equal(disks, tc.wantSize)
+		})
+	}
+}
+func TestGetCPU(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+
+		want CPUInfo
+	}{
+		{"regular", CPUInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
+			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", "", 1, 4, 2, 4000}},
+		{"missing one expected field", CPUInfo{"32-bit, 64-bit", "8", "2", "4", "1", "", "6", "158", "10",
+			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", "", 1, 4, 2, 4000}},
+		{"missing one optional field", CPUInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
+			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", "", 1, 4, 2, 4000}},
+		{"virtualized", CPUInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
+			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "KVM", "full", 1, 4, 2, 4000}},
+		{"without space", CPUInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
+			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", "", 1, 4, 2, 4000}},
+		{"many cores", CPUInfo{"32-bit, 64-bit", "128", "2", "32", "2", "AuthenticAMD", "23", "49", "0",
+			"AMD EPYC 7502 32-Core Processor", "AMD-V", "", "", 2, 32, 2, 0}},
+		{"arm", CPUInfo{"32-bit, 64-bit", "8", "1", "", "-", "ARM", "", "3", "r0p3",
+			"Cortex-A72", "", "", "", 0, 0, 1, 0}},
+		{"rounded max frequency", CPUInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
+			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", "", 1, 4, 2, 4500}},
+		{"low max frequency", CPUInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
+			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", "", 1, 4, 2, 500}},
+		{"invalid max frequency", CPUInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
+			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", "", 1, 4, 2, 0}},
+		{"empty", CPUInfo{}},
+		{"garbage", CPUInfo{}},
+		{"fail", CPUInfo{}},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmd, cancel := newMockShortCmd(t, "lscpu", "-J", tc.name)
+			defer cancel()
+
+			m := newTestMetrics(t, WithCPUInfoCommand(cmd))
+			info := m.getCPU()
+
+			a.Equal(info, tc.want)
+		})
+	}
+}
+
+func TestGetGPU(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+
+		want        []GPUInfo
+		wantOffload []GPUInfo
+	}{
+		{"one gpu", []GPUInfo{{"8086", "0126", "", "", 0}}, nil},
+		{"multiple gpus", []GPUInfo{{"8086", "0126", "", "", 0}, {"8086", "0127", "", "", 0}}, nil},
+		{"no revision number", []GPUInfo{{"8086", "0126", "", "", 0}}, nil},
+		{"no gpu", nil, nil},
+		{"hexa numbers", []GPUInfo{{"8b86", "a126", "", "", 0}}, nil},
+		{"intel nvidia gpus", []GPUInfo{{"8086", "9bc4", "", "", 0}, {"10de", "1f91", "", "", 0}}, nil},
+		{"intel nvidia offload gpus", []GPUInfo{{"8086", "9bc4", "", "", 0}}, []GPUInfo{{"10de", "1f91", "", "", 0}}},
+		{"amd apu amd gpu", []GPUInfo{{"1002", "1638", "", "", 0}}, []GPUInfo{{"1002", "73ff", "", "", 0}}},
+		{"empty", nil, nil},
+		{"malformed gpu line", nil, nil},
+		{"garbage", nil, nil},
+		{"fail", nil, nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmd, cancel := newMockShortCmd(t, "lspci", "-n", tc.name)
+			defer cancel()
+
+			m := newTestMetrics(t, WithGPUInfoCommand(cmd))
+			info, offload := m.getGPU()
+
+			a.Equal(info, tc.want)
+			a.Equal(offload, tc.wantOffload)
+		})
+	}
+}
+
+func TestHasHybridGraphics(t *testing.T) {
+	t.Parallel()
+
+	hybrid := true
+	notHybrid := false
+	testCases := []struct {
+		name string
+
+		want *bool
+	}{
+		{"intel nvidia gpus", &hybrid},
+		{"intel nvidia offload gpus", &hybrid},
+		{"amd apu amd gpu", &hybrid},
+		{"hybrid gpus", &hybrid},
+		{"dual nvidia gpus", &notHybrid},
+		{"multiple gpus", &notHybrid},
+		{"one gpu", &notHybrid},
+		{"no gpu", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmd, cancel := newMockShortCmd(t, "lspci", "-n", tc.name)
+			defer cancel()
+
+			m := newTestMetrics(t, WithGPUInfoCommand(cmd))
+			got := hasHybridGraphics(m.getGPU())
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestAddRenderDrivers(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		caseGPU    string
+		caseRender string
+
+		want []GPUInfo
+	}{
+		{"intel iris", "one gpu", "intel iris", []GPUInfo{{"8086", "0126", "", "iris", 0}}},
+		{"amd radeonsi", "amd gpu", "amd radeonsi", []GPUInfo{{"1002", "67df", "", "radeonsi", 0}}},
+		{"generic driver on one gpu", "one gpu", "zink", []GPUInfo{{"8086", "0126", "", "zink", 0}}},
+		{"hybrid graphics", "hybrid gpus", "hybrid", []GPUInfo{{"8086", "3e9b", "", "iris", 0}, {"1002", "67df", "", "radeonsi", 0}}},
+		{"driver for another vendor", "one gpu", "amd radeonsi", []GPUInfo{{"8086", "0126", "", "", 0}}},
+		{"no gpu", "no gpu", "intel iris", nil},
+		{"empty", "one gpu", "empty", []GPUInfo{{"8086", "0126", "", "", 0}}},
+		{"garbage", "one gpu", "garbage", []GPUInfo{{"8086", "0126", "", "", 0}}},
+		{"fail", "one gpu", "fail", []GPUInfo{{"8086", "0126", "", "", 0}}},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			gpuCmd, cancel := newMockShortCmd(t, "lspci", "-n", tc.caseGPU)
+			defer cancel()
+			renderCmd, cancel := newMockShortCmd(t, "eglinfo", "-B", tc.caseRender)
+			defer cancel()
+
+			m := newTestMetrics(t, WithGPUInfoCommand(gpuCmd), WithRenderInfoCommand(renderCmd))
+			info, _ := m.getGPU()
+			m.addRenderDrivers(info)
+
+			a.Equal(info, tc.want)
+		})
+	}
+}
+
+func TestAddGPUDrivers(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		caseGPU    string
+		caseDriver string
+
+		want []GPUInfo
+	}{
+		{"one gpu with driver", "one gpu", "one gpu with driver", []GPUInfo{{"8086", "0126", "i915", "", 0}}},
+		{"one gpu without driver", "one gpu", "one gpu without driver", []GPUInfo{{"8086", "0126", "", "", 0}}},
+		{"hybrid graphics", "intel nvidia gpus", "intel nvidia gpus with driver", []GPUInfo{{"8086", "9bc4", "i915", "", 0}, {"10de", "1f91", "nvidia", "", 0}}},
+		{"offload gpu driver is skipped", "intel nvidia offload gpus", "intel nvidia offload gpus with driver", []GPUInfo{{"8086", "9bc4", "i915", "", 0}}},
+		{"another gpu", "one gpu", "another gpu", []GPUInfo{{"8086", "0126", "", "", 0}}},
+		{"no gpu", "no gpu", "one gpu with driver", nil},
+		{"empty", "one gpu", "empty", []GPUInfo{{"8086", "0126", "", "", 0}}},
+		{"garbage", "one gpu", "garbage", []GPUInfo{{"8086", "0126", "", "", 0}}},
+		{"fail", "one gpu", "fail", []GPUInfo{{"8086", "0126", "", "", 0}}},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			gpuCmd, cancel := newMockShortCmd(t, "lspci", "-n", tc.caseGPU)
+			defer cancel()
+			driverCmd, cancel := newMockShortCmd(t, "lspci", "-nk", tc.caseDriver)
+			defer cancel()
+
+			m := newTestMetrics(t, WithGPUInfoCommand(gpuCmd), WithGPUDriverCommand(driverCmd))
+			info, _ := m.getGPU()
+			m.addGPUDrivers(info)
+
+			a.Equal(info, tc.want)
+		})
+	}
+}
+
+func TestAddVRAM(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+		gpus []GPUInfo
+
+		want []GPUInfo
+	}{
+		{"amdgpu", "testdata/specials/gpu-vram/amdgpu", []GPUInfo{{"1002", "67df", "amdgpu", "", 0}}, []GPUInfo{{"1002", "67df", "amdgpu", "", 8}}},
+		{"hybrid graphics", "testdata/specials/gpu-vram/hybrid",
+			[]GPUInfo{{"8086", "3e9b", "i915", "", 0}, {"1002", "67df", "amdgpu", "", 0}},
+			[]GPUInfo{{"8086", "3e9b", "i915", "", 0}, {"1002", "67df", "amdgpu", "", 4}}},
+		{"less than 1 GB", "testdata/specials/gpu-vram/small", []GPUInfo{{"1002", "67df", "", "", 0}}, []GPUInfo{{"1002", "67df", "", "", 1}}},
+		{"vram for another gpu", "testdata/specials/gpu-vram/other-gpu", []GPUInfo{{"1002", "67df", "", "", 0}}, []GPUInfo{{"1002", "67df", "", "", 0}}},
+		{"garbage", "testdata/specials/gpu-vram/garbage", []GPUInfo{{"1002", "67df", "", "", 0}}, []GPUInfo{{"1002", "67df", "", "", 0}}},
+		{"no vram information", "testdata/good", []GPUInfo{{"8086", "0126", "i915", "", 0}}, []GPUInfo{{"8086", "0126", "i915", "", 0}}},
+		{"doesn't exist", "testdata/none", []GPUInfo{{"8086", "0126", "", "", 0}}, []GPUInfo{{"8086", "0126", "", "", 0}}},
+		{"no gpu", "testdata/specials/gpu-vram/amdgpu", nil, nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			m.addVRAM(tc.gpus)
+
+			a.Equal(tc.gpus, tc.want)
+		})
+	}
+}
+
+func TestGetScreens(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+
+		want []ScreenInfo
+	}{
+		{"one screen", []ScreenInfo{{"277mmx156mm", "1366x768", "60.02", "DEL"}}},
+		{"multiple screens", []ScreenInfo{{"277mmx156mm", "1366x768", "60.02", "DEL"}, {"510mmx287mm", "1920x1080", "60.00", ""}}},
+		{"two screens", []ScreenInfo{{"344mmx194mm", "1920x1080", "144.00", ""}, {"597mmx336mm", "2560x1440", "74.97", ""}}},
+		{"size missing on second screen", []ScreenInfo{{"277mmx156mm", "1366x768", "60.02", "DEL"}}},
+		{"no screen", nil},
+		{"chosen resolution not first", []ScreenInfo{{"510mmx287mm", "1600x1200", "60.00", ""}}},
+		{"no specified screen size", nil},
+		{"no chosen resolution", nil},
+		{"chosen resolution not preferred", []ScreenInfo{{"510mmx287mm", "1920x1080", "60.00", ""}}},
+		{"multiple frequencies for resolution", []ScreenInfo{{"510mmx287mm", "1920x1080", "60.00", ""}}},
+		{"multiple frequencies select other resolution", []ScreenInfo{{"510mmx287mm", "1920x1080", "50.00", ""}}},
+		{"multiple frequencies select other resolution on non preferred", []ScreenInfo{{"510mmx287mm", "1920x1080", "50.00", ""}}},
+		{"empty", nil},
+		{"malformed screen line", nil},
+		{"garbage", nil},
+		{"fail", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmd, cancel := newMockShortCmd(t, "xrandr", tc.name)
+			defer cancel()
+
+			m := newTestMetrics(t, WithRootAt("testdata/good"), WithScreenInfoCommand(cmd))
+			info := m.getScreens()
+
+			a.Equal(info, tc.want)
+		})
+	}
+}
+
+func TestGetScreenVendor(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		root      string
+		connector string
+
+		want string
+	}{
+		{"regular", "testdata/good", "LVDS-1", "DEL"},
+		{"other connector", "testdata/good", "HDMI-1", ""},
+		{"empty", "testdata/empty", "LVDS-1", ""},
+		{"doesn't exist", "testdata/none", "LVDS-1", ""},
+		{"garbage content", "testdata/garbage", "LVDS-1", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getScreenVendor(tc.connector)
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetPartitions(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+
+		want       []float64
+		wantTypes  []string
+		wantMounts []string
+	}{
+		{"one partition", []float64{159.4}, []string{"ssd"}, []string{"/"}},
+		{"multiple partitions", []float64{159.4, 309.7}, []string{"ssd", "hdd"}, []string{"/", "/something"}},
+		{"no partitions", nil, nil, nil},
+		{"filters loop devices", []float64{159.4}, []string{"ssd"}, []string{"/"}},
+		{"nvme and mapper partitions", []float64{159.4, 309.7}, []string{"ssd", "unknown"}, []string{"/", "/home"}},
+		{"user mount", []float64{159.4, 309.7}, []string{"ssd", "hdd"}, []string{"/", "/home/alice/my data"}},
+		{"empty", nil, nil, nil},
+		{"malformed partition line string", nil, nil, nil},
+		{"malformed partition line one field", nil, nil, nil},
+		{"garbage", nil, nil, nil},
+		{"fail", nil, nil, nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmd, cancel := newMockShortCmd(t, "df", tc.name)
+			defer cancel()
+
+			m := newTestMetrics(t, WithRootAt("testdata/good"), WithSpaceInfoCommand(cmd))
+			info, types, _, mounts := m.getPartitions()
+
+			a.Equal(info, tc.want)
+			a.Equal(types, tc.wantTypes)
+			a.Equal(mounts, tc.wantMounts)
+		})
+	}
+}
+
+func TestGetPartitionFSTypes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		casePartition string
+		caseFSType    string
+
+		want []string
+	}{
+		{"ext4 root", "one partition", "ext4 root", []string{"ext4"}},
+		{"btrfs root", "one partition", "btrfs root", []string{"btrfs"}},
+		{"multiple partitions", "multiple partitions", "multiple partitions", []string{"ext4", "xfs"}},
+		{"filters loop devices", "filters loop devices", "filters loop devices", []string{"ext4"}},
+		{"nvme and mapper partitions", "nvme and mapper partitions", "nvme and mapper partitions", []string{"btrfs", "ext4"}},
+		{"missing partition", "multiple partitions", "missing partition", []string{"unknown", "xfs"}},
+		{"empty", "one partition", "empty", nil},
+		{"malformed", "one partition", "malformed", nil},
+		{"garbage", "one partition", "garbage", nil},
+		{"fail", "one partition", "fail", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			spaceCmd, cancel := newMockShortCmd(t, "df", tc.casePartition)
+			defer cancel()
+			fsTypeCmd, cancel := newMockShortCmd(t, "df", "--output=source,fstype", tc.caseFSType)
+			defer cancel()
+
+			m := newTestMetrics(t, WithRootAt("testdata/good"), WithSpaceInfoCommand(spaceCmd), WithFSTypeCommand(fsTypeCmd))
+			_, _, got, _ := m.getPartitions()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetPartitionType(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		root      string
+		partition string
+
+		want string
+	}{
+		{"ssd", "testdata/good", "sda5", "ssd"},
+		{"hdd", "testdata/good", "sdc2", "hdd"},
+		{"nvme partition", "testdata/good", "nvme0n1p2", "ssd"},
+		{"whole device", "testdata/good", "sdc", "hdd"},
+		{"device mapper", "testdata/good", "mapper/vgubuntu-root", "unknown"},
+		{"garbage content", "testdata/garbage", "sda5", "unknown"},
+		{"doesn't exist", "testdata/none", "sda5", "unknown"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := newTestMetrics(t, WithRootAt(tc.root))
+			got := m.getPartitionType(tc.partition)
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetArch(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
 
 		want string
 	}{
-		{"regular", "testdata/good", "Europe/Paris"},
-		{"empty file", "testdata/empty", ""},
-		{"doesn't exist", "testdata/none", ""},
-		{"garbage content", "testdata/garbage", ""},
+		{"regular", "amd64"},
+		{"empty", ""},
+		{"fail", ""},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -156,33 +1461,29 @@ func TestGetTimeZone(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m := newTestMetrics(t, WithRootAt(tc.root))
-			got := m.getTimeZone()
+			cmd, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", tc.name)
+			defer cancel()
 
-			a.Equal(got, tc.want)
+			m := newTestMetrics(t, WithArchitectureCommand(cmd))
+			arch := m.getArch()
+
+			a.Equal(arch, tc.want)
 		})
 	}
 }
 
-func TestGetAutologin(t *testing.T) {
+func TestGetKernel(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
 		name string
-		root string
 
-		want bool
+		want string
 	}{
-		{"regular", "testdata/good", false},
-		{"empty file", "testdata/empty", false},
-		{"missing", "testdata/missing-fields/autologin", false},
-		{"empty", "testdata/empty-fields/autologin", false},
-		{"enabled", "testdata/specials/autologin/true", true},
-		{"disabled", "testdata/specials/autologin/false", false},
-		{"enabled no space", "testdata/specials/autologin/true-no-space", true},
-		{"uppercase", "testdata/specials/autologin/true-uppercase", true},
-		{"doesn't exist", "testdata/none", false},
-		{"garbage content", "testdata/garbage", false},
+		{"regular", "5.4.0-42-generic"},
+		{"empty", ""},
+		{"garbage", ""},
+		{"fail", ""},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -190,35 +1491,36 @@ func TestGetAutologin(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m := newTestMetrics(t, WithRootAt(tc.root))
-			got := m.getAutologin()
+			cmd, cancel := newMockShortCmd(t, "uname", "-r", tc.name)
+			defer cancel()
+
+			m := newTestMetrics(t, WithKernelCommand(cmd))
+			got := m.getKernel()
 
 			a.Equal(got, tc.want)
 		})
 	}
 }
 
-func TestGetOEM(t *testing.T) {
+func TestGetDesktopVersion(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		name string
-		root string
+		name       string
+		desktop    string
+		caseGNOME  string
+		casePlasma string
 
-		wantVendor  string
-		wantProduct string
-		wantFamily  string
-		wantDCD     string
+		want string
 	}{
-		{"regular", "testdata/good", "DID", "4287CTO", "Thinkpad", ""},
-		{"with dcd", "testdata/specials/oem/with-dcd", "", "", "", "canonical-oem-somerville-xenial-amd64-20160624-2"},
-		{"empty vendor", "testdata/empty-fields/oem/vendor", "", "4287CTO", "Thinkpad", ""},
-		{"empty product", "testdata/empty-fields/oem/product", "DID", "", "Thinkpad", ""},
-		{"empty family", "testdata/empty-fields/oem/family", "DID", "4287CTO", "", ""},
-		{"empty dcd", "testdata/empty-fields/oem/dcd", "DID", "4287CTO", "Thinkpad", ""},
-		{"empty both", "testdata/empty", "", "", "", ""},
-		{"doesn't exist", "testdata/none", "", "", "", ""},
-		{"garbage content", "testdata/garbage", "", "", "", ""},
+		{"gnome", "ubuntu:GNOME", "regular", "regular", "46.0"},
+		{"older gnome", "GNOME", "older", "regular", "3.38.4"},
+		{"kde", "KDE", "regular", "regular", "5.27.11"},
+		{"unknown desktop", "XFCE", "regular", "regular", ""},
+		{"no desktop", "", "regular", "regular", ""},
+		{"empty", "GNOME", "empty", "regular", ""},
+		{"garbage", "GNOME", "garbage", "regular", ""},
+		{"fail", "KDE", "regular", "fail", ""},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -226,33 +1528,35 @@ func TestGetOEM(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m := newTestMetrics(t, WithRootAt(tc.root))
-			vendor, product, family, dcd := m.getOEM()
+			cmdGNOME, cancel := newMockShortCmd(t, "gnome-shell", "--version", tc.caseGNOME)
+			defer cancel()
+			cmdPlasma, cancel := newMockShortCmd(t, "plasmashell", "--version", tc.casePlasma)
+			defer cancel()
 
-			a.Equal(vendor, tc.wantVendor)
-			a.Equal(product, tc.wantProduct)
-			a.Equal(family, tc.wantFamily)
-			a.Equal(dcd, tc.wantDCD)
+			m := newTestMetrics(t, WithGNOMEShellCommand(cmdGNOME), WithPlasmaShellCommand(cmdPlasma),
+				WithMapForEnv(map[string]string{"XDG_CURRENT_DESKTOP": tc.desktop}))
+			got := m.getDesktopVersion()
+
+			a.Equal(got, tc.want)
 		})
 	}
 }
 
-func TestGetBIOS(t *testing.T) {
+func TestGetDefaultBrowser(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
 		name string
-		root string
 
-		wantVendor  string
-		wantVersion string
+		want string
 	}{
-		{"regular", "testdata/good", "DID", "42 (maybe 43)"},
-		{"empty vendor", "testdata/empty-fields/bios/vendor", "", "42 (maybe 43)"},
-		{"empty product", "testdata/empty-fields/bios/version", "DID", ""},
-		{"empty both", "testdata/empty", "", ""},
-		{"doesn't exist", "testdata/none", "", ""},
-		{"garbage content", "testdata/garbage", "", ""},
+		{"regular", "firefox"},
+		{"deb", "google-chrome"},
+		{"flatpak", "chromium"},
+		{"user desktop file", ""},
+		{"empty", ""},
+		{"garbage", ""},
+		{"fail", ""},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -260,26 +1564,32 @@ func TestGetBIOS(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m := newTestMetrics(t, WithRootAt(tc.root))
-			vendor, version := m.getBIOS()
+			cmd, cancel := newMockShortCmd(t, "xdg-settings", "get", "default-web-browser", tc.name)
+			defer cancel()
 
-			a.Equal(vendor, tc.wantVendor)
-			a.Equal(version, tc.wantVersion)
+			m := newTestMetrics(t, WithBrowserCommand(cmd))
+			got := m.getDefaultBrowser()
+
+			a.Equal(got, tc.want)
 		})
 	}
 }
 
-func TestGetLivePatch(t *testing.T) {
+func TestGetDefaultTerminal(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
 		name string
-		root string
 
-		want bool
+		want string
 	}{
-		{"regular", "testdata/good", true},
-		{"disabled", "testdata/none", false},
+		{"regular", "gnome-terminal"},
+		{"konsole", "konsole"},
+		{"user binary", ""},
+		{"no value", ""},
+		{"empty", ""},
+		{"garbage", ""},
+		{"fail", ""},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -287,33 +1597,32 @@ func TestGetLivePatch(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m := newTestMetrics(t, WithRootAt(tc.root))
-			enabled := m.getLivePatch()
+			cmd, cancel := newMockShortCmd(t, "update-alternatives", "--query", "x-terminal-emulator", tc.name)
+			defer cancel()
 
-			a.Equal(enabled, tc.want)
+			m := newTestMetrics(t, WithTerminalCommand(cmd))
+			got := m.getDefaultTerminal()
+
+			a.Equal(got, tc.want)
 		})
 	}
 }
 
-func TestGetDisks(t *testing.T) {
+func TestGetVirtualization(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
 		name string
-		root string
 
-		wantSize []float64
+		want string
 	}{
-		{"one disk", "testdata/good", []float64{240.1}},
-		{"multiple disks", "testdata/specials/disks/multiple", []float64{240.1, 500.1}},
-		{"all supported formats", "testdata/specials/disks/all-formats", []float64{500.1, 240.1, 192.9}},
-		{"no disks", "testdata/specials/disks/no-disks", nil},
-		{"filters undesired devices", "testdata/specials/disks/filter-devices", []float64{240.1}},
-		{"no block numbers", "testdata/empty-fields/disks/block-numbers", nil},
-		{"no block logical size", "testdata/empty-fields/disks/block-logical-size", nil},
-		{"none", "testdata/none", nil},
-		{"garbage block numbers", "testdata/specials/disks/garbage-block-numbers", nil},
-		{"garbage block size", "testdata/specials/disks/garbage-block-size", nil},
+		{"regular", "kvm"},
+		{"container", "lxc"},
+		{"none", "none"},
+		{"command doesn't exist", "none"},
+		{"empty", ""},
+		{"garbage", ""},
+		{"fail", ""},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -321,34 +1630,37 @@ func TestGetDisks(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m := newTestMetrics(t, WithRootAt(tc.root))
-			disks := m.getDisks()
+			cmd, cancel := newMockShortCmd(t, "systemd-detect-virt", tc.name)
+			defer cancel()
+			if tc.name == "command doesn't exist" {
+				cmd = exec.Command("systemd-detect-virt-doesnt-exist")
+			}
 
-			a.Equal(disks, tc.wantSize)
+			m := newTestMetrics(t, WithVirtCommand(cmd))
+			got := m.getVirtualization()
+
+			a.Equal(got, tc.want)
 		})
 	}
 }
-func TestGetCPU(t *testing.T) {
+
+func TestGetUXProfile(t *testing.T) {
 	t.Parallel()
 
+	enabled := true
+	disabled := false
 	testCases := []struct {
 		name string
 
-		want cpuInfo
+		want *UXProfile
 	}{
-		{"regular", cpuInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
-			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", ""}},
-		{"missing one expected field", cpuInfo{"32-bit, 64-bit", "8", "2", "4", "1", "", "6", "158", "10",
-			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", ""}},
-		{"missing one optional field", cpuInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
-			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", ""}},
-		{"virtualized", cpuInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
-			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "KVM", "full"}},
-		{"without space", cpuInfo{"32-bit, 64-bit", "8", "2", "4", "1", "Genuine", "6", "158", "10",
-			"Intuis Corus i5-8300H CPU @ 2.30GHz", "VT-x", "", ""}},
-		{"empty", cpuInfo{}},
-		{"garbage", cpuInfo{}},
-		{"fail", cpuInfo{}},
+		{"regular", &UXProfile{"0", "1.0", "light", &enabled}},
+		{"dark scaled", &UXProfile{"0", "1.5", "dark", &disabled}},
+		{"dark gtk theme only", &UXProfile{Theme: "dark"}},
+		{"partial", &UXProfile{TextScalingFactor: "1.25"}},
+		{"empty", nil},
+		{"garbage", nil},
+		{"fail", nil},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -356,34 +1668,72 @@ func TestGetCPU(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			cmd, cancel := newMockShortCmd(t, "lscpu", "-J", tc.name)
+			cmd, cancel := newMockShortCmd(t, "gsettings", "list-recursively", "org.gnome.desktop.interface", tc.name)
 			defer cancel()
 
-			m := newTestMetrics(t, WithCPUInfoCommand(cmd))
-			info := m.getCPU()
+			m := newTestMetrics(t, WithUXProfileCommand(cmd))
+			got := m.getUXProfile()
 
-			a.Equal(info, tc.want)
+			a.Equal(got, tc.want)
 		})
 	}
 }
 
-func TestGetGPU(t *testing.T) {
+func TestGetAccessibility(t *testing.T) {
+	t.Parallel()
+
+	enabled := true
+	disabled := false
+	testCases := []struct {
+		name             string
+		caseHighContrast string
+		caseScreenReader string
+		caseLargeText    string
+
+		want *Accessibility
+	}{
+		{"screen reader enabled", "disabled", "enabled", "disabled", &Accessibility{&disabled, &enabled, &disabled}},
+		{"everything enabled", "enabled", "enabled", "enabled", &Accessibility{&enabled, &enabled, &enabled}},
+		{"nothing enabled", "disabled", "disabled", "disabled", &Accessibility{&disabled, &disabled, &disabled}},
+		{"only large text available", "fail", "empty", "enabled", &Accessibility{LargeText: &enabled}},
+		{"empty", "empty", "empty", "empty", nil},
+		{"garbage", "garbage", "garbage", "garbage", nil},
+		{"fail", "fail", "fail", "fail", nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdHighContrast, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.interface", "high-contrast", tc.caseHighContrast)
+			defer cancel()
+			cmdScreenReader, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.applications", "screen-reader-enabled", tc.caseScreenReader)
+			defer cancel()
+			cmdLargeText, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.interface", "text-scaling-factor", tc.caseLargeText)
+			defer cancel()
+
+			m := newTestMetrics(t, WithHighContrastCommand(cmdHighContrast),
+				WithScreenReaderCommand(cmdScreenReader), WithLargeTextCommand(cmdLargeText))
+			got := m.getAccessibility()
+
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestGetHwCap(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
 		name string
 
-		want []gpuInfo
+		want string
 	}{
-		{"one gpu", []gpuInfo{{"8086", "0126"}}},
-		{"multiple gpus", []gpuInfo{{"8086", "0126"}, {"8086", "0127"}}},
-		{"no revision number", []gpuInfo{{"8086", "0126"}}},
-		{"no gpu", nil},
-		{"hexa numbers", []gpuInfo{{"8b86", "a126"}}},
-		{"empty", nil},
-		{"malformed gpu line", nil},
-		{"garbage", nil},
-		{"fail", nil},
+		{"regular", "x86-64-v3"},
+		{"no hwcap", "-"},
+		{"empty", ""},
+		{"fail", ""},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -391,38 +1741,30 @@ func TestGetGPU(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			cmd, cancel := newMockShortCmd(t, "lspci", "-n", tc.name)
+			hwCapCmd, cancel := newMockShortCmd(t, "/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2", "--help", tc.name)
 			defer cancel()
 
-			m := newTestMetrics(t, WithGPUInfoCommand(cmd))
-			info := m.getGPU()
+			m := newTestMetrics(t, WithHwCapCommand(hwCapCmd))
+			hwCap := m.getHwCap()
 
-			a.Equal(info, tc.want)
+			a.Equal(hwCap, tc.want)
 		})
 	}
 }
 
-func TestGetScreens(t *testing.T) {
+func TestGetFailedUnitsCount(t *testing.T) {
 	t.Parallel()
 
+	noFailure := 0
+	severalFailures := 3
+
 	testCases := []struct {
 		name string
 
-		want []screenInfo
+		want *int
 	}{
-		{"one screen", []screenInfo{{"277mmx156mm", "1366x768", "60.02"}}},
-		{"multiple screens", []screenInfo{{"277mmx156mm", "1366x768", "60.02"}, {"510mmx287mm", "1920x1080", "60.00"}}},
-		{"no screen", nil},
-		{"chosen resolution not first", []screenInfo{{"510mmx287mm", "1600x1200", "60.00"}}},
-		{"no specified screen size", nil},
-		{"no chosen resolution", nil},
-		{"chosen resolution not preferred", []screenInfo{{"510mmx287mm", "1920x1080", "60.00"}}},
-		{"multiple frequencies for resolution", []screenInfo{{"510mmx287mm", "1920x1080", "60.00"}}},
-		{"multiple frequencies select other resolution", []screenInfo{{"510mmx287mm", "1920x1080", "50.00"}}},
-		{"multiple frequencies select other resolution on non preferred", []screenInfo{{"510mmx287mm", "1920x1080", "50.00"}}},
-		{"empty", nil},
-		{"malformed screen line", nil},
-		{"garbage", nil},
+		{"no failure", &noFailure},
+		{"several failures", &severalFailures},
 		{"fail", nil},
 	}
 	for _, tc := range testCases {
@@ -431,32 +1773,33 @@ func TestGetScreens(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			cmd, cancel := newMockShortCmd(t, "xrandr", tc.name)
+			cmd, cancel := newMockShortCmd(t, "systemctl", "--failed", "--no-legend", tc.name)
 			defer cancel()
 
-			m := newTestMetrics(t, WithScreenInfoCommand(cmd))
-			info := m.getScreens()
+			m := newTestMetrics(t, WithFailedUnitsCommand(cmd))
+			got := m.getFailedUnitsCount()
 
-			a.Equal(info, tc.want)
+			a.Equal(got, tc.want)
 		})
 	}
 }
 
-func TestGetPartitions(t *testing.T) {
+func TestGetBootEntryCount(t *testing.T) {
 	t.Parallel()
 
+	none := 0
+	single := 1
+	dual := 2
+
 	testCases := []struct {
 		name string
 
-		want []float64
+		want *int
 	}{
-		{"one partition", []float64{159.4}},
-		{"multiple partitions", []float64{159.4, 309.7}},
-		{"no partitions", nil},
-		{"filters loop devices", []float64{159.4}},
+		{"regular", &single},
+		{"dual boot", &dual},
+		{"firmware only", &none},
 		{"empty", nil},
-		{"malformed partition line string", nil},
-		{"malformed partition line one field", nil},
 		{"garbage", nil},
 		{"fail", nil},
 	}
@@ -466,28 +1809,34 @@ func TestGetPartitions(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			cmd, cancel := newMockShortCmd(t, "df", tc.name)
+			cmd, cancel := newMockShortCmd(t, "efibootmgr", "-v", tc.name)
 			defer cancel()
 
-			m := newTestMetrics(t, WithSpaceInfoCommand(cmd))
-			info := m.getPartitions()
+			m := newTestMetrics(t, WithBootEntriesCommand(cmd))
+			got := m.getBootEntryCount()
 
-			a.Equal(info, tc.want)
+			a.Equal(got, tc.want)
 		})
 	}
 }
 
-func TestGetArch(t *testing.T) {
+func TestHasWWAN(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		name string
+		name    string
+		root    string
+		caseCmd string
 
-		want string
+		want       bool
+		wantLogged bool
 	}{
-		{"regular", "amd64"},
-		{"empty", ""},
-		{"fail", ""},
+		{"wwan interface", "testdata/good", "no modem", true, false},
+		{"modem manager modem", "testdata/none", "one modem", true, false},
+		{"no modem", "testdata/none", "no modem", false, false},
+		{"empty", "testdata/none", "empty", false, false},
+		{"garbage", "testdata/none", "garbage", false, false},
+		{"fail", "testdata/none", "fail", false, true},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -495,29 +1844,38 @@ func TestGetArch(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			cmd, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", tc.name)
+			cmd, cancel := newMockShortCmd(t, "mmcli", "-L", tc.caseCmd)
 			defer cancel()
 
-			m := newTestMetrics(t, WithArchitectureCommand(cmd))
-			arch := m.getArch()
+			logged := false
+			logger := func(format string, args ...interface{}) { logged = true }
+			m := newTestMetrics(t, WithRootAt(tc.root), WithWWANInfoCommand(cmd), WithLogger(logger))
+			got := m.hasWWAN()
 
-			a.Equal(arch, tc.want)
+			a.Equal(got, tc.want)
+			a.Equal(logged, tc.wantLogged)
 		})
 	}
 }
 
-func TestGetHwCap(t *testing.T) {
+func TestGetNPU(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		name string
+		name    string
+		root    string
+		caseCmd string
 
-		want string
+		wantNPU    bool
+		wantVendor string
 	}{
-		{"regular", "x86-64-v3"},
-		{"no hwcap", "-"},
-		{"empty", ""},
-		{"fail", ""},
+		{"intel npu in accel subsystem", "testdata/specials/npu/intel", "one gpu", true, "8086"},
+		{"intel npu pci device", "testdata/none", "intel npu", true, "8086"},
+		{"amd npu pci device", "testdata/none", "amd npu", true, "1022"},
+		{"no npu", "testdata/none", "one gpu", false, ""},
+		{"empty", "testdata/none", "empty", false, ""},
+		{"garbage", "testdata/none", "garbage", false, ""},
+		{"fail", "testdata/none", "fail", false, ""},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -525,13 +1883,14 @@ func TestGetHwCap(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			hwCapCmd, cancel := newMockShortCmd(t, "/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2", "--help", tc.name)
+			cmd, cancel := newMockShortCmd(t, "lspci", "-n", tc.caseCmd)
 			defer cancel()
 
-			m := newTestMetrics(t, WithHwCapCommand(hwCapCmd))
-			hwCap := m.getHwCap()
+			m := newTestMetrics(t, WithRootAt(tc.root), WithNPUInfoCommand(cmd))
+			gotNPU, gotVendor := m.getNPU()
 
-			a.Equal(hwCap, tc.want)
+			a.Equal(gotNPU, tc.wantNPU)
+			a.Equal(gotVendor, tc.wantVendor)
 		})
 	}
 }
@@ -600,6 +1959,130 @@ func TestGetLanguage(t *testing.T) {
 
 }
 
+func TestWithConcurrency(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		n    int
+
+		want    int
+		wantErr bool
+	}{
+		{"sequential", 1, 1, false},
+		{"multiple collectors", 4, 4, false},
+		{"zero", 0, 0, true},
+		{"negative", -1, 0, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, err := New(WithConcurrency(tc.n))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if tc.wantErr {
+				return
+			}
+			a.Equal(m.maxConcurrency, tc.want)
+		})
+	}
+}
+
+func TestRunConcurrently(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		maxConcurrency int
+		collectors     int
+	}{
+		{"sequential", 1, 5},
+		{"fewer collectors than allowed", 8, 3},
+		{"more collectors than allowed", 2, 10},
+		{"unset concurrency", 0, 3},
+		{"no collectors", 4, 0},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := Metrics{maxConcurrency: tc.maxConcurrency}
+			want := tc.maxConcurrency
+			if want < 1 {
+				want = 1
+			}
+
+			var mu sync.Mutex
+			var running, maxRunning int
+			ran := make([]bool, tc.collectors)
+			var collectors []func()
+			for i := 0; i < tc.collectors; i++ {
+				i := i
+				collectors = append(collectors, func() {
+					mu.Lock()
+					running++
+					if running > maxRunning {
+						maxRunning = running
+					}
+					mu.Unlock()
+					time.Sleep(5 * time.Millisecond)
+					ran[i] = true
+					mu.Lock()
+					running--
+					mu.Unlock()
+				})
+			}
+
+			m.runConcurrently(collectors...)
+
+			for i, r := range ran {
+				if !r {
+					t.Errorf("collector %d didn't run", i)
+				}
+			}
+			if maxRunning > want {
+				t.Errorf("expected at most %d collectors running at the same time, got %d", want, maxRunning)
+			}
+			a.Equal(running, 0)
+		})
+	}
+}
+
+func TestWithBaseURL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		url  string
+
+		wantErr bool
+	}{
+		{"custom server", "https://metrics.example.com", false},
+		{"default server", "", false},
+		{"invalid URL", "http://a b.com/", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, err := New(WithBaseURL(tc.url))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if tc.wantErr {
+				return
+			}
+			a.Equal(m.BaseURL(), tc.url)
+		})
+	}
+}
+
 func newTestMetrics(t *testing.T, fixtures ...func(m *Metrics) error) Metrics {
 	t.Helper()
 	m, err := New(fixtures...)
@@ -3,14 +3,20 @@ package metrics
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -20,19 +26,88 @@ import (
 const (
 	installerLogsPath = "var/log/installer/telemetry"
 	upgradeLogsPath   = "var/log/upgrade/telemetry"
+	deploymentTagPath = "etc/ubuntu-report/tag"
+
+	// maxDeploymentTagLength is the maximum number of characters accepted for a deployment tag
+	maxDeploymentTagLength = 64
 )
 
 // Metrics collect system, upgrade and installer data
 type Metrics struct {
-	root          string
-	screenInfoCmd *exec.Cmd
-	spaceInfoCmd  *exec.Cmd
-	cpuInfoCmd    *exec.Cmd
-	gpuInfoCmd    *exec.Cmd
-	archCmd       *exec.Cmd
-	libc6Cmd      *exec.Cmd
-	hwCapCmd      *exec.Cmd
-	getenv        GetenvFn
+	root            string
+	memInfoFile     string
+	screenInfoCmd   *exec.Cmd
+	spaceInfoCmd    *exec.Cmd
+	fsTypeCmd       *exec.Cmd
+	cpuInfoCmd      *exec.Cmd
+	gpuInfoCmd      *exec.Cmd
+	gpuDriverCmd    *exec.Cmd
+	archCmd         *exec.Cmd
+	libc6Cmd        *exec.Cmd
+	hwCapCmd        *exec.Cmd
+	failedUnitsCmd  *exec.Cmd
+	wwanInfoCmd     *exec.Cmd
+	renderInfoCmd   *exec.Cmd
+	npuInfoCmd      *exec.Cmd
+	kernelCmd       *exec.Cmd
+	uxProfileCmd    *exec.Cmd
+	virtCmd         *exec.Cmd
+	bootEntriesCmd  *exec.Cmd
+	gnomeShellCmd   *exec.Cmd
+	plasmaShellCmd  *exec.Cmd
+	highContrastCmd *exec.Cmd
+	screenReaderCmd *exec.Cmd
+	largeTextCmd    *exec.Cmd
+	browserCmd      *exec.Cmd
+	terminalCmd     *exec.Cmd
+	getenv          GetenvFn
+
+	// maxConcurrency is the maximum number of collectors running at the same time
+	maxConcurrency int
+
+	// commandTimeout is the maximum time each external command can run, 0 meaning no limit
+	commandTimeout time.Duration
+	// ctx is the collection context external commands are bound to, on top of commandTimeout
+	ctx context.Context
+
+	// baseURL is the server reports are sent to. Empty means the default server.
+	baseURL string
+
+	// collectionTime adds the collection duration bucket to the report
+	collectionTime bool
+	// fastCollection and slowCollection are the bucket limits of the collection duration
+	fastCollection time.Duration
+	slowCollection time.Duration
+
+	// coarseLanguage only reports the language, without its region
+	coarseLanguage bool
+
+	// partitionMounts reports partitions mount point, which can hint at user names
+	partitionMounts bool
+
+	// installID is reported as is, to deduplicate reports from the same install
+	installID string
+
+	// logger is called with non fatal collection errors, on top of the debug logs
+	logger func(format string, args ...interface{})
+
+	// snakeCase names report fields in snake_case instead of PascalCase when marshaling
+	snakeCase bool
+
+	// extraFields are caller supplied fields added to the top level of the report
+	extraFields map[string]interface{}
+
+	// indent pretty prints the report written by CollectTo when set
+	indent string
+
+	// timings records external command collectors duration when set, shared by all copies of the metrics element
+	timings *collectorTimings
+}
+
+// collectorTimings is the duration of each external command collector during the last collection
+type collectorTimings struct {
+	mu sync.Mutex
+	d  map[string]time.Duration
 }
 
 // New return a new metrics element with optional testing functions
@@ -41,14 +116,33 @@ func New(options ...func(*Metrics) error) (Metrics, error) {
 	hwCapCmd := getHwCapCmd(options)
 
 	m := Metrics{
-		root:          "/",
-		screenInfoCmd: setCommand("xrandr"),
-		spaceInfoCmd:  setCommand("df"),
-		cpuInfoCmd:    setCommand("lscpu", "-J"),
-		gpuInfoCmd:    setCommand("lspci", "-n"),
-		archCmd:       setCommand("dpkg", "--print-architecture"),
-		hwCapCmd:      hwCapCmd,
-		getenv:        os.Getenv,
+		root:            "/",
+		screenInfoCmd:   setCommand("xrandr"),
+		spaceInfoCmd:    setCommand("df"),
+		fsTypeCmd:       setCommand("df", "--output=source,fstype"),
+		cpuInfoCmd:      setCommand("lscpu", "-J"),
+		gpuInfoCmd:      setCommand("lspci", "-n"),
+		gpuDriverCmd:    setCommand("lspci", "-nk"),
+		archCmd:         setCommand("dpkg", "--print-architecture"),
+		hwCapCmd:        hwCapCmd,
+		failedUnitsCmd:  setCommand("systemctl", "--failed", "--no-legend"),
+		wwanInfoCmd:     setCommand("mmcli", "-L"),
+		renderInfoCmd:   setCommand("eglinfo", "-B"),
+		npuInfoCmd:      setCommand("lspci", "-n"),
+		kernelCmd:       setCommand("uname", "-r"),
+		uxProfileCmd:    setCommand("gsettings", "list-recursively", "org.gnome.desktop.interface"),
+		virtCmd:         setCommand("systemd-detect-virt"),
+		bootEntriesCmd:  setCommand("efibootmgr", "-v"),
+		gnomeShellCmd:   setCommand("gnome-shell", "--version"),
+		plasmaShellCmd:  setCommand("plasmashell", "--version"),
+		highContrastCmd: setCommand("gsettings", "get", "org.gnome.desktop.a11y.interface", "high-contrast"),
+		screenReaderCmd: setCommand("gsettings", "get", "org.gnome.desktop.a11y.applications", "screen-reader-enabled"),
+		largeTextCmd:    setCommand("gsettings", "get", "org.gnome.desktop.interface", "text-scaling-factor"),
+		browserCmd:      setCommand("xdg-settings", "get", "default-web-browser"),
+		terminalCmd:     setCommand("update-alternatives", "--query", "x-terminal-emulator"),
+		getenv:          os.Getenv,
+		maxConcurrency:  runtime.NumCPU(),
+		commandTimeout:  defaultCommandTimeout,
 	}
 	m.cpuInfoCmd.Env = []string{"LANG=C"}
 
@@ -61,7 +155,16 @@ func New(options ...func(*Metrics) error) (Metrics, error) {
 	return m, nil
 }
 
-// GetIDS returns distro and version information
+// BaseURL returns the server reports are sent to, or an empty string for the default server
+func (m Metrics) BaseURL() string {
+	return m.baseURL
+}
+
+// defaultDistro is used when os-release sets an empty ID
+const defaultDistro = "ubuntu"
+
+// GetIDS returns distro and version information.
+// Distro is the ID from os-release, so that derivatives are reported under their own ID.
 func (m Metrics) GetIDS() (string, string, error) {
 	p := filepath.Join(m.root, "etc", "os-release")
 	f, err := os.Open(p)
@@ -72,19 +175,26 @@ func (m Metrics) GetIDS() (string, string, error) {
 
 	scanner := bufio.NewScanner(f)
 	dRe := regexp.MustCompile(`^ID=(.*)$`)
-	vRe := regexp.MustCompile(`^VERSION_ID="(.*)"$`)
+	vRe := regexp.MustCompile(osReleaseVersionIDRe)
 	var distro, version string
+	var hasDistro bool
 	for scanner.Scan() {
 		v := dRe.FindStringSubmatch(scanner.Text())
 		if v != nil {
-			distro = strings.TrimSpace(v[1])
+			distro = unquoteOSRelease(v[1])
+			hasDistro = true
 		}
 		v = vRe.FindStringSubmatch(scanner.Text())
 		if v != nil {
-			version = strings.TrimSpace(v[1])
+			version = unquoteOSRelease(v[1])
 		}
 	}
 
+	if hasDistro && distro == "" {
+		m.infof("empty distribution ID in %s, defaulting to %s", p, defaultDistro)
+		distro = defaultDistro
+	}
+
 	if err := scanner.Err(); (distro == "" || version == "") && err != nil {
 		return "", "", errors.Wrap(err, "error while scanning")
 	}
@@ -96,6 +206,19 @@ func (m Metrics) GetIDS() (string, string, error) {
 	return distro, version, nil
 }
 
+// osReleaseVersionIDRe matches the VERSION_ID line of os-release, quoted or not.
+// Its value is used for both the report Version and the upload URL, so they have to agree.
+const osReleaseVersionIDRe = `^VERSION_ID=(.*)$`
+
+// unquoteOSRelease returns an os-release value without its optional quotes
+func unquoteOSRelease(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		v = v[1 : len(v)-1]
+	}
+	return strings.TrimSpace(v)
+}
+
 func setCommand(cmds ...string) *exec.Cmd {
 	if len(cmds) == 1 {
 		return exec.Command(cmds[0])
@@ -105,63 +228,365 @@ func setCommand(cmds ...string) *exec.Cmd {
 
 // Collect system, installer and update info, returning a json formatted byte
 func (m Metrics) Collect() ([]byte, error) {
+	return m.CollectWithContext(context.Background())
+}
+
+// CollectWithContext is like Collect, but kills external commands still running once ctx is done.
+// An error is returned if ctx is done before collection ends.
+func (m Metrics) CollectWithContext(ctx context.Context) ([]byte, error) {
+	var b bytes.Buffer
+	if err := m.CollectToWithContext(ctx, &b); err != nil {
+		return nil, err
+	}
+	// the encoder terminates each value with a newline
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// CollectTo collects system, installer and update info and streams them as json to w,
+// followed by a newline, without building the whole report in memory first.
+func (m Metrics) CollectTo(w io.Writer) error {
+	return m.CollectToWithContext(context.Background(), w)
+}
+
+// CollectToWithContext is like CollectTo, but kills external commands still running once ctx is done.
+// Nothing is written if ctx is done before collection ends.
+func (m Metrics) CollectToWithContext(ctx context.Context, w io.Writer) error {
+	r := m.withContext(ctx).CollectReport()
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "metrics collection was interrupted")
+	}
+	return m.encodeReport(w, r)
+}
+
+// MarshalReport returns r as json, formatted like Collect does: field naming, extra fields and
+// indentation set by options apply.
+func (m Metrics) MarshalReport(r Report) ([]byte, error) {
+	var b bytes.Buffer
+	if err := m.encodeReport(&b, r); err != nil {
+		return nil, err
+	}
+	// the encoder terminates each value with a newline
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// encodeReport writes r as json to w, followed by a newline
+func (m Metrics) encodeReport(w io.Writer, r Report) error {
+	var v interface{} = r
+	if m.snakeCase {
+		v = toSnakeCase(reflect.ValueOf(r))
+	}
+	if len(m.extraFields) > 0 {
+		b, err := mergeExtraFields(v, m.extraFields)
+		if err != nil {
+			return err
+		}
+		v = json.RawMessage(b)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", m.indent)
+	return errors.Wrapf(enc.Encode(v), "can't be converted to a valid json")
+}
+
+// mergeExtraFields returns the json object v, followed by extra fields sorted by name
+func mergeExtraFields(v interface{}, extra map[string]interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't be converted to a valid json")
+	}
+	e, err := json.Marshal(extra)
+	if err != nil {
+		return nil, errors.Wrapf(err, "extra fields can't be converted to a valid json")
+	}
+	// reports always have a version, so both objects have fields
+	return append(append(b[:len(b)-1], ','), e[1:]...), nil
+}
+
+// withContext returns a copy of m with all external commands bound to ctx
+func (m Metrics) withContext(ctx context.Context) Metrics {
+	if ctx.Done() == nil {
+		// can never be cancelled
+		return m
+	}
+	m.ctx = ctx
+	for _, c := range []**exec.Cmd{&m.screenInfoCmd, &m.spaceInfoCmd, &m.fsTypeCmd, &m.cpuInfoCmd, &m.gpuInfoCmd, &m.gpuDriverCmd,
+		&m.archCmd, &m.libc6Cmd, &m.hwCapCmd, &m.failedUnitsCmd, &m.wwanInfoCmd, &m.renderInfoCmd,
+		&m.npuInfoCmd, &m.kernelCmd, &m.uxProfileCmd, &m.virtCmd, &m.bootEntriesCmd,
+		&m.gnomeShellCmd, &m.plasmaShellCmd, &m.highContrastCmd, &m.screenReaderCmd, &m.largeTextCmd,
+		&m.browserCmd, &m.terminalCmd} {
+		if *c == nil {
+			continue
+		}
+		cmd := exec.CommandContext(ctx, (*c).Path, (*c).Args[1:]...)
+		cmd.Env = (*c).Env
+		cmd.Dir = (*c).Dir
+		*c = cmd
+	}
+	return m
+}
+
+// CollectReport gathers system, installer and update info
+func (m Metrics) CollectReport() Report {
 	log.Debugf("Collecting metrics on system with root set to %s", m.root)
-	r := metrics{}
+	start := time.Now()
+	r := Report{ReportVersion: ReportVersion}
+	if m.timings != nil {
+		m.timings.mu.Lock()
+		m.timings.d = make(map[string]time.Duration)
+		m.timings.mu.Unlock()
+	}
 
-	r.Version = m.getVersion()
+	// external commands are independent from each other, each collector setting its own report fields
+	var cmds []func()
+	for _, c := range m.commandCollectors() {
+		c := c
+		cmds = append(cmds, m.timed(c.name, func() { c.collect(&r) }))
+	}
+	m.runConcurrently(cmds...)
 
-	if vendor, product, family, dcd := m.getOEM(); vendor != "" || product != "" {
-		r.OEM = &struct {
-			Vendor  string
-			Product string
-			Family  string
-			DCD     string `json:",omitempty"`
-		}{vendor, product, family, dcd}
+	for _, c := range m.fileCollectors() {
+		c.collect(&r)
 	}
-	if vendor, version := m.getBIOS(); vendor != "" || version != "" {
-		r.BIOS = &struct {
-			Vendor  string
-			Version string
-		}{vendor, version}
+
+	r.InstallID = m.installID
+
+	if m.collectionTime {
+		r.CollectionTimeBucket = m.collectionTimeBucket(time.Since(start))
 	}
 
-	cpu := m.getCPU()
-	if cpu != (cpuInfo{}) {
-		r.CPU = &cpu
-	} else {
-		r.CPU = nil
+	return r
+}
+
+// collector sets the report fields it is named after
+type collector struct {
+	name string
+	// cmd is the main external command run by the collector, if any
+	cmd     *exec.Cmd
+	collect func(r *Report)
+}
+
+// commandCollectors returns the collectors running external commands, which can run concurrently
+func (m Metrics) commandCollectors() []collector {
+	desktopCmd, _ := m.desktopShellCmd()
+	return []collector{
+		{"CPU", m.cpuInfoCmd, func(r *Report) {
+			if cpu := m.getCPU(); cpu != (CPUInfo{}) {
+				r.CPU = &cpu
+				r.CPUMaxFreq = cpu.maxFreq
+			}
+		}},
+		{"Arch", m.archCmd, func(r *Report) { r.Arch = m.getArch() }},
+		{"Kernel", m.kernelCmd, func(r *Report) { r.Kernel = m.getKernel() }},
+		{"Virtualization", m.virtCmd, func(r *Report) { r.Virtualization = m.getVirtualization() }},
+		// kernel and render drivers are attached to GPUs
+		{"GPU", m.gpuInfoCmd, func(r *Report) {
+			var offload []GPUInfo
+			r.GPU, offload = m.getGPU()
+			m.addGPUDrivers(r.GPU)
+			m.addRenderDrivers(r.GPU)
+			m.addVRAM(r.GPU)
+			r.GPUCount = len(r.GPU)
+			r.HybridGraphics = hasHybridGraphics(r.GPU, offload)
+		}},
+		{"Partitions", m.spaceInfoCmd, func(r *Report) {
+			var mounts []string
+			r.Partitions, r.PartitionTypes, r.PartitionFSTypes, mounts = m.getPartitions()
+			if m.partitionMounts {
+				r.PartitionMounts = mounts
+			}
+		}},
+		{"BootEntryCount", m.bootEntriesCmd, func(r *Report) { r.BootEntryCount = m.getBootEntryCount() }},
+		{"Screens", m.screenInfoCmd, func(r *Report) { r.Screens = m.getScreens() }},
+		{"HwCap", m.hwCapCmd, func(r *Report) { r.HwCap = m.getHwCap() }},
+		{"FailedUnitsCount", m.failedUnitsCmd, func(r *Report) { r.FailedUnitsCount = m.getFailedUnitsCount() }},
+		{"HasWWAN", m.wwanInfoCmd, func(r *Report) {
+			w := m.hasWWAN()
+			r.HasWWAN = &w
+		}},
+		{"HasNPU", m.npuInfoCmd, func(r *Report) {
+			hasNPU, npuVendor := m.getNPU()
+			r.HasNPU = &hasNPU
+			r.NPUVendor = npuVendor
+		}},
+		{"UXProfile", m.uxProfileCmd, func(r *Report) { r.UXProfile = m.getUXProfile() }},
+		// all accessibility settings are read with gsettings
+		{"Accessibility", m.highContrastCmd, func(r *Report) { r.Accessibility = m.getAccessibility() }},
+		{"DesktopVersion", desktopCmd, func(r *Report) { r.DesktopVersion = m.getDesktopVersion() }},
+		{"DefaultBrowser", m.browserCmd, func(r *Report) { r.DefaultBrowser = m.getDefaultBrowser() }},
+		{"DefaultTerminal", m.terminalCmd, func(r *Report) { r.DefaultTerminal = m.getDefaultTerminal() }},
 	}
-	r.Arch = m.getArch()
-	r.GPU = m.getGPU()
-	r.RAM = m.getRAM()
-	r.Disks = m.getDisks()
-	r.Partitions = m.getPartitions()
-	r.Screens = m.getScreens()
-	r.HwCap = m.getHwCap()
+}
 
-	a := m.getAutologin()
-	r.Autologin = &a
-	l := m.getLivePatch()
-	r.LivePatch = &l
+// fileCollectors returns the collectors only reading files and the environment
+func (m Metrics) fileCollectors() []collector {
+	return []collector{
+		{"Version", nil, func(r *Report) { r.Version = m.getVersion() }},
+		{"OEM", nil, func(r *Report) {
+			if vendor, product, family, version, dcd := m.getOEM(); vendor != "" || product != "" {
+				r.OEM = &struct {
+					Vendor  string `snake:"vendor"`
+					Product string `snake:"product"`
+					Family  string `snake:"family"`
+					Version string `json:",omitempty" snake:"version"`
+					DCD     string `json:",omitempty" snake:"dcd"`
+				}{vendor, product, family, version, dcd}
+			}
+		}},
+		{"OEMInstall", nil, func(r *Report) { r.OEMInstall = m.isOEMInstall() }},
+		{"Cloud", nil, func(r *Report) { r.Cloud = m.getCloud() }},
+		{"BIOS", nil, func(r *Report) {
+			if vendor, version := m.getBIOS(); vendor != "" || version != "" {
+				r.BIOS = &struct {
+					Vendor  string `snake:"vendor"`
+					Version string `snake:"version"`
+				}{vendor, version}
+			}
+		}},
+		{"Firmware", nil, func(r *Report) {
+			if version, date := m.getFirmware(); version != "" || date != "" {
+				r.Firmware = &struct {
+					Version string `json:",omitempty" snake:"version"`
+					Date    string `json:",omitempty" snake:"date"`
+				}{version, date}
+			}
+		}},
+		{"Init", nil, func(r *Report) { r.Init = m.getInit() }},
+		{"CgroupVersion", nil, func(r *Report) { r.CgroupVersion = m.getCgroupVersion() }},
+		{"CPUVulnerabilities", nil, func(r *Report) { r.CPUVulnerabilities, r.MicrocodeLoaded = m.getCPUVulnerabilities() }},
+		{"RAM", nil, func(r *Report) { r.RAM = m.getRAM() }},
+		{"Mem", nil, func(r *Report) { r.Mem = m.getMem() }},
+		{"Swap", nil, func(r *Report) { r.Swap = m.getSwap() }},
+		{"Disks", nil, func(r *Report) { r.Disks = m.getDisks() }},
+		{"ImmutableRoot", nil, func(r *Report) { r.ImmutableRoot = m.isImmutableRoot() }},
+		{"Encrypted", nil, func(r *Report) { r.Encrypted = m.isEncrypted() }},
+		{"TPMDiskUnlock", nil, func(r *Report) { r.TPMDiskUnlock = m.hasTPMDiskUnlock() }},
+		{"SecureBoot", nil, func(r *Report) { r.SecureBoot = m.isSecureBoot() }},
+		{"Bootloader", nil, func(r *Report) { r.Bootloader = m.getBootloader() }},
+		{"Battery", nil, func(r *Report) { r.HasBattery, r.FormFactor = m.getBattery() }},
+		{"Autologin", nil, func(r *Report) {
+			a := m.getAutologin()
+			r.Autologin = &a
+		}},
+		{"LivePatch", nil, func(r *Report) {
+			l := m.getLivePatch()
+			r.LivePatch = &l
+		}},
+		{"SnapCount", nil, func(r *Report) { r.SnapCount = m.getSnapCount() }},
+		{"PackageCount", nil, func(r *Report) { r.PackageCount = m.getPackageCount() }},
+		{"UptimeBucket", nil, func(r *Report) { r.UptimeBucket = m.getUptimeBucket() }},
+		{"Network", nil, func(r *Report) { r.Network = m.getNetwork() }},
+		{"Session", nil, func(r *Report) {
+			de := m.getenv("XDG_CURRENT_DESKTOP")
+			sessionName := m.getenv("XDG_SESSION_DESKTOP")
+			sessionType := m.getenv("XDG_SESSION_TYPE")
+			if de != "" || sessionName != "" || sessionType != "" {
+				r.Session = &struct {
+					DE   string `snake:"de"`
+					Name string `snake:"name"`
+					Type string `snake:"type"`
+				}{de, sessionName, sessionType}
+			}
+			r.SessionType = normalizeSessionType(sessionType)
+		}},
+		{"Language", nil, func(r *Report) {
+			r.Language = m.getLanguage()
+			if m.coarseLanguage {
+				r.Language = coarseLanguage(r.Language)
+			}
+		}},
+		{"KeyboardLayout", nil, func(r *Report) { r.KeyboardLayout = m.getKeyboardLayout() }},
+		{"Timezone", nil, func(r *Report) { r.Timezone = m.getTimeZone() }},
+		{"CustomHostname", nil, func(r *Report) { r.CustomHostname = m.hasCustomHostname() }},
+		{"DeploymentTag", nil, func(r *Report) { r.DeploymentTag = m.getDeploymentTag() }},
+		{"AptSource", nil, func(r *Report) { r.AptSource = m.getAptSource() }},
+		{"Install", nil, func(r *Report) { r.Install = m.installerInfo() }},
+		{"Upgrade", nil, func(r *Report) { r.Upgrade = m.upgradeInfo() }},
+	}
+}
 
-	de := m.getenv("XDG_CURRENT_DESKTOP")
-	sessionName := m.getenv("XDG_SESSION_DESKTOP")
-	sessionType := m.getenv("XDG_SESSION_TYPE")
-	if de != "" || sessionName != "" || sessionType != "" {
-		r.Session = &struct {
-			DE   string
-			Name string
-			Type string
-		}{de, sessionName, sessionType}
+// timed returns collect, recording its duration under name if timings are enabled
+func (m Metrics) timed(name string, collect func()) func() {
+	if m.timings == nil {
+		return collect
+	}
+	return func() {
+		start := time.Now()
+		collect()
+		m.timings.mu.Lock()
+		defer m.timings.mu.Unlock()
+		m.timings.d[name] = time.Since(start)
 	}
-	r.Language = m.getLanguage()
-	r.Timezone = m.getTimeZone()
+}
 
-	r.Install = m.installerInfo()
-	r.Upgrade = m.upgradeInfo()
+// Timings returns how long each external command collector took during the last collection, keyed by name,
+// like "CPU" or "Screens". It's nil unless timings are enabled, and is never part of the report.
+func (m Metrics) Timings() map[string]time.Duration {
+	if m.timings == nil {
+		return nil
+	}
+	m.timings.mu.Lock()
+	defer m.timings.mu.Unlock()
+	d := make(map[string]time.Duration, len(m.timings.d))
+	for k, v := range m.timings.d {
+		d[k] = v
+	}
+	return d
+}
+
+// commandWithTimeout returns a copy of cmd killed once the command timeout expires, or when the collection
+// context is done. cancel must be called once the command has run.
+func (m Metrics) commandWithTimeout(cmd *exec.Cmd) (c *exec.Cmd, cancel context.CancelFunc) {
+	if m.commandTimeout <= 0 {
+		return cmd, func() {}
+	}
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel = context.WithTimeout(ctx, m.commandTimeout)
+	c = exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+	c.Env = cmd.Env
+	c.Dir = cmd.Dir
+	return c, cancel
+}
+
+// infof logs non fatal collection errors, and forwards them to the logger set by options, if any
+func (m Metrics) infof(format string, args ...interface{}) {
+	log.Infof(format, args...)
+	if m.logger != nil {
+		m.logger(format, args...)
+	}
+}
+
+// runConcurrently runs all collectors, with at most maxConcurrency of them at the same time,
+// and waits for them to finish.
+func (m Metrics) runConcurrently(collectors ...func()) {
+	n := m.maxConcurrency
+	if n < 1 {
+		n = 1
+	}
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for _, c := range collectors {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(c func()) {
+			defer func() { <-sem }()
+			defer wg.Done()
+			c()
+		}(c)
+	}
+	wg.Wait()
+}
 
-	d, err := json.Marshal(r)
-	return d, errors.Wrapf(err, "can't be converted to a valid json")
+// collectionTimeBucket returns if collection duration d was "fast", "normal" or "slow"
+func (m Metrics) collectionTimeBucket(d time.Duration) string {
+	switch {
+	case d < m.fastCollection:
+		return "fast"
+	case d < m.slowCollection:
+		return "normal"
+	}
+	return "slow"
 }
 
 func (m Metrics) getLanguage() string {
@@ -175,6 +600,26 @@ func (m Metrics) getLanguage() string {
 	return strings.Split(lang, ".")[0]
 }
 
+// normalizeSessionType returns "x11", "wayland" or "tty" for the session type t, or "unknown" for any other value
+func normalizeSessionType(t string) string {
+	if t == "" {
+		return ""
+	}
+	switch t = strings.ToLower(t); t {
+	case "x11", "wayland", "tty":
+		return t
+	}
+	return "unknown"
+}
+
+// coarseLanguage strips the region and modifier of lang, like fr_FR or sr_RS@latin
+func coarseLanguage(lang string) string {
+	if i := strings.IndexAny(lang, "_@"); i > -1 {
+		return lang[:i]
+	}
+	return lang
+}
+
 func convKBToGB(s string) (float64, error) {
 	v, err := strconv.Atoi(s)
 	if err != nil {
@@ -205,7 +650,7 @@ func getHwCapCmd(options []func(*Metrics) error) *exec.Cmd {
 	}
 
 	// Make sure we have glibc version > 2.33
-	r := runCmd(libc6Cmd)
+	r := mTemp.runCmd(libc6Cmd)
 	libc6Result, err := filterFirst(r, `^(?:Version: (.*))`, false)
 	if err != nil {
 		log.Infof("Couldn't get glibc version: "+utils.ErrFormat, err)
@@ -218,7 +663,7 @@ func getHwCapCmd(options []func(*Metrics) error) *exec.Cmd {
 
 	// find the architecture so we can directly assign hwCapCmd
 	archCmd := setCommand("dpkg", "--print-architecture")
-	r = runCmd(archCmd)
+	r = mTemp.runCmd(archCmd)
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(r)
 	arch := strings.TrimSpace(buf.String())
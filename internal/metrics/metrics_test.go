@@ -1,11 +1,17 @@
 package metrics_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ubuntu/ubuntu-report/internal/helper"
 	"github.com/ubuntu/ubuntu-report/internal/metrics"
@@ -28,7 +34,10 @@ func TestGetIDS(t *testing.T) {
 		{"missing distro", "testdata/missing-fields/ids/distro", "", "", true},
 		{"missing version", "testdata/missing-fields/ids/version", "", "", true},
 		{"missing both", "testdata/missing-fields/ids/both", "", "", true},
-		{"empty distro", "testdata/empty-fields/ids/distro", "", "", true},
+		{"derivative", "testdata/specials/ids/neon", "neon", "22.04", false},
+		{"unquoted version", "testdata/specials/ids/pop", "pop", "22.04", false},
+		{"quoted distro", "testdata/specials/ids/quoted", "zorin", "16", false},
+		{"empty distro defaults to ubuntu", "testdata/empty-fields/ids/distro", "ubuntu", "18.04", false},
 		{"empty version", "testdata/empty-fields/ids/version", "", "", true},
 		{"empty both", "testdata/empty-fields/ids/both", "", "", true},
 		{"garbage content", "testdata/garbage", "", "", true},
@@ -62,6 +71,22 @@ func TestCollect(t *testing.T) {
 		caseArchitecture string
 		caseLibc6        string
 		caseHwCap        string
+		caseFailedUnits  string
+		caseWWAN         string
+		caseRender       string
+		caseNPU          string
+		caseKernel       string
+		caseUXProfile    string
+		caseVirt         string
+		caseBootEntries  string
+		caseGPUDriver    string
+		caseGNOMEShell   string
+		caseHighContrast string
+		caseScreenReader string
+		caseLargeText    string
+		caseFSType       string
+		caseBrowser      string
+		caseTerminal     string
 		env              map[string]string
 
 		// note that only an internal json package error can make it returning an error
@@ -69,11 +94,31 @@ func TestCollect(t *testing.T) {
 	}{
 		{"regular",
 			"testdata/good", "one gpu", "regular", "one screen",
-			"one partition", "regular", "regular", "regular",
-			map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			"one partition", "regular", "regular", "regular", "several failures", "no modem", "intel iris", "intel npu", "regular", "dark scaled", "regular", "regular", "one gpu with driver", "regular", "disabled", "enabled", "enabled", "ext4 root", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "ubuntu:GNOME", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			false},
+		{"unpatched cpu",
+			"testdata/specials/cpu-vulnerabilities/unpatched", "one gpu", "regular", "one screen",
+			"one partition", "regular", "regular", "regular", "several failures", "no modem", "intel iris", "intel npu", "regular", "dark scaled", "regular", "regular", "one gpu with driver", "regular", "disabled", "enabled", "enabled", "ext4 root", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "ubuntu:GNOME", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			false},
+		{"systemd-boot",
+			"testdata/specials/bootloader/systemd-boot", "one gpu", "regular", "one screen",
+			"one partition", "regular", "regular", "regular", "several failures", "no modem", "intel iris", "intel npu", "regular", "dark scaled", "regular", "regular", "one gpu with driver", "regular", "disabled", "enabled", "enabled", "btrfs root", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "ubuntu:GNOME", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			false},
+		{"hybrid graphics",
+			"testdata/specials/gpu-hybrid", "two gpus hybrid", "regular", "one screen",
+			"one partition", "regular", "regular", "regular", "several failures", "no modem", "intel iris", "intel npu", "regular", "dark scaled", "regular", "regular", "intel nvidia gpus with driver", "regular", "disabled", "enabled", "enabled", "ext4 root", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "ubuntu:GNOME", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			false},
+		{"encrypted",
+			"testdata/specials/encryption/luks", "one gpu", "regular", "one screen",
+			"one partition", "regular", "regular", "regular", "several failures", "no modem", "intel iris", "intel npu", "regular", "dark scaled", "regular", "regular", "one gpu with driver", "regular", "disabled", "enabled", "enabled", "ext4 root", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "ubuntu:GNOME", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
 			false},
 		{"empty",
-			"testdata/none", "empty", "empty", "empty", "empty", "empty", "empty", "empty",
+			"testdata/none", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty",
 			nil,
 			false},
 	}
@@ -97,6 +142,38 @@ func TestCollect(t *testing.T) {
 			defer cancel()
 			cmdHwCap, cancel := newMockShortCmd(t, "/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2", "--help", tc.caseHwCap)
 			defer cancel()
+			cmdFailedUnits, cancel := newMockShortCmd(t, "systemctl", "--failed", "--no-legend", tc.caseFailedUnits)
+			defer cancel()
+			cmdWWAN, cancel := newMockShortCmd(t, "mmcli", "-L", tc.caseWWAN)
+			defer cancel()
+			cmdRender, cancel := newMockShortCmd(t, "eglinfo", "-B", tc.caseRender)
+			defer cancel()
+			cmdNPU, cancel := newMockShortCmd(t, "lspci", "-n", tc.caseNPU)
+			defer cancel()
+			cmdKernel, cancel := newMockShortCmd(t, "uname", "-r", tc.caseKernel)
+			defer cancel()
+			cmdUXProfile, cancel := newMockShortCmd(t, "gsettings", "list-recursively", "org.gnome.desktop.interface", tc.caseUXProfile)
+			defer cancel()
+			cmdVirt, cancel := newMockShortCmd(t, "systemd-detect-virt", tc.caseVirt)
+			defer cancel()
+			cmdBootEntries, cancel := newMockShortCmd(t, "efibootmgr", "-v", tc.caseBootEntries)
+			defer cancel()
+			cmdGPUDriver, cancel := newMockShortCmd(t, "lspci", "-nk", tc.caseGPUDriver)
+			defer cancel()
+			cmdGNOMEShell, cancel := newMockShortCmd(t, "gnome-shell", "--version", tc.caseGNOMEShell)
+			defer cancel()
+			cmdHighContrast, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.interface", "high-contrast", tc.caseHighContrast)
+			defer cancel()
+			cmdScreenReader, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.applications", "screen-reader-enabled", tc.caseScreenReader)
+			defer cancel()
+			cmdLargeText, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.interface", "text-scaling-factor", tc.caseLargeText)
+			defer cancel()
+			cmdFSType, cancel := newMockShortCmd(t, "df", "--output=source,fstype", tc.caseFSType)
+			defer cancel()
+			cmdBrowser, cancel := newMockShortCmd(t, "xdg-settings", "get", "default-web-browser", tc.caseBrowser)
+			defer cancel()
+			cmdTerminal, cancel := newMockShortCmd(t, "update-alternatives", "--query", "x-terminal-emulator", tc.caseTerminal)
+			defer cancel()
 
 			m := newTestMetrics(t, metrics.WithRootAt(tc.root),
 				metrics.WithGPUInfoCommand(cmdGPU),
@@ -106,6 +183,22 @@ func TestCollect(t *testing.T) {
 				metrics.WithArchitectureCommand(cmdArchitecture),
 				metrics.WithHwCapCommand(cmdHwCap),
 				metrics.WithLibc6Command(cmdLibc6),
+				metrics.WithFailedUnitsCommand(cmdFailedUnits),
+				metrics.WithWWANInfoCommand(cmdWWAN),
+				metrics.WithRenderInfoCommand(cmdRender),
+				metrics.WithNPUInfoCommand(cmdNPU),
+				metrics.WithKernelCommand(cmdKernel),
+				metrics.WithUXProfileCommand(cmdUXProfile),
+				metrics.WithVirtCommand(cmdVirt),
+				metrics.WithBootEntriesCommand(cmdBootEntries),
+				metrics.WithGPUDriverCommand(cmdGPUDriver),
+				metrics.WithGNOMEShellCommand(cmdGNOMEShell),
+				metrics.WithHighContrastCommand(cmdHighContrast),
+				metrics.WithScreenReaderCommand(cmdScreenReader),
+				metrics.WithLargeTextCommand(cmdLargeText),
+				metrics.WithFSTypeCommand(cmdFSType),
+				metrics.WithBrowserCommand(cmdBrowser),
+				metrics.WithTerminalCommand(cmdTerminal),
 				metrics.WithMapForEnv(tc.env))
 			got, err := m.Collect()
 
@@ -116,6 +209,702 @@ func TestCollect(t *testing.T) {
 	}
 }
 
+func TestCollectReport(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+	defer cancel()
+	cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+	defer cancel()
+	cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+	defer cancel()
+
+	m := newTestMetrics(t, metrics.WithRootAt("testdata/good"),
+		metrics.WithGPUInfoCommand(cmdGPU),
+		metrics.WithCPUInfoCommand(cmdCPU),
+		metrics.WithScreenInfoCommand(cmdScreen),
+		metrics.WithMapForEnv(nil))
+	r := m.CollectReport()
+
+	a.Equal(r.Version, "18.04")
+	if r.CPU == nil {
+		t.Fatal("we expected CPU information and got none")
+	}
+	a.Equal(r.CPU.Vendor, "Genuine")
+	a.Equal(r.GPU, []metrics.GPUInfo{{Vendor: "8086", Model: "0126"}})
+	a.Equal(len(r.Screens), 1)
+	a.Equal(r.Screens[0].Resolution, "1366x768")
+}
+
+func TestCollectionTimeBucket(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		caseCPU        string
+		collectionTime bool
+
+		want string
+	}{
+		{"fast", "regular", true, "fast"},
+		{"slow", "slow", true, "slow"},
+		{"not requested", "regular", false, ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", tc.caseCPU)
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", "one partition")
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+			defer cancel()
+
+			// only mock commands are run
+			m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil, helper.GetenvFromMap(nil))
+			if tc.collectionTime {
+				for _, o := range []func(*metrics.Metrics) error{
+					metrics.WithCollectionTime(),
+					metrics.WithCollectionTimeLimits(time.Second, 1500*time.Millisecond),
+				} {
+					if err := o(&m); err != nil {
+						t.Fatal("can't set collection time options", err)
+					}
+				}
+			}
+			r := m.CollectReport()
+
+			a.Equal(r.CollectionTimeBucket, tc.want)
+		})
+	}
+}
+
+func TestCoarseLanguage(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		lang   string
+		coarse bool
+
+		want string
+	}{
+		{"full locale", "fr_FR.UTF-8", false, "fr_FR"},
+		{"coarse locale", "fr_FR.UTF-8", true, "fr"},
+		{"coarse locale with modifier", "sr_RS@latin", true, "sr"},
+		{"coarse language only", "fr", true, "fr"},
+		{"coarse without locale", "", true, ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", "one partition")
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+			defer cancel()
+
+			// only mock commands are run
+			m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+				helper.GetenvFromMap(map[string]string{"LANG": tc.lang}))
+			if tc.coarse {
+				if err := metrics.WithCoarseLanguage()(&m); err != nil {
+					t.Fatal("can't set coarse language option", err)
+				}
+			}
+			r := m.CollectReport()
+
+			a.Equal(r.Language, tc.want)
+		})
+	}
+}
+
+func TestSessionType(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		sessionType string
+
+		want string
+	}{
+		{"x11", "x11", "x11"},
+		{"wayland", "wayland", "wayland"},
+		{"tty", "tty", "tty"},
+		{"uppercase", "Wayland", "wayland"},
+		{"unknown session type", "x12", "unknown"},
+		{"no session type", "", ""},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", "one partition")
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+			defer cancel()
+
+			// only mock commands are run
+			m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+				helper.GetenvFromMap(map[string]string{"XDG_SESSION_TYPE": tc.sessionType}))
+			r := m.CollectReport()
+
+			a.Equal(r.SessionType, tc.want)
+			if tc.sessionType != "" {
+				// the raw session type is still reported with the session
+				a.Equal(r.Session.Type, tc.sessionType)
+			}
+		})
+	}
+}
+
+func TestPartitionMounts(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		mounts bool
+
+		wantMount bool
+	}{
+		{"mount points are excluded by default", false, false},
+		{"mount points included on request", true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", "user mount")
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+			defer cancel()
+
+			// only mock commands are run
+			m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+				helper.GetenvFromMap(map[string]string{}))
+			if tc.mounts {
+				if err := metrics.WithPartitionMounts()(&m); err != nil {
+					t.Fatal("can't set partition mounts option", err)
+				}
+			}
+			b, err := m.Collect()
+			if err != nil {
+				t.Fatal("Didn't expect collect to fail", err)
+			}
+
+			a.Equal(strings.Contains(string(b), "/home/alice"), tc.wantMount)
+			a.Equal(strings.Contains(string(b), "/dev/"), false)
+			a.Equal(strings.Contains(string(b), "PartitionTypes"), true)
+		})
+	}
+}
+
+func TestInstallID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		id   string
+
+		want string
+	}{
+		{"no install id by default", "", ""},
+		{"install id included on request", "0f8fad5b-d9cb-469f-a165-70867728950e", "0f8fad5b-d9cb-469f-a165-70867728950e"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", "one partition")
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+			defer cancel()
+
+			// only mock commands are run
+			m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+				helper.GetenvFromMap(map[string]string{}))
+			if tc.id != "" {
+				if err := metrics.WithInstallID(tc.id)(&m); err != nil {
+					t.Fatal("can't set install id option", err)
+				}
+			}
+			r := m.CollectReport()
+
+			a.Equal(r.InstallID, tc.want)
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		caseScreen string
+
+		wantLogged bool
+	}{
+		{"failing command is logged", "fail", true},
+		{"successful command isn't logged", "one screen", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", tc.caseScreen)
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", "one partition")
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+			defer cancel()
+
+			// only mock commands are run
+			m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+				helper.GetenvFromMap(map[string]string{}))
+			var mu sync.Mutex
+			var logs []string
+			logger := func(format string, args ...interface{}) {
+				mu.Lock()
+				defer mu.Unlock()
+				logs = append(logs, fmt.Sprintf(format, args...))
+			}
+			if err := metrics.WithLogger(logger)(&m); err != nil {
+				t.Fatal("can't set logger option", err)
+			}
+			if _, err := m.Collect(); err != nil {
+				t.Fatal("Didn't expect collect to fail", err)
+			}
+
+			logged := false
+			for _, l := range logs {
+				if strings.HasPrefix(l, "couldn't get Screen info: ") {
+					logged = true
+				}
+			}
+			a.Equal(logged, tc.wantLogged)
+			if len(logs) == 0 {
+				t.Error("expected other collectors, like the unmocked ones, to log their errors")
+			}
+		})
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	newMetrics := func(options ...func(*metrics.Metrics) error) (metrics.Metrics, func()) {
+		cmdGPU, cancelGPU := newMockShortCmd(t, "lspci", "-n", "one gpu")
+		cmdCPU, cancelCPU := newMockShortCmd(t, "lscpu", "-J", "regular")
+		cmdScreen, cancelScreen := newMockShortCmd(t, "xrandr", "one screen")
+		cmdPartition, cancelPartition := newMockShortCmd(t, "df", "one partition")
+		cmdArchitecture, cancelArchitecture := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+		// only mock commands are run
+		m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+			helper.GetenvFromMap(map[string]string{
+				"XDG_CURRENT_DESKTOP": "ubuntu:GNOME",
+				"XDG_SESSION_DESKTOP": "ubuntu",
+				"XDG_SESSION_TYPE":    "wayland",
+				"LANG":                "fr_FR.UTF-8",
+			}))
+		for _, o := range options {
+			if err := o(&m); err != nil {
+				t.Fatal("can't set option", err)
+			}
+		}
+		return m, func() {
+			cancelGPU()
+			cancelCPU()
+			cancelScreen()
+			cancelPartition()
+			cancelArchitecture()
+		}
+	}
+
+	m, cancel := newMetrics()
+	defer cancel()
+	pascal, err := m.Collect()
+	if err != nil {
+		t.Fatal("Didn't expect collect to fail", err)
+	}
+
+	m, cancel = newMetrics(metrics.WithSnakeCase())
+	defer cancel()
+	got, err := m.Collect()
+	if err != nil {
+		t.Fatal("Didn't expect collect to fail", err)
+	}
+
+	want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata", "good", "gold", "collect-snake-case"), got, *metrics.Update)
+	a.Equal(got, want)
+
+	// only field names change
+	var pascalFields, snakeFields map[string]json.RawMessage
+	if err := json.Unmarshal(pascal, &pascalFields); err != nil {
+		t.Fatal("couldn't parse PascalCase report", err)
+	}
+	if err := json.Unmarshal(got, &snakeFields); err != nil {
+		t.Fatal("couldn't parse snake_case report", err)
+	}
+	a.Equal(len(snakeFields), len(pascalFields))
+	a.Equal(snakeFields["install"], pascalFields["Install"])
+}
+
+func TestSnakeCaseTags(t *testing.T) {
+	t.Parallel()
+
+	var checkTags func(reflect.Type)
+	checkTags = func(typ reflect.Type) {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Slice:
+			checkTags(typ.Elem())
+			return
+		case reflect.Struct:
+		default:
+			return
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			// unexported fields are never encoded
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Tag.Get("snake") == "" {
+				t.Errorf("%s.%s has no snake tag", typ, f.Name)
+			}
+			checkTags(f.Type)
+		}
+	}
+	checkTags(reflect.TypeOf(metrics.Report{}))
+}
+
+func TestExtraFields(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		fields    map[string]interface{}
+		snakeCase bool
+
+		want          map[string]interface{}
+		wantOptionErr bool
+		wantErr       bool
+	}{
+		{"no extra fields", nil, false, nil, false, false},
+		{"extra fields are merged", map[string]interface{}{"oem_campaign": "spring", "OEMBatch": 42},
+			false, map[string]interface{}{"oem_campaign": "spring", "OEMBatch": float64(42)}, false, false},
+		{"extra fields are merged in snake_case", map[string]interface{}{"oem_campaign": "spring"},
+			true, map[string]interface{}{"oem_campaign": "spring"}, false, false},
+
+		// error cases
+		{"collides with a built-in field", map[string]interface{}{"Version": "20.04"}, false, nil, true, false},
+		{"collides with a built-in field in another case", map[string]interface{}{"version": "20.04"}, false, nil, true, false},
+		{"collides with a built-in snake_case field", map[string]interface{}{"report_version": 2}, false, nil, true, false},
+		{"empty field name", map[string]interface{}{"": "spring"}, false, nil, true, false},
+		{"value can't be marshaled", map[string]interface{}{"oem_campaign": func() {}}, false, nil, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", "one partition")
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+			defer cancel()
+
+			// only mock commands are run
+			m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+				helper.GetenvFromMap(map[string]string{}))
+			if tc.snakeCase {
+				if err := metrics.WithSnakeCase()(&m); err != nil {
+					t.Fatal("can't set snake case option", err)
+				}
+			}
+			err := metrics.WithExtraFields(tc.fields)(&m)
+			a.CheckWantedErr(err, tc.wantOptionErr)
+			if tc.wantOptionErr {
+				return
+			}
+
+			b, err := m.Collect()
+			a.CheckWantedErr(err, tc.wantErr)
+			if tc.wantErr {
+				return
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal("collected report isn't valid json", err)
+			}
+			versionField := "Version"
+			if tc.snakeCase {
+				versionField = "version"
+			}
+			a.Equal(got[versionField], "18.04")
+			for k, v := range tc.want {
+				a.Equal(got[k], v)
+			}
+		})
+	}
+}
+
+func TestTimings(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		timings bool
+
+		wantTimings bool
+	}{
+		{"timings are not recorded by default", false, false},
+		{"timings recorded on request", true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", "one partition")
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+			defer cancel()
+
+			// only mock commands are run
+			m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+				helper.GetenvFromMap(map[string]string{}))
+			if tc.timings {
+				if err := metrics.WithTimings()(&m); err != nil {
+					t.Fatal("can't set timings option", err)
+				}
+			}
+			b, err := m.Collect()
+			if err != nil {
+				t.Fatal("Didn't expect collect to fail", err)
+			}
+			got := m.Timings()
+
+			a.Equal(strings.Contains(string(b), "Timings"), false)
+			if !tc.wantTimings {
+				a.Equal(got, map[string]time.Duration(nil))
+				return
+			}
+			for _, name := range []string{"CPU", "Arch", "Kernel", "Virtualization", "GPU", "Partitions", "BootEntryCount",
+				"Screens", "HwCap", "FailedUnitsCount", "HasWWAN", "HasNPU", "UXProfile", "Accessibility", "DesktopVersion",
+				"DefaultBrowser", "DefaultTerminal"} {
+				if _, ok := got[name]; !ok {
+					t.Errorf("expected a timing for %s collector, got %v", name, got)
+				}
+			}
+			a.Equal(len(got), 17)
+		})
+	}
+}
+
+func TestCollectTo(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	newMetrics := func() (metrics.Metrics, func()) {
+		cmdGPU, cancelGPU := newMockShortCmd(t, "lspci", "-n", "one gpu")
+		cmdCPU, cancelCPU := newMockShortCmd(t, "lscpu", "-J", "regular")
+		cmdScreen, cancelScreen := newMockShortCmd(t, "xrandr", "one screen")
+		cmdPartition, cancelPartition := newMockShortCmd(t, "df", "one partition")
+		cmdArchitecture, cancelArchitecture := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+		// only mock commands are run
+		m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+			helper.GetenvFromMap(map[string]string{"LANG": "fr_FR.UTF-8"}))
+		return m, func() {
+			cancelGPU()
+			cancelCPU()
+			cancelScreen()
+			cancelPartition()
+			cancelArchitecture()
+		}
+	}
+
+	m, cancel := newMetrics()
+	defer cancel()
+	want, err := m.Collect()
+	if err != nil {
+		t.Fatal("Didn't expect collect to fail", err)
+	}
+
+	m, cancel = newMetrics()
+	defer cancel()
+	var got bytes.Buffer
+	err = m.CollectTo(&got)
+
+	a.CheckWantedErr(err, false)
+	// same fields in the same order, only terminated by a newline
+	a.Equal(got.String(), string(want)+"\n")
+}
+
+func TestCollectToWithIndent(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", "one gpu")
+	defer cancel()
+	cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "regular")
+	defer cancel()
+	cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+	defer cancel()
+	cmdPartition, cancel := newMockShortCmd(t, "df", "one partition")
+	defer cancel()
+	cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", "regular")
+	defer cancel()
+	m := metrics.NewTestMetrics("testdata/good", cmdGPU, cmdCPU, cmdScreen, cmdPartition, cmdArchitecture, nil, nil,
+		helper.GetenvFromMap(map[string]string{"LANG": "fr_FR.UTF-8"}))
+	if err := metrics.WithIndent("  ")(&m); err != nil {
+		t.Fatal("couldn't set indentation", err)
+	}
+
+	var got bytes.Buffer
+	err := m.CollectTo(&got)
+
+	a.CheckWantedErr(err, false)
+	var want bytes.Buffer
+	if err := json.Indent(&want, bytes.TrimSuffix(got.Bytes(), []byte("\n")), "", "  "); err != nil {
+		t.Fatal("report isn't valid json", err)
+	}
+	a.Equal(got.String(), want.String()+"\n")
+	if !strings.Contains(got.String(), "\n  \"Version\": \"18.04\",\n") {
+		t.Errorf("we expected an indented report, got: %s", got.String())
+	}
+}
+
+func TestCollectWithContext(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		cancelAfter time.Duration
+	}{
+		{"cancelled before collection", 0},
+		{"cancelled while a command runs", 100 * time.Millisecond},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "hang")
+			defer cancel()
+
+			m := newTestMetrics(t, metrics.WithRootAt("testdata/good"),
+				metrics.WithCPUInfoCommand(cmdCPU),
+				metrics.WithMapForEnv(nil))
+
+			ctx, cancelCtx := context.WithCancel(context.Background())
+			defer cancelCtx()
+			if tc.cancelAfter == 0 {
+				cancelCtx()
+			} else {
+				time.AfterFunc(tc.cancelAfter, cancelCtx)
+			}
+
+			start := time.Now()
+			got, err := m.CollectWithContext(ctx)
+
+			a.CheckWantedErr(err, true)
+			a.Equal(got, []byte(nil))
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("collection should have been interrupted, but took %v", d)
+			}
+		})
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", "hang")
+	defer cancel()
+	cmdScreen, cancel := newMockShortCmd(t, "xrandr", "one screen")
+	defer cancel()
+
+	m := newTestMetrics(t, metrics.WithRootAt("testdata/good"),
+		metrics.WithCPUInfoCommand(cmdCPU),
+		metrics.WithScreenInfoCommand(cmdScreen),
+		metrics.WithCommandTimeout(100*time.Millisecond),
+		metrics.WithMapForEnv(nil))
+
+	start := time.Now()
+	r := m.CollectReport()
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("hanging command should have been killed, but collection took %v", d)
+	}
+	// the hanging collector is tolerated, others are still collected
+	a.Equal(r.CPU, (*metrics.CPUInfo)(nil))
+	a.Equal(len(r.Screens), 1)
+	a.Equal(r.Version, "18.04")
+}
+
 func TestRunCollectTwice(t *testing.T) {
 	t.Parallel()
 
@@ -129,6 +918,22 @@ func TestRunCollectTwice(t *testing.T) {
 		caseArchitecture string
 		caseLibc6        string
 		caseHwCap        string
+		caseFailedUnits  string
+		caseWWAN         string
+		caseRender       string
+		caseNPU          string
+		caseKernel       string
+		caseUXProfile    string
+		caseVirt         string
+		caseBootEntries  string
+		caseGPUDriver    string
+		caseGNOMEShell   string
+		caseHighContrast string
+		caseScreenReader string
+		caseLargeText    string
+		caseFSType       string
+		caseBrowser      string
+		caseTerminal     string
 		env              map[string]string
 
 		// note that only an internal json package error can make it returning an error
@@ -136,11 +941,11 @@ func TestRunCollectTwice(t *testing.T) {
 	}{
 		{"regular",
 			"testdata/good", "one gpu", "regular", "one screen",
-			"one partition", "regular", "regular", "regular",
-			map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			"one partition", "regular", "regular", "regular", "several failures", "no modem", "intel iris", "intel npu", "regular", "dark scaled", "regular", "regular", "one gpu with driver", "regular", "disabled", "enabled", "enabled", "ext4 root", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "ubuntu:GNOME", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
 			false},
 		{"empty",
-			"testdata/none", "empty", "empty", "empty", "empty", "empty", "empty", "empty",
+			"testdata/none", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty", "empty",
 			nil,
 			false},
 	}
@@ -164,6 +969,38 @@ func TestRunCollectTwice(t *testing.T) {
 			defer cancel()
 			cmdHwCap, cancel := newMockShortCmd(t, "/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2", "--help", tc.caseHwCap)
 			defer cancel()
+			cmdFailedUnits, cancel := newMockShortCmd(t, "systemctl", "--failed", "--no-legend", tc.caseFailedUnits)
+			defer cancel()
+			cmdWWAN, cancel := newMockShortCmd(t, "mmcli", "-L", tc.caseWWAN)
+			defer cancel()
+			cmdRender, cancel := newMockShortCmd(t, "eglinfo", "-B", tc.caseRender)
+			defer cancel()
+			cmdNPU, cancel := newMockShortCmd(t, "lspci", "-n", tc.caseNPU)
+			defer cancel()
+			cmdKernel, cancel := newMockShortCmd(t, "uname", "-r", tc.caseKernel)
+			defer cancel()
+			cmdUXProfile, cancel := newMockShortCmd(t, "gsettings", "list-recursively", "org.gnome.desktop.interface", tc.caseUXProfile)
+			defer cancel()
+			cmdVirt, cancel := newMockShortCmd(t, "systemd-detect-virt", tc.caseVirt)
+			defer cancel()
+			cmdBootEntries, cancel := newMockShortCmd(t, "efibootmgr", "-v", tc.caseBootEntries)
+			defer cancel()
+			cmdGPUDriver, cancel := newMockShortCmd(t, "lspci", "-nk", tc.caseGPUDriver)
+			defer cancel()
+			cmdGNOMEShell, cancel := newMockShortCmd(t, "gnome-shell", "--version", tc.caseGNOMEShell)
+			defer cancel()
+			cmdHighContrast, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.interface", "high-contrast", tc.caseHighContrast)
+			defer cancel()
+			cmdScreenReader, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.applications", "screen-reader-enabled", tc.caseScreenReader)
+			defer cancel()
+			cmdLargeText, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.interface", "text-scaling-factor", tc.caseLargeText)
+			defer cancel()
+			cmdFSType, cancel := newMockShortCmd(t, "df", "--output=source,fstype", tc.caseFSType)
+			defer cancel()
+			cmdBrowser, cancel := newMockShortCmd(t, "xdg-settings", "get", "default-web-browser", tc.caseBrowser)
+			defer cancel()
+			cmdTerminal, cancel := newMockShortCmd(t, "update-alternatives", "--query", "x-terminal-emulator", tc.caseTerminal)
+			defer cancel()
 
 			m := newTestMetrics(t, metrics.WithRootAt(tc.root),
 				metrics.WithGPUInfoCommand(cmdGPU),
@@ -173,6 +1010,22 @@ func TestRunCollectTwice(t *testing.T) {
 				metrics.WithArchitectureCommand(cmdArchitecture),
 				metrics.WithHwCapCommand(cmdHwCap),
 				metrics.WithLibc6Command(cmdLibc6),
+				metrics.WithFailedUnitsCommand(cmdFailedUnits),
+				metrics.WithWWANInfoCommand(cmdWWAN),
+				metrics.WithRenderInfoCommand(cmdRender),
+				metrics.WithNPUInfoCommand(cmdNPU),
+				metrics.WithKernelCommand(cmdKernel),
+				metrics.WithUXProfileCommand(cmdUXProfile),
+				metrics.WithVirtCommand(cmdVirt),
+				metrics.WithBootEntriesCommand(cmdBootEntries),
+				metrics.WithGPUDriverCommand(cmdGPUDriver),
+				metrics.WithGNOMEShellCommand(cmdGNOMEShell),
+				metrics.WithHighContrastCommand(cmdHighContrast),
+				metrics.WithScreenReaderCommand(cmdScreenReader),
+				metrics.WithLargeTextCommand(cmdLargeText),
+				metrics.WithFSTypeCommand(cmdFSType),
+				metrics.WithBrowserCommand(cmdBrowser),
+				metrics.WithTerminalCommand(cmdTerminal),
 				metrics.WithMapForEnv(tc.env))
 			b1, err1 := m.Collect()
 
@@ -190,6 +1043,38 @@ func TestRunCollectTwice(t *testing.T) {
 			defer cancel()
 			cmdHwCap, cancel = newMockShortCmd(t, "/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2", "--help", tc.caseHwCap)
 			defer cancel()
+			cmdFailedUnits, cancel = newMockShortCmd(t, "systemctl", "--failed", "--no-legend", tc.caseFailedUnits)
+			defer cancel()
+			cmdWWAN, cancel = newMockShortCmd(t, "mmcli", "-L", tc.caseWWAN)
+			defer cancel()
+			cmdRender, cancel = newMockShortCmd(t, "eglinfo", "-B", tc.caseRender)
+			defer cancel()
+			cmdNPU, cancel = newMockShortCmd(t, "lspci", "-n", tc.caseNPU)
+			defer cancel()
+			cmdKernel, cancel = newMockShortCmd(t, "uname", "-r", tc.caseKernel)
+			defer cancel()
+			cmdUXProfile, cancel = newMockShortCmd(t, "gsettings", "list-recursively", "org.gnome.desktop.interface", tc.caseUXProfile)
+			defer cancel()
+			cmdVirt, cancel = newMockShortCmd(t, "systemd-detect-virt", tc.caseVirt)
+			defer cancel()
+			cmdBootEntries, cancel = newMockShortCmd(t, "efibootmgr", "-v", tc.caseBootEntries)
+			defer cancel()
+			cmdGPUDriver, cancel = newMockShortCmd(t, "lspci", "-nk", tc.caseGPUDriver)
+			defer cancel()
+			cmdGNOMEShell, cancel = newMockShortCmd(t, "gnome-shell", "--version", tc.caseGNOMEShell)
+			defer cancel()
+			cmdHighContrast, cancel = newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.interface", "high-contrast", tc.caseHighContrast)
+			defer cancel()
+			cmdScreenReader, cancel = newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.applications", "screen-reader-enabled", tc.caseScreenReader)
+			defer cancel()
+			cmdLargeText, cancel = newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.interface", "text-scaling-factor", tc.caseLargeText)
+			defer cancel()
+			cmdFSType, cancel = newMockShortCmd(t, "df", "--output=source,fstype", tc.caseFSType)
+			defer cancel()
+			cmdBrowser, cancel = newMockShortCmd(t, "xdg-settings", "get", "default-web-browser", tc.caseBrowser)
+			defer cancel()
+			cmdTerminal, cancel = newMockShortCmd(t, "update-alternatives", "--query", "x-terminal-emulator", tc.caseTerminal)
+			defer cancel()
 			m = newTestMetrics(t, metrics.WithRootAt(tc.root),
 				metrics.WithGPUInfoCommand(cmdGPU),
 				metrics.WithCPUInfoCommand(cmdCPU),
@@ -198,6 +1083,22 @@ func TestRunCollectTwice(t *testing.T) {
 				metrics.WithArchitectureCommand(cmdArchitecture),
 				metrics.WithHwCapCommand(cmdHwCap),
 				metrics.WithLibc6Command(cmdLibc6),
+				metrics.WithFailedUnitsCommand(cmdFailedUnits),
+				metrics.WithWWANInfoCommand(cmdWWAN),
+				metrics.WithRenderInfoCommand(cmdRender),
+				metrics.WithNPUInfoCommand(cmdNPU),
+				metrics.WithKernelCommand(cmdKernel),
+				metrics.WithUXProfileCommand(cmdUXProfile),
+				metrics.WithVirtCommand(cmdVirt),
+				metrics.WithBootEntriesCommand(cmdBootEntries),
+				metrics.WithGPUDriverCommand(cmdGPUDriver),
+				metrics.WithGNOMEShellCommand(cmdGNOMEShell),
+				metrics.WithHighContrastCommand(cmdHighContrast),
+				metrics.WithScreenReaderCommand(cmdScreenReader),
+				metrics.WithLargeTextCommand(cmdLargeText),
+				metrics.WithFSTypeCommand(cmdFSType),
+				metrics.WithBrowserCommand(cmdBrowser),
+				metrics.WithTerminalCommand(cmdTerminal),
 				metrics.WithMapForEnv(tc.env))
 			b2, err2 := m.Collect()
 
@@ -212,6 +1113,110 @@ func TestRunCollectTwice(t *testing.T) {
 	}
 }
 
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		root    string
+		caseCmd string
+	}{
+		{"regular", "testdata/good", "regular"},
+		{"missing os-release", "testdata/none", "empty"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			caseGPU, caseGPUDriver, caseScreen, casePartition, caseFailedUnits, caseRender := "one gpu", "one gpu with driver", "one screen", "one partition", "several failures", "intel iris"
+			caseWWAN, caseNPU, caseA11y := "one modem", "intel npu", "enabled"
+			if tc.caseCmd == "empty" {
+				caseGPU, caseGPUDriver, caseScreen, casePartition, caseFailedUnits, caseRender = "empty", "empty", "empty", "empty", "fail", "empty"
+				caseWWAN, caseNPU, caseA11y = "empty", "empty", "empty"
+			}
+			cmdGPU, cancel := newMockShortCmd(t, "lspci", "-n", caseGPU)
+			defer cancel()
+			cmdGPUDriver, cancel := newMockShortCmd(t, "lspci", "-nk", caseGPUDriver)
+			defer cancel()
+			cmdCPU, cancel := newMockShortCmd(t, "lscpu", "-J", tc.caseCmd)
+			defer cancel()
+			cmdScreen, cancel := newMockShortCmd(t, "xrandr", caseScreen)
+			defer cancel()
+			cmdPartition, cancel := newMockShortCmd(t, "df", casePartition)
+			defer cancel()
+			cmdArchitecture, cancel := newMockShortCmd(t, "dpkg", "--print-architecture", tc.caseCmd)
+			defer cancel()
+			cmdLibc6, cancel := newMockShortCmd(t, "dpkg", "--status", "libc6", tc.caseCmd)
+			defer cancel()
+			cmdHwCap, cancel := newMockShortCmd(t, "/lib/x86_64-linux-gnu/ld-linux-x86-64.so.2", "--help", tc.caseCmd)
+			defer cancel()
+			cmdFailedUnits, cancel := newMockShortCmd(t, "systemctl", "--failed", "--no-legend", caseFailedUnits)
+			defer cancel()
+			cmdRender, cancel := newMockShortCmd(t, "eglinfo", "-B", caseRender)
+			defer cancel()
+			cmdKernel, cancel := newMockShortCmd(t, "uname", "-r", tc.caseCmd)
+			defer cancel()
+			cmdUXProfile, cancel := newMockShortCmd(t, "gsettings", "list-recursively", "org.gnome.desktop.interface", tc.caseCmd)
+			defer cancel()
+			cmdVirt, cancel := newMockShortCmd(t, "systemd-detect-virt", tc.caseCmd)
+			defer cancel()
+			cmdBootEntries, cancel := newMockShortCmd(t, "efibootmgr", "-v", tc.caseCmd)
+			defer cancel()
+			cmdWWAN, cancel := newMockShortCmd(t, "mmcli", "-L", caseWWAN)
+			defer cancel()
+			cmdNPU, cancel := newMockShortCmd(t, "lspci", "-n", caseNPU)
+			defer cancel()
+			cmdHighContrast, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.interface", "high-contrast", caseA11y)
+			defer cancel()
+			cmdScreenReader, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.a11y.applications", "screen-reader-enabled", caseA11y)
+			defer cancel()
+			cmdLargeText, cancel := newMockShortCmd(t, "gsettings", "get", "org.gnome.desktop.interface", "text-scaling-factor", caseA11y)
+			defer cancel()
+			cmdGNOMEShell, cancel := newMockShortCmd(t, "gnome-shell", "--version", tc.caseCmd)
+			defer cancel()
+			cmdBrowser, cancel := newMockShortCmd(t, "xdg-settings", "get", "default-web-browser", tc.caseCmd)
+			defer cancel()
+			cmdTerminal, cancel := newMockShortCmd(t, "update-alternatives", "--query", "x-terminal-emulator", tc.caseCmd)
+			defer cancel()
+
+			m := newTestMetrics(t, metrics.WithRootAt(tc.root),
+				metrics.WithGPUInfoCommand(cmdGPU),
+				metrics.WithGPUDriverCommand(cmdGPUDriver),
+				metrics.WithCPUInfoCommand(cmdCPU),
+				metrics.WithScreenInfoCommand(cmdScreen),
+				metrics.WithSpaceInfoCommand(cmdPartition),
+				metrics.WithArchitectureCommand(cmdArchitecture),
+				metrics.WithHwCapCommand(cmdHwCap),
+				metrics.WithLibc6Command(cmdLibc6),
+				metrics.WithFailedUnitsCommand(cmdFailedUnits),
+				metrics.WithRenderInfoCommand(cmdRender),
+				metrics.WithKernelCommand(cmdKernel),
+				metrics.WithUXProfileCommand(cmdUXProfile),
+				metrics.WithVirtCommand(cmdVirt),
+				metrics.WithBootEntriesCommand(cmdBootEntries),
+				metrics.WithWWANInfoCommand(cmdWWAN),
+				metrics.WithNPUInfoCommand(cmdNPU),
+				metrics.WithHighContrastCommand(cmdHighContrast),
+				metrics.WithScreenReaderCommand(cmdScreenReader),
+				metrics.WithLargeTextCommand(cmdLargeText),
+				metrics.WithGNOMEShellCommand(cmdGNOMEShell),
+				metrics.WithBrowserCommand(cmdBrowser),
+				metrics.WithTerminalCommand(cmdTerminal),
+				metrics.WithMapForEnv(map[string]string{"LANG": "fr_FR.UTF-8", "XDG_CURRENT_DESKTOP": "ubuntu:GNOME"}))
+			r := m.SelfTest()
+
+			got, err := json.MarshalIndent(r, "", "  ")
+			if err != nil {
+				t.Fatal("couldn't marshal self test result", err)
+			}
+			want := helper.LoadOrUpdateGolden(t, filepath.Join(tc.root, "gold", "selftest"), got, *metrics.Update)
+			a.Equal(got, want)
+		})
+	}
+}
+
 func newTestMetrics(t *testing.T, fixtures ...func(m *metrics.Metrics) error) metrics.Metrics {
 	t.Helper()
 	m, err := metrics.New(fixtures...)
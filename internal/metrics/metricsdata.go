@@ -2,65 +2,206 @@ package metrics
 
 import "encoding/json"
 
-type metrics struct {
-	Version string `json:",omitempty"`
+// ReportVersion is the schema version of the collected report.
+// It's bumped whenever collected fields are added, removed or change format.
+const ReportVersion = 2
+
+// Report is the collected system, upgrade and installer data
+type Report struct {
+	ReportVersion int `snake:"report_version"`
+
+	Version string `json:",omitempty" snake:"version"`
+	// InstallID is a random identifier generated locally, only reported on request
+	InstallID string `json:",omitempty" snake:"install_id"`
 
 	OEM *struct {
-		Vendor  string
-		Product string
-		Family  string
-		DCD     string `json:",omitempty"`
-	} `json:",omitempty"`
+		Vendor  string `snake:"vendor"`
+		Product string `snake:"product"`
+		Family  string `snake:"family"`
+		Version string `json:",omitempty" snake:"version"`
+		DCD     string `json:",omitempty" snake:"dcd"`
+	} `json:",omitempty" snake:"oem"`
+	// OEMInstall is true on systems pre-installed in factory
+	OEMInstall *bool `json:",omitempty" snake:"oem_install"`
+
 	BIOS *struct {
-		Vendor  string
-		Version string
-	} `json:",omitempty"`
-	CPU        *cpuInfo     `json:",omitempty"`
-	Arch       string       `json:",omitempty"`
-	HwCap      string       `json:",omitempty"`
-	GPU        []gpuInfo    `json:",omitempty"`
-	RAM        *float64     `json:",omitempty"`
-	Disks      []float64    `json:",omitempty"`
-	Partitions []float64    `json:",omitempty"`
-	Screens    []screenInfo `json:",omitempty"`
-
-	Autologin *bool `json:",omitempty"`
-	LivePatch *bool `json:",omitempty"`
-	Session   *struct {
-		DE   string
-		Name string
-		Type string
-	} `json:",omitempty"`
-	Language string `json:",omitempty"`
-	Timezone string `json:",omitempty"`
-
-	Install json.RawMessage `json:",omitempty"`
-	Upgrade json.RawMessage `json:",omitempty"`
+		Vendor  string `snake:"vendor"`
+		Version string `snake:"version"`
+	} `json:",omitempty" snake:"bios"`
+	// Firmware is the system firmware version and release date, as YYYY-MM-DD
+	Firmware *struct {
+		Version string `json:",omitempty" snake:"version"`
+		Date    string `json:",omitempty" snake:"date"`
+	} `json:",omitempty" snake:"firmware"`
+	CPU *CPUInfo `json:",omitempty" snake:"cpu"`
+	// CPUMaxFreq is the CPU maximum frequency in MHz, rounded to the nearest 500 MHz
+	CPUMaxFreq int `json:",omitempty" snake:"cpu_max_freq"`
+	// CPUVulnerabilities is "Not affected", "Mitigation", "Vulnerable" or "Unknown" for each vulnerability
+	// known by the kernel, like "spectre_v2"
+	CPUVulnerabilities map[string]string `json:",omitempty" snake:"cpu_vulnerabilities"`
+	// MicrocodeLoaded never comes with the microcode revision
+	MicrocodeLoaded *bool  `json:",omitempty" snake:"microcode_loaded"`
+	Arch            string `json:",omitempty" snake:"arch"`
+	Kernel          string `json:",omitempty" snake:"kernel"`
+	// Virtualization is the VM or container environment, "none" on bare metal
+	Virtualization string `json:",omitempty" snake:"virtualization"`
+	// Cloud is the cloud provider, "aws", "gce", "azure" or "none", only guessed from DMI information
+	Cloud string    `json:",omitempty" snake:"cloud"`
+	HwCap string    `json:",omitempty" snake:"hw_cap"`
+	GPU   []GPUInfo `json:",omitempty" snake:"gpu"`
+	// GPUCount is the number of VGA compatible GPUs found with lspci, whatever their vendor
+	GPUCount int `json:",omitempty" snake:"gpu_count"`
+
+	HybridGraphics *bool `json:",omitempty" snake:"hybrid_graphics"`
+
+	// Init is the init system running as PID 1, like "systemd", or "other" if unknown
+	Init          string `json:",omitempty" snake:"init"`
+	CgroupVersion int    `json:",omitempty" snake:"cgroup_version"`
+
+	RAM        *float64  `json:",omitempty" snake:"ram"`
+	Mem        int       `json:",omitempty" snake:"mem"` // in GiB, rounded to the nearest GiB
+	Swap       *SwapInfo `json:",omitempty" snake:"swap"`
+	Disks      []float64 `json:",omitempty" snake:"disks"`
+	Partitions []float64 `json:",omitempty" snake:"partitions"`
+	// PartitionTypes are "hdd", "ssd" or "unknown", in the same order than Partitions
+	PartitionTypes []string `json:",omitempty" snake:"partition_types"`
+	// PartitionFSTypes are filesystem types, like "ext4" or "btrfs", in the same order than Partitions
+	PartitionFSTypes []string `json:",omitempty" snake:"partition_fs_types"`
+	// PartitionMounts are only reported on request, in the same order than Partitions
+	PartitionMounts []string `json:",omitempty" snake:"partition_mounts"`
+
+	ImmutableRoot *bool `json:",omitempty" snake:"immutable_root"`
+	// Encrypted is true when a LUKS encrypted volume is in use
+	Encrypted     *bool `json:",omitempty" snake:"encrypted"`
+	TPMDiskUnlock *bool `json:",omitempty" snake:"tpm_disk_unlock"`
+	// SecureBoot is only reported on EFI systems
+	SecureBoot *bool `json:",omitempty" snake:"secure_boot"`
+	// Bootloader is "grub", "systemd-boot" or "refind"
+	Bootloader string `json:",omitempty" snake:"bootloader"`
+	// BootEntryCount is the number of EFI boot entries loading an OS from disk
+	BootEntryCount *int         `json:",omitempty" snake:"boot_entry_count"`
+	Screens        []ScreenInfo `json:",omitempty" snake:"screens"`
+
+	HasBattery *bool `json:",omitempty" snake:"has_battery"`
+	// FormFactor is "laptop" or "desktop", guessed from the battery presence
+	FormFactor string `json:",omitempty" snake:"form_factor"`
+
+	Autologin *bool `json:",omitempty" snake:"autologin"`
+	LivePatch *bool `json:",omitempty" snake:"live_patch"`
+	// SnapCount is the number of installed snaps, only reported on systems with snapd
+	SnapCount *int `json:",omitempty" snake:"snap_count"`
+	// PackageCount is the number of installed deb packages, only reported on systems with dpkg
+	PackageCount *int `json:",omitempty" snake:"package_count"`
+	// UptimeBucket is "under-1h", "under-1d", "under-1w" or "over-1w"
+	UptimeBucket string `json:",omitempty" snake:"uptime_bucket"`
+
+	FailedUnitsCount *int   `json:",omitempty" snake:"failed_units_count"`
+	HasWWAN          *bool  `json:",omitempty" snake:"has_wwan"`
+	HasNPU           *bool  `json:",omitempty" snake:"has_npu"`
+	NPUVendor        string `json:",omitempty" snake:"npu_vendor"`
+
+	// Network counts interfaces per kind, never their names or addresses
+	Network *NetworkInfo `json:",omitempty" snake:"network"`
+
+	Session *struct {
+		DE   string `snake:"de"`
+		Name string `snake:"name"`
+		Type string `snake:"type"`
+	} `json:",omitempty" snake:"session"`
+	// SessionType is the display server, "x11", "wayland", "tty" or "unknown"
+	SessionType string `json:",omitempty" snake:"session_type"`
+	// DesktopVersion is the GNOME Shell or KDE Plasma version of the session desktop
+	DesktopVersion string `json:",omitempty" snake:"desktop_version"`
+	// DefaultBrowser and DefaultTerminal are package like names, like "firefox" or "gnome-terminal"
+	DefaultBrowser  string `json:",omitempty" snake:"default_browser"`
+	DefaultTerminal string `json:",omitempty" snake:"default_terminal"`
+
+	UXProfile *UXProfile `json:",omitempty" snake:"ux_profile"`
+	// Accessibility only reports which features are enabled, never their settings
+	Accessibility *Accessibility `json:",omitempty" snake:"accessibility"`
+	Language      string         `json:",omitempty" snake:"language"`
+	// KeyboardLayout is only the primary layout, like "fr", without variants nor options
+	KeyboardLayout string `json:",omitempty" snake:"keyboard_layout"`
+	// Timezone is only the region, like "Europe", never the city
+	Timezone string `json:",omitempty" snake:"timezone"`
+
+	CustomHostname *bool  `json:",omitempty" snake:"custom_hostname"`
+	DeploymentTag  string `json:",omitempty" snake:"deployment_tag"`
+	AptSource      string `json:",omitempty" snake:"apt_source"`
+
+	// CollectionTimeBucket is "fast", "normal" or "slow" depending on the time taken to collect the report
+	CollectionTimeBucket string `json:",omitempty" snake:"collection_time_bucket"`
+
+	Install json.RawMessage `json:",omitempty" snake:"install"`
+	Upgrade json.RawMessage `json:",omitempty" snake:"upgrade"`
+}
+
+// GPUInfo describes a graphic card
+type GPUInfo struct {
+	Vendor       string `snake:"vendor"`
+	Model        string `snake:"model"`
+	Driver       string `json:",omitempty" snake:"driver"`
+	RenderDriver string `json:",omitempty" snake:"render_driver"`
+	VRAM         int    `json:",omitempty" snake:"vram"` // in GB, rounded up to the next power of 2
+}
+
+// SwapInfo describes the swap configuration
+type SwapInfo struct {
+	// Size in GB of all swap devices and files
+	Size float64 `snake:"size"`
+	// Compressed is true when swapping to compressed memory with zram or zswap
+	Compressed bool `snake:"compressed"`
+}
+
+// NetworkInfo counts network interfaces per kind
+type NetworkInfo struct {
+	Wired    int `snake:"wired"`
+	Wireless int `snake:"wireless"`
+	Virtual  int `snake:"virtual"`
+}
+
+// ScreenInfo describes a connected screen
+type ScreenInfo struct {
+	Size       string `snake:"size"`
+	Resolution string `snake:"resolution"`
+	Frequency  string `snake:"frequency"`
+	Vendor     string `json:",omitempty" snake:"vendor"`
 }
 
-type gpuInfo struct {
-	Vendor string
-	Model  string
+// UXProfile describes the desktop appearance settings
+type UXProfile struct {
+	ScalingFactor     string `json:",omitempty" snake:"scaling_factor"`
+	TextScalingFactor string `json:",omitempty" snake:"text_scaling_factor"`
+	Theme             string `json:",omitempty" snake:"theme"`
+	Animations        *bool  `json:",omitempty" snake:"animations"`
 }
 
-type screenInfo struct {
-	Size       string
-	Resolution string
-	Frequency  string
+// Accessibility describes which accessibility features are enabled
+type Accessibility struct {
+	HighContrast *bool `json:",omitempty" snake:"high_contrast"`
+	ScreenReader *bool `json:",omitempty" snake:"screen_reader"`
+	LargeText    *bool `json:",omitempty" snake:"large_text"`
 }
 
-type cpuInfo struct {
-	OpMode             string
-	CPUs               string
-	Threads            string
-	Cores              string
-	Sockets            string
-	Vendor             string
-	Family             string
-	Model              string
-	Stepping           string
-	Name               string
-	Virtualization     string `json:",omitempty"`
-	Hypervisor         string `json:",omitempty"`
-	VirtualizationType string `json:",omitempty"`
+// CPUInfo describes the processor
+type CPUInfo struct {
+	OpMode             string `snake:"op_mode"`
+	CPUs               string `snake:"cpus"`
+	Threads            string `snake:"threads"`
+	Cores              string `snake:"cores"`
+	Sockets            string `snake:"sockets"`
+	Vendor             string `snake:"vendor"`
+	Family             string `snake:"family"`
+	Model              string `snake:"model"`
+	Stepping           string `snake:"stepping"`
+	Name               string `snake:"name"`
+	Virtualization     string `json:",omitempty" snake:"virtualization"`
+	Hypervisor         string `json:",omitempty" snake:"hypervisor"`
+	VirtualizationType string `json:",omitempty" snake:"virtualization_type"`
+	// Numeric counterparts, omitted when lscpu doesn't report them, like sockets on some ARM machines
+	SocketCount    int `json:",omitempty" snake:"socket_count"`
+	CoresPerSocket int `json:",omitempty" snake:"cores_per_socket"`
+	ThreadsPerCore int `json:",omitempty" snake:"threads_per_core"`
+	// maxFreq is parsed along the other lscpu fields, but reported as the top level CPUMaxFreq
+	maxFreq int
 }
@@ -0,0 +1,176 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/sender"
+)
+
+// Collection duration buckets limits
+const (
+	fastCollectionDuration = 5 * time.Second
+	slowCollectionDuration = 30 * time.Second
+)
+
+// defaultCommandTimeout is the time after which a wedged external command is killed
+const defaultCommandTimeout = 10 * time.Second
+
+// WithConcurrency limits the number of collectors running at the same time.
+// Default is the number of available CPUs.
+func WithConcurrency(n int) func(*Metrics) error {
+	log.Debugf("Setting collectors concurrency to %d", n)
+	return func(m *Metrics) error {
+		if n < 1 {
+			return errors.Errorf("collectors concurrency should be at least 1, got %d", n)
+		}
+		m.maxConcurrency = n
+		return nil
+	}
+}
+
+// WithCommandTimeout kills any external command still running after d, its collector failing like
+// if the command wasn't available. Default is 10 seconds, and 0 means no limit.
+func WithCommandTimeout(d time.Duration) func(*Metrics) error {
+	log.Debugf("Setting external commands timeout to %s", d)
+	return func(m *Metrics) error {
+		if d < 0 {
+			return errors.Errorf("command timeout can't be negative, got %s", d)
+		}
+		m.commandTimeout = d
+		return nil
+	}
+}
+
+// WithBaseURL sets the server reports are sent to, reports path being appended from the distribution and version.
+// Empty means the default server.
+func WithBaseURL(u string) func(*Metrics) error {
+	log.Debugf("Setting server url to %s", u)
+	return func(m *Metrics) error {
+		if _, err := sender.GetURL(u, "", ""); err != nil {
+			return errors.Wrapf(err, "report destination url is invalid")
+		}
+		m.baseURL = u
+		return nil
+	}
+}
+
+// WithCollectionTime adds to the report if collection was fast, normal or slow.
+// Only a bucket is reported, not the actual duration.
+func WithCollectionTime() func(*Metrics) error {
+	log.Debug("Setting collection time reporting")
+	return func(m *Metrics) error {
+		m.collectionTime = true
+		if m.fastCollection == 0 {
+			m.fastCollection = fastCollectionDuration
+		}
+		if m.slowCollection == 0 {
+			m.slowCollection = slowCollectionDuration
+		}
+		return nil
+	}
+}
+
+// WithCoarseLanguage only reports the language, like "fr", instead of the full locale, like "fr_FR",
+// which can be identifying in small populations.
+func WithCoarseLanguage() func(*Metrics) error {
+	log.Debug("Setting coarse language reporting")
+	return func(m *Metrics) error {
+		m.coarseLanguage = true
+		return nil
+	}
+}
+
+// WithPartitionMounts reports the mount point of each partition.
+// They aren't reported by default, as they can hint at user names or custom layouts.
+func WithPartitionMounts() func(*Metrics) error {
+	log.Debug("Setting partition mount points reporting")
+	return func(m *Metrics) error {
+		m.partitionMounts = true
+		return nil
+	}
+}
+
+// WithInstallID adds id to the report, to deduplicate reports from the same install over time.
+// It should be randomly generated and never derived from hardware identifiers.
+func WithInstallID(id string) func(*Metrics) error {
+	log.Debug("Setting install ID reporting")
+	return func(m *Metrics) error {
+		m.installID = id
+		return nil
+	}
+}
+
+// WithLogger calls logger with every non fatal collection error, like a failing command,
+// which are otherwise only visible in verbose mode. logger can be called concurrently.
+func WithLogger(logger func(format string, args ...interface{})) func(*Metrics) error {
+	log.Debug("Setting collection errors logger")
+	return func(m *Metrics) error {
+		m.logger = logger
+		return nil
+	}
+}
+
+// WithSnakeCase names report fields in snake_case, like "report_version", instead of PascalCase.
+// Installer and upgrade data, as well as map keys, are kept as is.
+func WithSnakeCase() func(*Metrics) error {
+	log.Debug("Setting snake_case report fields")
+	return func(m *Metrics) error {
+		m.snakeCase = true
+		return nil
+	}
+}
+
+// WithIndent pretty prints reports written by CollectTo, each nesting level being indented with indent.
+func WithIndent(indent string) func(*Metrics) error {
+	log.Debug("Setting report indentation")
+	return func(m *Metrics) error {
+		m.indent = indent
+		return nil
+	}
+}
+
+// WithTimings records how long each external command collector takes, to diagnose slow collections.
+// They are available with Timings() once collected, and are never part of the report.
+func WithTimings() func(*Metrics) error {
+	log.Debug("Setting collectors timings recording")
+	return func(m *Metrics) error {
+		m.timings = &collectorTimings{}
+		return nil
+	}
+}
+
+// WithExtraFields adds caller supplied fields, like a non identifying campaign tag, to the top level of the report.
+// An error is returned if a field collides with a built-in report field, whatever its case or naming scheme.
+func WithExtraFields(fields map[string]interface{}) func(*Metrics) error {
+	log.Debugf("Setting %d extra report fields", len(fields))
+	return func(m *Metrics) error {
+		extra := make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			if k == "" {
+				return errors.New("extra report fields should have a name")
+			}
+			if isReportField(k) {
+				return errors.Errorf("extra field %q collides with a built-in report field", k)
+			}
+			extra[k] = v
+		}
+		m.extraFields = extra
+		return nil
+	}
+}
+
+// isReportField returns if name is a top level report field, in PascalCase or snake_case
+func isReportField(name string) bool {
+	t := reflect.TypeOf(Report{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if strings.EqualFold(name, f.Name) || strings.EqualFold(name, f.Tag.Get(snakeCaseTag)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"os/exec"
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
+)
+
+// Status of a collector after a self test
+const (
+	// CollectorOK means the collector returned some data
+	CollectorOK = "ok"
+	// CollectorFailed means the collector is available but didn't return any data
+	CollectorFailed = "failed"
+	// CollectorUnavailable means the collector can't run on this machine
+	CollectorUnavailable = "unavailable"
+)
+
+// CollectorStatus is the result of running a single collector in isolation
+type CollectorStatus struct {
+	Name      string
+	Mandatory bool
+	Status    string
+}
+
+// SelfTest runs each collector in isolation and returns its status.
+// Nothing is sent nor saved. Metrics commands are consumed: create a new
+// Metrics element to collect after a self test.
+func (m Metrics) SelfTest() []CollectorStatus {
+	log.Debugf("Running collectors self test with root set to %s", m.root)
+
+	var r []CollectorStatus
+
+	s := CollectorOK
+	if _, _, err := m.GetIDS(); err != nil {
+		log.Infof("IDs collector failed: "+utils.ErrFormat, err)
+		s = CollectorFailed
+	}
+	r = append(r, CollectorStatus{Name: "IDs", Mandatory: true, Status: s})
+
+	for _, c := range m.fileCollectors() {
+		s := CollectorOK
+		if !c.hasData() {
+			s = CollectorUnavailable
+		}
+		r = append(r, CollectorStatus{Name: c.name, Status: s})
+	}
+
+	for _, c := range m.commandCollectors() {
+		s := CollectorOK
+		if c.cmd == nil {
+			s = CollectorUnavailable
+		} else if _, err := exec.LookPath(c.cmd.Path); err != nil {
+			log.Infof("%s collector isn't available: "+utils.ErrFormat, c.name, err)
+			s = CollectorUnavailable
+		} else if !c.hasData() {
+			s = CollectorFailed
+		}
+		r = append(r, CollectorStatus{Name: c.name, Status: s})
+	}
+
+	return r
+}
+
+// hasData runs the collector alone and returns if it set any report field
+func (c collector) hasData() bool {
+	var r Report
+	c.collect(&r)
+	return !reflect.DeepEqual(r, Report{})
+}
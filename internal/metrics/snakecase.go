@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// snakeCaseTag is the struct tag holding the snake_case name of a report field
+const snakeCaseTag = "snake"
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// snakeCaseObject is a json object keeping its fields in struct declaration order
+type snakeCaseObject []snakeCaseField
+
+type snakeCaseField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes fields in order, like encoding/json does for structs
+func (o snakeCaseObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// toSnakeCase returns a value encoding as v, with struct fields named after their snake tag.
+// Map keys and raw json, like installer data, are kept as is as they aren't report fields.
+func toSnakeCase(v reflect.Value) interface{} {
+	if v.Type().Implements(jsonMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return toSnakeCase(v.Elem())
+	case reflect.Struct:
+		var o snakeCaseObject
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			jsonTag := f.Tag.Get("json")
+			if jsonTag == "-" {
+				continue
+			}
+			if strings.Contains(jsonTag, ",omitempty") && isEmptyValue(v.Field(i)) {
+				continue
+			}
+			key := f.Tag.Get(snakeCaseTag)
+			if key == "" {
+				key = f.Name
+			}
+			o = append(o, snakeCaseField{key, toSnakeCase(v.Field(i))})
+		}
+		return o
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		s := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s = append(s, toSnakeCase(v.Index(i)))
+		}
+		return s
+	}
+	return v.Interface()
+}
+
+// isEmptyValue matches encoding/json definition of empty values for omitempty
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -2,7 +2,15 @@ package sender
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
@@ -10,22 +18,94 @@ import (
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/ubuntu/ubuntu-report/internal/utils"
 )
 
 // BaseURL server to send metrics to
 const BaseURL = "https://metrics.ubuntu.com"
 
+// unixScheme is used to send reports to a local forwarder listening on a Unix socket,
+// like unix:///run/forwarder.sock. The report path is then carried as the url fragment.
+const unixScheme = "unix"
+
+// DefaultTimeout is the time limit for a report request to complete
+const DefaultTimeout = 30 * time.Second
+
+// DigestHeader carries the hex encoded SHA-256 of the uncompressed json report
+const DigestHeader = "X-Report-SHA256"
+
+// Header is an additional HTTP header set on the report request
+type Header struct {
+	Key   string
+	Value string
+}
+
+// Digest returns the hex encoded SHA-256 of data, as set in DigestHeader
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 // Send to url the json data
 func Send(url string, data []byte) error {
+	return SendWithTimeout(url, data, DefaultTimeout)
+}
+
+// SendWithTimeout sends to url the json data, giving up after timeout.
+// A timeout of 0 or less uses DefaultTimeout.
+func SendWithTimeout(url string, data []byte, timeout time.Duration) error {
+	return SendWithContext(context.Background(), url, data, timeout)
+}
+
+// SendWithContext sends to url the json data, giving up after timeout or once ctx is done.
+// A timeout of 0 or less uses DefaultTimeout. Headers are added to the request, but can't override
+// the Content-Type, Content-Encoding and User-Agent ones.
+func SendWithContext(ctx context.Context, url string, data []byte, timeout time.Duration, headers ...Header) error {
 	log.Debugf("sending %s to %s", data, url)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
+	return send(ctx, url, data, "", timeout, headers)
+}
+
+// SendCompressedWithContext is like SendWithContext, but gzips the json data before sending it
+func SendCompressedWithContext(ctx context.Context, url string, data []byte, timeout time.Duration, headers ...Header) error {
+	log.Debugf("sending compressed %s to %s", data, url)
+
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrap(err, "couldn't compress data")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "couldn't compress data")
+	}
+	return send(ctx, url, b.Bytes(), "gzip", timeout, headers)
+}
+
+func send(ctx context.Context, url string, body []byte, encoding string, timeout time.Duration, headers []Header) error {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	url, transport, err := transportFor(url)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return errors.Wrap(err, "couldn't create http request")
 	}
+	req = req.WithContext(ctx)
+	// content headers are set last so that additional headers can't corrupt the body decoding
+	for _, h := range headers {
+		req.Header.Set(h.Key, h.Value)
+	}
 	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	req.Header.Set("User-Agent", "ubuntu-report/"+utils.Version)
 
 	client := &http.Client{
-		Timeout: time.Second * 10,
+		Timeout:   timeout,
+		Transport: transport,
 	}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -37,8 +117,53 @@ func Send(url string, data []byte) error {
 		return errors.Errorf("incorrect status code received: %s", resp.Status)
 	}
 
-	_, err = ioutil.ReadAll(resp.Body)
-	return errors.Wrap(err, "POST body answer contained an error")
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "couldn't read POST body answer")
+	}
+	return checkAnswer(b)
+}
+
+// serverAnswer is the optional json body the server answers with.
+// An empty body, a non json one or an empty "error" field acknowledges the report.
+type serverAnswer struct {
+	Error string `json:"error"`
+}
+
+// checkAnswer returns an error if the server answered with a non empty "error" field,
+// which some servers do with a 200 status code when running in degraded mode.
+func checkAnswer(body []byte) error {
+	var a serverAnswer
+	if err := json.Unmarshal(body, &a); err != nil {
+		log.Debugf("POST body answer isn't a json object, considering it as successful: %s", body)
+		return nil
+	}
+	if a.Error != "" {
+		return errors.Errorf("server answered with an error: %s", a.Error)
+	}
+	return nil
+}
+
+// transportFor returns the url to send the request to and how to reach it.
+// Unix socket urls are dialed on their socket path, the default transport is used otherwise.
+func transportFor(rawURL string) (string, http.RoundTripper, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != unixScheme {
+		// invalid urls are reported when creating the request
+		return rawURL, nil, nil
+	}
+	if u.Path == "" {
+		return "", nil, errors.Errorf("no socket path in %s", rawURL)
+	}
+
+	socket := u.Path
+	t := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return "http://unix" + path.Join("/", u.Fragment), t, nil
 }
 
 // GetURL with distro and version marshalling
@@ -47,6 +172,20 @@ func GetURL(URL, distro, version string) (string, error) {
 	if err != nil {
 		return "", errors.Wrapf(err, "invalid base URL: %s", URL)
 	}
+	if u.Scheme == unixScheme {
+		u.Fragment = path.Join("/", u.Fragment, distro, "desktop", version)
+		return u.String(), nil
+	}
 	u.Path = path.Join(u.Path, distro, "desktop", version)
 	return u.String(), nil
 }
+
+// IsClockSkew returns true if err is due to the server certificate not being valid yet.
+// This is generally a sign that the local clock is wrong, like on first boot before NTP sync.
+func IsClockSkew(err error) bool {
+	var certErr x509.CertificateInvalidError
+	if !stderrors.As(errors.Cause(err), &certErr) {
+		return false
+	}
+	return certErr.Reason == x509.Expired && certErr.Cert != nil && time.Now().Before(certErr.Cert.NotBefore)
+}
@@ -1,9 +1,14 @@
 package sender_test
 
 import (
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -22,6 +27,7 @@ func TestGetURL(t *testing.T) {
 		wantErr bool
 	}{
 		{"regular", "https://myurl.com", "https://myurl.com/distroname/desktop/versionnumber", false},
+		{"unix socket", "unix:///run/forwarder.sock", "unix:///run/forwarder.sock#/distroname/desktop/versionnumber", false},
 		{"bad parsing", "http://a b.com/", "", true},
 	}
 	for _, tc := range testCases {
@@ -68,6 +74,187 @@ func TestSend(t *testing.T) {
 	}
 }
 
+func TestSendAnswer(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		answer string
+
+		wantErr bool
+	}{
+		{"empty answer", "", false},
+		{"ok answer", `{"status": "ok"}`, false},
+		{"empty error field", `{"error": ""}`, false},
+		{"non json answer", "OK", false},
+		{"error field", `{"error": "database unavailable"}`, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.answer)
+			}))
+			defer ts.Close()
+
+			err := sender.Send(ts.URL, []byte("some content"))
+
+			a.CheckWantedErr(err, tc.wantErr)
+		})
+	}
+}
+
+func TestSendUserAgent(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	defer ts.Close()
+
+	err := sender.Send(ts.URL, []byte("some content"))
+
+	a.CheckWantedErr(err, false)
+	a.Equal(got, "ubuntu-report/dev")
+}
+
+func TestSendHeaders(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		compress bool
+	}{
+		{"uncompressed", false},
+		{"compressed", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			var gotDigest, gotOther string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotDigest = r.Header.Get(sender.DigestHeader)
+				gotOther = r.Header.Get("X-Other")
+			}))
+			defer ts.Close()
+
+			data := []byte("some content")
+			headers := []sender.Header{{Key: sender.DigestHeader, Value: sender.Digest(data)}, {Key: "X-Other", Value: "value"}}
+			send := sender.SendWithContext
+			if tc.compress {
+				send = sender.SendCompressedWithContext
+			}
+			err := send(context.Background(), ts.URL, data, 0, headers...)
+
+			a.CheckWantedErr(err, false)
+			// sha256sum of "some content"
+			a.Equal(gotDigest, "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56")
+			a.Equal(gotOther, "value")
+		})
+	}
+}
+
+func TestSendHeadersDontOverrideContent(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	var gotType, gotEncoding, gotUserAgent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get("Content-Type")
+		gotEncoding = r.Header.Get("Content-Encoding")
+		gotUserAgent = r.Header.Get("User-Agent")
+	}))
+	defer ts.Close()
+
+	headers := []sender.Header{
+		{Key: "Content-Type", Value: "text/plain"},
+		{Key: "Content-Encoding", Value: "identity"},
+		{Key: "User-Agent", Value: "other"},
+	}
+	err := sender.SendCompressedWithContext(context.Background(), ts.URL, []byte("some content"), 0, headers...)
+
+	a.CheckWantedErr(err, false)
+	a.Equal(gotType, "application/json")
+	a.Equal(gotEncoding, "gzip")
+	a.Equal(gotUserAgent, "ubuntu-report/dev")
+}
+
+func TestSendCompressedWithContext(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	var encoding string
+	var got []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("couldn't decompress request body: %v", err)
+			return
+		}
+		got, _ = ioutil.ReadAll(zr)
+	}))
+	defer ts.Close()
+
+	err := sender.SendCompressedWithContext(context.Background(), ts.URL, []byte("some content"), 0)
+
+	a.CheckWantedErr(err, false)
+	a.Equal(encoding, "gzip")
+	a.Equal(string(got), "some content")
+}
+
+func TestSendUnixSocket(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	dir, tearDown := helper.TempDir(t)
+	defer tearDown()
+	socket := filepath.Join(dir, "forwarder.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal("couldn't listen on unix socket", err)
+	}
+	var gotPath string
+	var got []byte
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		got, _ = ioutil.ReadAll(r.Body)
+	}))
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	u, err := sender.GetURL("unix://"+socket, "ubuntu", "18.04")
+	if err != nil {
+		t.Fatal("couldn't get report url", err)
+	}
+	err = sender.Send(u, []byte("some content"))
+
+	a.CheckWantedErr(err, false)
+	a.Equal(gotPath, "/ubuntu/desktop/18.04")
+	a.Equal(string(got), "some content")
+}
+
+func TestSendUnixSocketNoServer(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	dir, tearDown := helper.TempDir(t)
+	defer tearDown()
+
+	err := sender.Send("unix://"+filepath.Join(dir, "forwarder.sock"), []byte("some content"))
+
+	a.CheckWantedErr(err, true)
+}
+
 func TestSendNoServer(t *testing.T) {
 	t.Parallel()
 	a := helper.Asserter{T: t}
@@ -77,6 +264,58 @@ func TestSendNoServer(t *testing.T) {
 	a.CheckWantedErr(err, true)
 }
 
+func TestSendWithTimeout(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	closehandler := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		case <-closehandler:
+		}
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	err := sender.SendWithTimeout(ts.URL, []byte("some content"), 100*time.Millisecond)
+	d := time.Since(start)
+	close(closehandler)
+
+	a.CheckWantedErr(err, true)
+	if d > 2*time.Second {
+		t.Errorf("Expected request to time out after 100ms, but it took %v", d)
+	}
+}
+
+func TestSendWithContext(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	closehandler := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		case <-closehandler:
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	err := sender.SendWithContext(ctx, ts.URL, []byte("some content"), 0)
+	d := time.Since(start)
+	close(closehandler)
+
+	a.CheckWantedErr(err, true)
+	if d > 2*time.Second {
+		t.Errorf("Expected request to be cancelled after 100ms, but it took %v", d)
+	}
+}
+
 func TestSendInfiniteRequestServer(t *testing.T) {
 	helper.SkipIfShort(t)
 	t.Parallel()
@@ -89,7 +328,7 @@ func TestSendInfiniteRequestServer(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer close(handlerclosed)
 		select {
-		case <-time.After(20 * time.Second):
+		case <-time.After(sender.DefaultTimeout + 10*time.Second):
 			timeout = true
 		case <-r.Context().Done():
 		case <-closehandler:
@@ -21,24 +21,65 @@ var (
 
 // ReportPath of last saved report
 func ReportPath(distro, version string, cacheP string) (string, error) {
-	if cacheP == "" {
-		var err error
-		if cacheP, err = cacheDir(); err != nil {
-			return "", err
-		}
-	}
-	return filepath.Join(cacheP, reportDir, distro+"."+version), nil
+	return cachePath(cacheP, distro+"."+version)
 }
 
 // PendingReportPath of last saved pending report
 func PendingReportPath(cacheP string) (string, error) {
+	return cachePath(cacheP, "pending")
+}
+
+// SpoolDir where collected reports are queued for a later upload
+func SpoolDir(cacheP string) (string, error) {
+	return cachePath(cacheP, "spool")
+}
+
+// RetryStatePath of the file storing when the next pending report sending attempt is allowed
+func RetryStatePath(cacheP string) (string, error) {
+	return cachePath(cacheP, "next-retry")
+}
+
+// SpoolRetryStatePath of the file storing when the next spooled report sending attempt is allowed.
+// It's separate from the pending report one so that failing to send one kind doesn't delay the other.
+func SpoolRetryStatePath(cacheP string) (string, error) {
+	return cachePath(cacheP, "spool-next-retry")
+}
+
+// RemindLaterPath of the file storing when the user asked to be reminded later
+func RemindLaterPath(cacheP string) (string, error) {
+	return cachePath(cacheP, "remind-later")
+}
+
+// LastSendPath of the file storing when a pending report was last sent
+func LastSendPath(cacheP string) (string, error) {
+	return cachePath(cacheP, "last-send")
+}
+
+// InstallIDPath of the file storing the random install ID, only created on request
+func InstallIDPath(cacheP string) (string, error) {
+	return cachePath(cacheP, "install-id")
+}
+
+// HistoryPath of the JSON lines log of every sent report
+func HistoryPath(cacheP string) (string, error) {
+	return cachePath(cacheP, "history")
+}
+
+// DraftReportPath of the report reviewed and kept by the user on quit, to be sent later
+func DraftReportPath(cacheP string) (string, error) {
+	return cachePath(cacheP, "draft")
+}
+
+// cachePath returns the path of name in the report directory of cacheP, or of the user cache directory
+// if cacheP is empty
+func cachePath(cacheP, name string) (string, error) {
 	if cacheP == "" {
 		var err error
 		if cacheP, err = cacheDir(); err != nil {
 			return "", err
 		}
 	}
-	return filepath.Join(cacheP, reportDir, "pending"), nil
+	return filepath.Join(cacheP, reportDir, name), nil
 }
 
 func cacheDir() (string, error) {
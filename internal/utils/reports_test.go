@@ -89,6 +89,43 @@ func TestPendingReportPath(t *testing.T) {
 	}
 }
 
+func TestSpoolDir(t *testing.T) {
+
+	// get current user for some tests
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("couldn't get current user for testing: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_cache_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/spool", false},
+		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/spool", false},
+		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/spool", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/spool", false},
+		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/spool", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.SpoolDir(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
 func changeEnv(t *testing.T, key, value string) func() {
 	t.Helper()
 	orig := os.Getenv(key)
@@ -102,3 +139,269 @@ func changeEnv(t *testing.T, key, value string) func() {
 		}
 	}
 }
+
+func TestRetryStatePath(t *testing.T) {
+
+	// get current user for some tests
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("couldn't get current user for testing: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_cache_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/next-retry", false},
+		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/next-retry", false},
+		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/next-retry", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/next-retry", false},
+		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/next-retry", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/next-retry", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.RetryStatePath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestSpoolRetryStatePath(t *testing.T) {
+
+	// get current user for some tests
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("couldn't get current user for testing: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_cache_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/spool-next-retry", false},
+		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/spool-next-retry", false},
+		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/spool-next-retry", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/spool-next-retry", false},
+		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/spool-next-retry", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/spool-next-retry", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.SpoolRetryStatePath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestRemindLaterPath(t *testing.T) {
+
+	// get current user for some tests
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("couldn't get current user for testing: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_cache_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/remind-later", false},
+		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/remind-later", false},
+		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/remind-later", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/remind-later", false},
+		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/remind-later", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/remind-later", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.RemindLaterPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestLastSendPath(t *testing.T) {
+
+	// get current user for some tests
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("couldn't get current user for testing: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_cache_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/last-send", false},
+		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/last-send", false},
+		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/last-send", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/last-send", false},
+		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/last-send", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/last-send", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.LastSendPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestInstallIDPath(t *testing.T) {
+
+	// get current user for some tests
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("couldn't get current user for testing: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_cache_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/install-id", false},
+		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/install-id", false},
+		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/install-id", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/install-id", false},
+		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/install-id", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/install-id", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.InstallIDPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestHistoryPath(t *testing.T) {
+
+	// get current user for some tests
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("couldn't get current user for testing: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_cache_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/history", false},
+		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/history", false},
+		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/history", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/history", false},
+		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/history", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/history", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.HistoryPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestDraftReportPath(t *testing.T) {
+
+	// get current user for some tests
+	u, err := user.Current()
+	if err != nil {
+		t.Fatalf("couldn't get current user for testing: %v", err)
+	}
+
+	testCases := []struct {
+		name            string
+		home            string
+		xdg_cache_dir   string
+		explicitacheDir string
+
+		want    string
+		wantErr bool
+	}{
+		{"regular", "/some/dir", "", "", "/some/dir/.cache/ubuntu-report/draft", false},
+		{"relative xdg path", "/some/dir", "xdg_cache_path", "", "/some/dir/xdg_cache_path/ubuntu-report/draft", false},
+		{"absolute xdg path", "/some/dir", "/xdg_cache_path", "", "/xdg_cache_path/ubuntu-report/draft", false},
+		{"no home dir", "", "", "", u.HomeDir + "/.cache/ubuntu-report/draft", false},
+		{"explicit cache dir", "", "", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/draft", false},
+		{"explicit cache dir takes predecedence", "/some/dir", "/xdg_cache_path", "/explicit/cachedir", "/explicit/cachedir/ubuntu-report/draft", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer changeEnv(t, "HOME", tc.home)()
+			defer changeEnv(t, "XDG_CACHE_HOME", tc.xdg_cache_dir)()
+			a := helper.Asserter{T: t}
+
+			got, err := utils.DraftReportPath(tc.explicitacheDir)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
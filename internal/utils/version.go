@@ -0,0 +1,12 @@
+package utils
+
+// Build metadata, set at build time with:
+// -ldflags "-X github.com/ubuntu/ubuntu-report/internal/utils.Version=…"
+var (
+	// Version of ubuntu-report
+	Version = "dev"
+	// Commit the binary was built from
+	Commit = ""
+	// BuildDate of the binary
+	BuildDate = ""
+)
@@ -96,6 +96,12 @@
 //      sysmetrics_report_auto = 1,
 //      // sysmetrics_report_optout will send opt-out message without printing report
 //      sysmetrics_report_optout = 2,
+//      // sysmetrics_report_spool will queue the report in the spool directory without printing report
+//      sysmetrics_report_spool = 3,
+//      // sysmetrics_report_dry_run will only print the report which would be sent, without sending it nor saving anything on disk
+//      sysmetrics_report_dry_run = 4,
+//      // sysmetrics_report_interactive_diff is like sysmetrics_report_interactive, but only shows what changed since the last report
+//      sysmetrics_report_interactive_diff = 5,
 //    } sysmetrics_report_type;
 // You should generally prefer in bindings the auto or optout report. Interactive is based on stdout and stdin.
 // The report will not be sent if a report has already been sent for this version unless "alwaysReport" is true.
@@ -9,6 +9,12 @@ typedef enum {
     sysmetrics_report_auto = 1,
     // sysmetrics_report_optout will send opt-out message without printing report
     sysmetrics_report_optout = 2,
+    // sysmetrics_report_spool will queue the report in the spool directory without printing report
+    sysmetrics_report_spool = 3,
+    // sysmetrics_report_dry_run will only print the report which would be sent, without sending it nor saving anything on disk
+    sysmetrics_report_dry_run = 4,
+    // sysmetrics_report_interactive_diff is like sysmetrics_report_interactive, but only shows what changed since the last report
+    sysmetrics_report_interactive_diff = 5,
 } sysmetrics_report_type;
 */
 import "C"
@@ -22,6 +22,7 @@ import (
 // These wrappers are here for gotest to find.
 // Similar technic than in https://golang.org/misc/cgo/test/cgo_test.go
 func TestCollect(t *testing.T)                      { testCollect(t) }
+func TestReportTypes(t *testing.T)                  { testReportTypes(t) }
 func TestSendReport(t *testing.T)                   { testSendReport(t) }
 func TestSendDecline(t *testing.T)                  { testSendDecline(t) }
 func TestNonInteractiveCollectAndSend(t *testing.T) { testNonInteractiveCollectAndSend(t) }
@@ -8,6 +8,9 @@ package main
 //     sysmetrics_report_interactive = 0,
 //     sysmetrics_report_auto = 1,
 //     sysmetrics_report_optout = 2,
+//     sysmetrics_report_spool = 3,
+//     sysmetrics_report_dry_run = 4,
+//     sysmetrics_report_interactive_diff = 5,
 // } sysmetrics_report_type;
 // typedef unsigned char GoUint8;
 // extern char* sysmetrics_send_report(char* p0, GoUint8 p1, char* p2);
@@ -61,6 +64,33 @@ func testCollect(t *testing.T) {
 	}
 }
 
+func testReportTypes(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		c    C.sysmetrics_report_type
+
+		want sysmetrics.ReportType
+	}{
+		{"interactive", C.sysmetrics_report_interactive, sysmetrics.ReportInteractive},
+		{"auto", C.sysmetrics_report_auto, sysmetrics.ReportAuto},
+		{"opt-out", C.sysmetrics_report_optout, sysmetrics.ReportOptOut},
+		{"spool", C.sysmetrics_report_spool, sysmetrics.ReportSpool},
+		{"dry run", C.sysmetrics_report_dry_run, sysmetrics.ReportDryRun},
+		{"interactive diff", C.sysmetrics_report_interactive_diff, sysmetrics.ReportInteractiveDiff},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			a.Equal(sysmetrics.ReportType(tc.c), tc.want)
+		})
+	}
+}
+
 func testSendReport(t *testing.T) {
 	// we change current path and env variable: not parallelizable tests
 	helper.SkipIfShort(t)
@@ -91,7 +121,7 @@ func testSendReport(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			cData := C.CString(fmt.Sprintf(`{ %s: "18.04" }`, expectedReportItem))
+			cData := C.CString(fmt.Sprintf(`{ %s "18.04" }`, expectedReportItem))
 			url := C.CString(ts.URL)
 			defer C.free(unsafe.Pointer(url))
 
@@ -3,7 +3,11 @@
 package sysmetrics
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -20,56 +24,467 @@ const (
 	ReportAuto
 	// ReportOptOut will send opt-out message without printing report
 	ReportOptOut
+	// ReportSpool will queue the report in the spool directory without printing report.
+	// Spooled reports are sent later on by FlushSpool()
+	ReportSpool
+	// ReportDryRun will only print the report which would be sent, without sending it nor saving anything on disk
+	ReportDryRun
+	// ReportInteractiveDiff is like ReportInteractive, but only shows what changed since the last report.
+	// The full report is shown if there is no previous report.
+	ReportInteractiveDiff
 )
 
+// Report is the collected system, upgrade and installer data
+type Report = metrics.Report
+
+// CollectorStatus is the result of running a single collector during SelfTest()
+type CollectorStatus = metrics.CollectorStatus
+
+// Option tweaks how reports are collected and sent
+type Option func(*options)
+
+type options struct {
+	confirmServer  bool
+	maxBodyBytes   int
+	timeout        time.Duration
+	ctx            context.Context
+	allowTest      bool
+	baseURL        string
+	compress       bool
+	collectionTime bool
+	maxAttempts    int
+	history        bool
+	coarseLanguage bool
+	mounts         bool
+	preSend        func([]byte) ([]byte, error)
+	excludedFields []string
+	digest         bool
+	digestOut      *string
+	pendingDir     string
+	extraHeaders   map[string]string
+	onlyIfChanged  bool
+	installID      bool
+	logger         func(format string, args ...interface{})
+	stateless      bool
+	snakeCase      bool
+	extraFields    map[string]interface{}
+	draft          bool
+}
+
+// WithServerConfirmation asks in interactive mode to confirm the destination host
+// before the consent prompt, when reporting to a non default server.
+func WithServerConfirmation() Option {
+	return func(o *options) {
+		o.confirmServer = true
+	}
+}
+
+// WithMaxBodyBytes refuses to send any report larger than n bytes, returning a *BodyTooLargeError.
+// A value of 0 or less means no limit.
+func WithMaxBodyBytes(n int) Option {
+	return func(o *options) {
+		o.maxBodyBytes = n
+	}
+}
+
+// WithTimeout sets the time limit for the report request to complete.
+// Reports which couldn't be sent in time are saved for a later automated report.
+// A value of 0 or less uses the default timeout of 30 seconds.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithTestReportsAllowed sends reports even if they look like test or placeholder data
+func WithTestReportsAllowed() Option {
+	return func(o *options) {
+		o.allowTest = true
+	}
+}
+
+// WithBaseURL configures once the server reports are sent to, reports path being appended
+// from the distribution and version. A non empty "baseURL" parameter still takes precedence.
+// An invalid url is reported as soon as the report is about to be collected or sent.
+func WithBaseURL(u string) Option {
+	return func(o *options) {
+		o.baseURL = u
+	}
+}
+
+// WithCompression gzips the report before sending it, to save bandwidth on metered connections.
+// The maximum body size still applies to the uncompressed report.
+func WithCompression() Option {
+	return func(o *options) {
+		o.compress = true
+	}
+}
+
+// WithCollectionTime adds to the report if collection was fast, normal or slow.
+// Only a bucket is reported, not the actual duration.
+func WithCollectionTime() Option {
+	return func(o *options) {
+		o.collectionTime = true
+	}
+}
+
+// WithMaxAttempts gives up sending pending or spooled reports after n attempts, keeping them
+// on disk for a later try. A value of 0 or less retries until the report is sent.
+func WithMaxAttempts(n int) Option {
+	return func(o *options) {
+		o.maxAttempts = n
+	}
+}
+
+// WithHistory appends every sent report, with its sending date, as a new JSON line to a history
+// file in the cache directory. The file reporting the latest sent report is kept as is.
+func WithHistory() Option {
+	return func(o *options) {
+		o.history = true
+	}
+}
+
+// WithCoarseLanguage only reports the language, like "fr", instead of the full locale, like "fr_FR"
+func WithCoarseLanguage() Option {
+	return func(o *options) {
+		o.coarseLanguage = true
+	}
+}
+
+// WithPartitionMounts reports the mount point of each partition, which are excluded by default
+// as they can hint at user names or custom layouts.
+func WithPartitionMounts() Option {
+	return func(o *options) {
+		o.mounts = true
+	}
+}
+
+// WithPreSendHook calls hook with the report right before sending it.
+// The returned data are sent and saved instead, and an error aborts sending without keeping a pending report.
+func WithPreSendHook(hook func([]byte) ([]byte, error)) Option {
+	return func(o *options) {
+		o.preSend = hook
+	}
+}
+
+// WithExcludedFields removes the given top level fields, like "Autologin" or "OEM", from the report before sending it.
+// The mandatory "Version" field can't be excluded.
+func WithExcludedFields(fields []string) Option {
+	return func(o *options) {
+		o.excludedFields = fields
+	}
+}
+
+// WithDigestHeader sets the SHA-256 of the report in the X-Report-SHA256 header, so that the server can check
+// its integrity and deduplicate reports. If d isn't nil, it's set to the hex encoded digest of the sent report.
+func WithDigestHeader(d *string) Option {
+	return func(o *options) {
+		o.digest = true
+		o.digestOut = d
+	}
+}
+
+// WithPendingDir stores the report which couldn't be sent in dir, like a writable tmpfs on read-only systems,
+// instead of the cache directory. Pending reports are then read back from dir too.
+func WithPendingDir(dir string) Option {
+	return func(o *options) {
+		o.pendingDir = dir
+	}
+}
+
+// WithExtraHeaders sets additional HTTP headers on the report request, like a tenant name tagging reports at ingest.
+// Nothing collected from the machine is added to them. Headers set by the report itself, like the digest,
+// Content-Type, Content-Encoding and User-Agent ones, take precedence.
+func WithExtraHeaders(headers map[string]string) Option {
+	return func(o *options) {
+		o.extraHeaders = headers
+	}
+}
+
+// WithOnlyIfChanged lets automated reports replace the report already sent for this distribution and version,
+// but only if the newly collected one differs. An unchanged report isn't sent and ErrUnchanged is returned.
+// Fields changing on every collection, like the uptime or the number of failed units, are ignored.
+// A previous opt-out is still respected, and forcing a report always sends it.
+func WithOnlyIfChanged() Option {
+	return func(o *options) {
+		o.onlyIfChanged = true
+	}
+}
+
+// WithInstallID adds a random ID, generated on first use and kept in the cache directory, to collected reports
+// when enabled. It allows deduplicating reports from the same install over time without any hardware identifier.
+// The ID isn't kept in stateless mode nor on dry runs.
+func WithInstallID(enabled bool) Option {
+	return func(o *options) {
+		o.installID = enabled
+	}
+}
+
+// WithLogger calls logger with every non fatal error happening while collecting the report, like a failing command.
+// Those are otherwise tolerated and only visible in verbose mode.
+func WithLogger(logger func(format string, args ...interface{})) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithStateless sends reports over the network without writing anything on disk when enabled,
+// for immutable or diskless systems. Previous reports aren't checked, so a report is sent on each call,
+// and a report which couldn't be sent is lost instead of being kept for a later automated report.
+func WithStateless(enabled bool) Option {
+	return func(o *options) {
+		o.stateless = enabled
+	}
+}
+
+// WithSnakeCase names collected report fields in snake_case, like "report_version", instead of PascalCase,
+// for ingestion pipelines using this naming scheme. Installer and upgrade data are kept as is.
+func WithSnakeCase() Option {
+	return func(o *options) {
+		o.snakeCase = true
+	}
+}
+
+// WithExtraFields adds caller supplied fields, like a non identifying OEM campaign tag, to the top level
+// of collected reports. Collecting fails if a field collides with a built-in report field.
+func WithExtraFields(fields map[string]interface{}) Option {
+	return func(o *options) {
+		o.extraFields = fields
+	}
+}
+
+// WithDraft saves the collected report as a draft when the user quits an interactive report, when enabled.
+// The next interactive report offers to send this already reviewed draft instead of collecting a new report.
+// Drafts are unrelated to pending reports, which are reports that couldn't be delivered.
+func WithDraft(enabled bool) Option {
+	return func(o *options) {
+		o.draft = enabled
+	}
+}
+
+// BodyTooLargeError is returned when the report to send exceeds the maximum body size
+type BodyTooLargeError struct {
+	Size int
+	Max  int
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("report is %d bytes, which exceeds the maximum body size of %d bytes", e.Size, e.Max)
+}
+
+var (
+	// ErrAlreadyReported is returned when a report or opt-out message was already sent for this distribution and version
+	ErrAlreadyReported = errors.New("metrics from this machine have already been reported")
+	// ErrPendingWritten is returned when the report couldn't be sent and is kept on disk for a later automated report
+	ErrPendingWritten = errors.New("report kept for a later automated report")
+	// ErrNoIDs is returned when the distribution or its version couldn't be determined
+	ErrNoIDs = errors.New("couldn't get distribution and version information")
+	// ErrUnchanged is returned when the collected report is identical to the one already sent, and wasn't sent again
+	ErrUnchanged = errors.New("report didn't change since the last one sent")
+	// ErrRateLimited is returned when a pending report was sent too recently to send another one
+	ErrRateLimited = errors.New("a pending report was sent too recently")
+	// ErrNoPendingReport is returned when there is no pending report to send
+	ErrNoPendingReport = errors.New("no pending report to send")
+)
+
+// kindError is err, which callers can match against kind with errors.Is
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e kindError) Error() string { return e.err.Error() }
+
+// Cause returns the underlying error, for errors.Cause
+func (e kindError) Cause() error { return e.err }
+
+// Unwrap returns the underlying error, for errors.Is and errors.As
+func (e kindError) Unwrap() error { return e.err }
+
+// Is reports if kind is target
+func (e kindError) Is(target error) bool { return e.kind == target }
+
+// withKind annotates err so that errors.Is(err, kind) is true
+func withKind(kind, err error) error {
+	return kindError{kind: kind, err: err}
+}
+
+// withContext cancels sending the report once ctx is done
+func withContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// newMetrics returns a metric collector configured with opts
+func newMetrics(opts []Option) (metrics.Metrics, error) {
+	o := newOptions(opts)
+	var mOpts []func(*metrics.Metrics) error
+	if o.baseURL != "" {
+		mOpts = append(mOpts, metrics.WithBaseURL(o.baseURL))
+	}
+	if o.collectionTime {
+		mOpts = append(mOpts, metrics.WithCollectionTime())
+	}
+	if o.coarseLanguage {
+		mOpts = append(mOpts, metrics.WithCoarseLanguage())
+	}
+	if o.mounts {
+		mOpts = append(mOpts, metrics.WithPartitionMounts())
+	}
+	if o.logger != nil {
+		mOpts = append(mOpts, metrics.WithLogger(o.logger))
+	}
+	if o.snakeCase {
+		mOpts = append(mOpts, metrics.WithSnakeCase())
+	}
+	if len(o.extraFields) > 0 {
+		mOpts = append(mOpts, metrics.WithExtraFields(o.extraFields))
+	}
+	return metrics.New(mOpts...)
+}
+
 // Collect system info and return a pretty printed version of collected data
 func Collect() ([]byte, error) {
+	return CollectWithContext(context.Background())
+}
+
+// CollectWithContext is like Collect, but stops collecting once ctx is done
+func CollectWithContext(ctx context.Context) ([]byte, error) {
 	log.Debug("collect system information")
 
 	m, err := metrics.New()
 	if err != nil {
 		return nil, errors.Wrapf(err, "couldn't create a metric collector")
 	}
-	return metricsCollect(m)
+	return metricsCollectWithContext(ctx, m)
+}
+
+// CollectTo streams a pretty printed version of collected system info to w, followed by a newline.
+// The report isn't built in memory as a whole before being written.
+func CollectTo(w io.Writer) error {
+	log.Debug("collect system information")
+
+	m, err := metrics.New(metrics.WithIndent("  "))
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create a metric collector")
+	}
+	return errors.Wrapf(m.CollectTo(w), "couldn't collect system minimal info")
+}
+
+// CollectReport gathers system info and returns them as a structured report
+func CollectReport() (Report, error) {
+	log.Debug("collect system information")
+
+	m, err := metrics.New()
+	if err != nil {
+		return Report{}, errors.Wrapf(err, "couldn't create a metric collector")
+	}
+	return m.CollectReport(), nil
+}
+
+// HasReported returns if a report or opt-out message was already sent for the current distribution and version.
+// Nothing is collected nor sent.
+func HasReported() (bool, error) {
+	log.Debug("check for previous report")
+
+	m, err := metrics.New()
+	if err != nil {
+		return false, errors.Wrapf(err, "couldn't create a metric collector")
+	}
+	return metricsHasReported(m, "")
 }
 
 // SendReport POST to the baseURL server data coming from a previous collect.
 // The report will not be sent if a report has already been sent for this version unless "alwaysReport" is true.
 // If "baseURL" is not an empty string, this overrides the server the report is sent to.
-func SendReport(data []byte, alwaysReport bool, baseURL string) error {
+// Options can tweak how the report is sent.
+// Returned errors can be matched with errors.Is against ErrAlreadyReported, ErrPendingWritten and ErrNoIDs.
+func SendReport(data []byte, alwaysReport bool, baseURL string, opts ...Option) error {
+	return SendReportWithContext(context.Background(), data, alwaysReport, baseURL, opts...)
+}
+
+// SendReportWithContext is like SendReport, but stops sending once ctx is done.
+// A cancelled report is saved for a later automated report.
+func SendReportWithContext(ctx context.Context, data []byte, alwaysReport bool, baseURL string, opts ...Option) error {
 	log.Debug("report system information")
 
-	m, err := metrics.New()
+	m, err := newMetrics(opts)
 	if err != nil {
 		return errors.Wrapf(err, "couldn't create a metric collector")
 	}
-	return metricsSend(m, data, true, alwaysReport, baseURL, "", os.Stdin, os.Stdout)
+	return metricsSend(m, data, true, alwaysReport, baseURL, "", os.Stdin, os.Stdout, append(opts, withContext(ctx))...)
+}
+
+// SendCollectedReport is like SendReport, but sends a report previously returned by CollectReport,
+// and possibly modified since. It's marshaled exactly like Collect does before being sent and saved,
+// field naming and extra fields set by options applying.
+func SendCollectedReport(r Report, alwaysReport bool, baseURL string, opts ...Option) error {
+	return SendCollectedReportWithContext(context.Background(), r, alwaysReport, baseURL, opts...)
+}
+
+// SendCollectedReportWithContext is like SendCollectedReport, but stops sending once ctx is done.
+// A cancelled report is saved for a later automated report.
+func SendCollectedReportWithContext(ctx context.Context, r Report, alwaysReport bool, baseURL string, opts ...Option) error {
+	log.Debug("report system information")
+
+	m, err := newMetrics(opts)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create a metric collector")
+	}
+	data, err := metricsMarshalReport(m, r)
+	if err != nil {
+		return err
+	}
+	return metricsSend(m, data, true, alwaysReport, baseURL, "", os.Stdin, os.Stdout, append(opts, withContext(ctx))...)
 }
 
 // SendDecline POST to the baseURL server data denial report message.
 // The denial message will not be sent if a report has already been sent for this version unless "alwaysReport" is true.
 // If "baseURL" is not an empty string, this overrides the server the report is sent to.
-func SendDecline(alwaysReport bool, baseURL string) error {
+// Options can tweak how the denial message is sent.
+func SendDecline(alwaysReport bool, baseURL string, opts ...Option) error {
+	return SendDeclineWithContext(context.Background(), alwaysReport, baseURL, opts...)
+}
+
+// SendDeclineWithContext is like SendDecline, but stops sending once ctx is done
+func SendDeclineWithContext(ctx context.Context, alwaysReport bool, baseURL string, opts ...Option) error {
 	log.Debug("report system information")
 
-	m, err := metrics.New()
+	m, err := newMetrics(opts)
 	if err != nil {
 		return errors.Wrapf(err, "couldn't create a metric collector")
 	}
-	return metricsSend(m, nil, false, alwaysReport, baseURL, "", os.Stdin, os.Stdout)
+	return metricsSend(m, nil, false, alwaysReport, baseURL, "", os.Stdin, os.Stdout, append(opts, withContext(ctx))...)
 }
 
 // CollectAndSend gather system info and send them
 // The report will not be sent if a report has already been sent for this version unless "alwaysReport" is true.
 // If "baseURL" is not an empty string, this overrides the server the report is sent to.
-func CollectAndSend(r ReportType, alwaysReport bool, baseURL string) error {
+// Options can tweak the interactions with the user and how the report is sent.
+// ErrUnchanged is returned if only a changed report was requested and it's identical to the previous one.
+func CollectAndSend(r ReportType, alwaysReport bool, baseURL string, opts ...Option) error {
+	return CollectAndSendWithContext(context.Background(), r, alwaysReport, baseURL, opts...)
+}
+
+// CollectAndSendWithContext is like CollectAndSend, but stops collecting and sending once ctx is done.
+// A report cancelled while being sent is saved for a later automated report.
+func CollectAndSendWithContext(ctx context.Context, r ReportType, alwaysReport bool, baseURL string, opts ...Option) error {
 	log.Debug("collect and report system information")
 
-	m, err := metrics.New()
+	m, err := newMetrics(opts)
 	if err != nil {
 		return errors.Wrapf(err, "couldn't create a metric collector")
 	}
-	return metricsCollectAndSend(m, r, alwaysReport, baseURL, "", os.Stdin, os.Stdout)
+	return metricsCollectAndSend(m, r, alwaysReport, baseURL, "", os.Stdin, os.Stdout, append(opts, withContext(ctx))...)
 }
 
 // CollectAndSendOnUpgrade gather system info and send them
@@ -88,13 +503,78 @@ func CollectAndSendOnUpgrade(alwaysReport bool, baseURL string) error {
 }
 
 // SendPendingReport will try to send any pending report which didn't succeed previously due to network issues.
-// It will try sending and exponentially back off until a send is successful.
-func SendPendingReport(baseURL string) error {
+// It will try sending and exponentially back off until a send is successful,
+// or the maximum number of attempts set by options is reached.
+// If a previous run gave up, the report is kept without any attempt until its next attempt time passes.
+// ErrNoPendingReport is returned if there is no pending report to send.
+// Pending reports are sent at most once a day, ErrRateLimited being returned otherwise.
+func SendPendingReport(baseURL string, opts ...Option) error {
+	return SendPendingReportWithContext(context.Background(), baseURL, opts...)
+}
+
+// SendPendingReportWithContext is like SendPendingReport, but stops sending and backing off once ctx is done.
+// The pending report is kept for a later try.
+func SendPendingReportWithContext(ctx context.Context, baseURL string, opts ...Option) error {
 	log.Debug("try sending previous report")
 
-	m, err := metrics.New()
+	m, err := newMetrics(opts)
 	if err != nil {
 		return errors.Wrapf(err, "couldn't create a metric collector")
 	}
-	return metricsSendPendingReport(m, baseURL, "", os.Stdin, os.Stdout)
+	return metricsSendPendingReport(m, baseURL, "", os.Stdin, os.Stdout, append(opts, withContext(ctx))...)
+}
+
+// FlushSpool will send every report previously queued in the spool directory.
+// It backs off exponentially on each report until it's successfully sent.
+// If a previous run gave up, reports are kept without any attempt until its next attempt time passes.
+// Spooled and pending reports back off independently.
+// If "baseURL" is not an empty string, this overrides the server the reports are sent to.
+// Excluded fields and the pre-send hook set by options apply to each report, like when sending it directly.
+// Options can limit the number of attempts for each report. In stateless mode, each report is tried once
+// and sent reports aren't saved.
+func FlushSpool(baseURL string, opts ...Option) error {
+	log.Debug("send spooled reports")
+
+	m, err := newMetrics(opts)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create a metric collector")
+	}
+	return metricsFlushSpool(m, baseURL, "", opts...)
+}
+
+// SendSpool POST every report found in dir, like reports written by other machines on a shared spool.
+// Reports spooled by ReportSpool, with their metadata header, and bare reports are both accepted.
+// Reports are sent to the distribution and version path of "baseURL", like SendReport does, from their
+// metadata header or, for bare reports, the distribution of this machine and the report "Version" field.
+// If "baseURL" is an empty string, reports are sent to the configured or default server.
+// Excluded fields, the pre-send hook, test report detection and the body size limit set by options apply
+// to each report, and each one is tried once unless options allow more attempts.
+// Successfully sent reports are removed from dir while the others are kept for a later try.
+// It returns the number of sent reports, and an error if any report couldn't be sent.
+func SendSpool(dir, baseURL string, opts ...Option) (sent int, err error) {
+	log.Debugf("send reports from %s", dir)
+
+	m, err := newMetrics(opts)
+	if err != nil {
+		return 0, errors.Wrapf(err, "couldn't create a metric collector")
+	}
+	return metricsSendSpool(m, dir, baseURL, "", opts...)
+}
+
+// ValidateReport checks that data is a well-formed report: valid JSON with the mandatory "Version" field,
+// like reports are checked before being sent, and known fields holding values of the expected type.
+func ValidateReport(data []byte) error {
+	return verifyReport(data)
+}
+
+// SelfTest runs each collector in isolation and returns which ones succeed, fail or are unavailable.
+// Nothing is sent. An error is returned if a mandatory collector failed.
+func SelfTest() ([]CollectorStatus, error) {
+	log.Debug("self test collectors")
+
+	m, err := metrics.New()
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't create a metric collector")
+	}
+	return metricsSelfTest(m)
 }
@@ -2,6 +2,8 @@ package sysmetrics_test
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -29,6 +31,25 @@ func TestCollect(t *testing.T) {
 	}
 }
 
+func TestCollectTo(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	err := sysmetrics.CollectTo(&b)
+
+	if err != nil {
+		t.Fatal("we didn't expect an error and got one", err)
+	}
+
+	data := b.String()
+	if !strings.Contains(data, sysmetrics.ExpectedReportItem) {
+		t.Errorf("we expected at least %s in output, got: '%s", sysmetrics.ExpectedReportItem, data)
+	}
+	if !strings.HasSuffix(data, "}\n") {
+		t.Errorf("we expected the report to end with a newline, got: '%s", data)
+	}
+}
+
 func TestSendReport(t *testing.T) {
 	// we change current path and env variable: not parallelizable tests
 	helper.SkipIfShort(t)
@@ -60,7 +81,7 @@ func TestSendReport(t *testing.T) {
 			}))
 			defer ts.Close()
 
-			err := sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s: "18.04" }`, sysmetrics.ExpectedReportItem)),
+			err := sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s "18.04" }`, sysmetrics.ExpectedReportItem)),
 				tc.alwaysReport, ts.URL)
 
 			a.CheckWantedErr(err, tc.wantErr)
@@ -77,6 +98,41 @@ func TestSendReport(t *testing.T) {
 		})
 	}
 }
+
+func TestSendCollectedReport(t *testing.T) {
+	// we change current path and env variable: not parallelizable tests
+	helper.SkipIfShort(t)
+
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	defer helper.ChangeEnv("XDG_CACHE_HOME", out)()
+	out = filepath.Join(out, "ubuntu-report")
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	r := sysmetrics.Report{Version: "18.04", Language: "fr_FR"}
+	want, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		t.Fatal("couldn't marshal report", err)
+	}
+
+	err = sysmetrics.SendCollectedReport(r, false, ts.URL)
+
+	a.CheckWantedErr(err, false)
+	a.Equal(string(body), string(want))
+	p := filepath.Join(out, helper.FindInDirectory(t, "", out))
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatalf("couldn't open report file %s", out)
+	}
+	a.Equal(string(data), string(want))
+}
+
 func TestSendDecline(t *testing.T) {
 	// we change current path and env variable: not parallelizable tests
 	helper.SkipIfShort(t)
@@ -160,7 +216,7 @@ func TestSendReportTwice(t *testing.T) {
 			defer ts.Close()
 
 			// first call
-			err := sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s: "18.04" }`, sysmetrics.ExpectedReportItem)),
+			err := sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s "18.04" }`, sysmetrics.ExpectedReportItem)),
 				tc.alwaysReport, ts.URL)
 			if err != nil {
 				t.Fatal("we didn't expect getting an error, got:", err)
@@ -183,7 +239,7 @@ func TestSendReportTwice(t *testing.T) {
 
 			// second call, reset server
 			serverHit = false
-			err = sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s: "18.04" }`, sysmetrics.ExpectedReportItem)),
+			err = sysmetrics.SendReport([]byte(fmt.Sprintf(`{ %s "18.04" }`, sysmetrics.ExpectedReportItem)),
 				tc.alwaysReport, ts.URL)
 			a.CheckWantedErr(err, tc.wantErr)
 
@@ -2,12 +2,19 @@ package sysmetrics
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	crand "crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -21,30 +28,86 @@ import (
 // optOutJSON is the data sent in case of Opt-Out choice
 const optOutJSON = `{"OptOut": true}`
 
+// mandatoryReportField is the field any acknowledged report should contain
+const mandatoryReportField = "Version"
+
+// mandatorySnakeCaseReportField is mandatoryReportField in reports collected with snake_case field names
+const mandatorySnakeCaseReportField = "version"
+
+// testDistros are distribution IDs only used in tests and demos
+var testDistros = []string{"test", "testing", "example", "placeholder"}
+
+// maxHistoryEntries is the number of entries kept in the send-history log
+const maxHistoryEntries = 100
+
+// remindLaterCooldown is how long we wait before prompting again a user who asked to be reminded later
+const remindLaterCooldown = 7 * 24 * time.Hour
+
+// Backoff between two sending attempts of pending and spooled reports.
+// Each wait is doubled, capped to maxReportTimeoutDuration, and a random jitter of
+// up to reportTimeoutJitter of the wait is added so that clients don't retry in lockstep.
 var (
 	initialReportTimeoutDuration = 30 * time.Second
+	maxReportTimeoutDuration     = 30 * time.Minute
+	reportTimeoutJitter          = 0.1
 )
 
+// minPendingSendInterval is the minimum time between two pending report sendings, so that
+// a misconfigured timer can't send pending reports in bursts
+var minPendingSendInterval = 24 * time.Hour
+
 func metricsCollect(m metrics.Metrics) ([]byte, error) {
-	data, err := m.Collect()
+	return metricsCollectWithContext(context.Background(), m)
+}
+
+func metricsCollectWithContext(ctx context.Context, m metrics.Metrics) ([]byte, error) {
+	data, err := m.CollectWithContext(ctx)
 	if err != nil {
 		return nil, errors.Wrapf(err, "couldn't collect system minimal info")
 	}
+	return indentReport(data)
+}
 
+// metricsMarshalReport returns r formatted exactly like metricsCollect does
+func metricsMarshalReport(m metrics.Metrics, r Report) ([]byte, error) {
+	data, err := m.MarshalReport(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "report can't be converted to a valid json")
+	}
+	return indentReport(data)
+}
+
+// indentReport pretty prints data as shown to the user, sent and saved
+func indentReport(data []byte) ([]byte, error) {
 	log.Debug("pretty print format the collected data to the user")
 	h := json.RawMessage(data)
 	return json.MarshalIndent(&h, "", "  ")
 }
 
-func metricsSend(m metrics.Metrics, data []byte, acknowledgement, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer) error {
+func metricsSelfTest(m metrics.Metrics) ([]CollectorStatus, error) {
+	r := m.SelfTest()
+	for _, c := range r {
+		if c.Mandatory && c.Status != metrics.CollectorOK {
+			return r, errors.Errorf("mandatory collector %s is %s", c.Name, c.Status)
+		}
+	}
+	return r, nil
+}
+
+func metricsSend(m metrics.Metrics, data []byte, acknowledgement, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
 	distro, version, err := m.GetIDS()
 	if err != nil {
-		return errors.Wrapf(err, "couldn't get mandatory information")
+		return withKind(ErrNoIDs, errors.Wrapf(err, "couldn't get mandatory information"))
 	}
 
-	reportP, err := checkPreviousReport(distro, version, reportBasePath, alwaysReport)
-	if err != nil {
-		return err
+	// without any state on disk, previous reports can't be checked
+	var reportP string
+	if !o.stateless {
+		if reportP, err = checkPreviousReport(distro, version, reportBasePath, alwaysReport); err != nil {
+			return err
+		}
 	}
 
 	// erase potential collected data
@@ -52,54 +115,361 @@ func metricsSend(m metrics.Metrics, data []byte, acknowledgement, alwaysReport b
 		data = []byte(optOutJSON)
 	}
 
-	if baseURL == "" {
-		baseURL = sender.BaseURL
+	if data, err = prepareReport(o, distro, data, acknowledgement); err != nil {
+		return err
 	}
-	u, err := sender.GetURL(baseURL, distro, version)
+
+	u, err := sender.GetURL(serverURL(m, baseURL), distro, version)
 	if err != nil {
 		return errors.Wrapf(err, "report destination url is invalid")
 	}
-	if err := sender.Send(u, data); err != nil {
+	if err := postReport(o, u, data); err != nil {
+		if o.stateless {
+			return errors.Wrapf(err, "data were not delivered successfully to metrics server")
+		}
 		returnErr := errors.Wrapf(err, "data were not delivered successfully to metrics server, saving for a later automated report")
-		p, err := utils.PendingReportPath(reportBasePath)
+		if sender.IsClockSkew(err) {
+			log.Warningf("server certificate isn't valid yet, system clock (%s) is probably wrong. Saving report to send it once the clock is set", time.Now().Format(time.RFC3339))
+			returnErr = errors.Wrapf(err, "system clock is probably wrong, saving for a later automated report")
+		}
+		p, err := pendingReportPath(reportBasePath, o)
 		if err != nil {
 			return errors.Wrapf(err, "couldn't get where pending reported metrics should be stored on disk: %v", returnErr)
 		}
 		if err := saveMetrics(p, data); err != nil {
 			return errors.Wrapf(err, "couldn't save pending reported are on disk: %v", returnErr)
 		}
-		return returnErr
+		return withKind(ErrPendingWritten, returnErr)
+	}
+
+	if o.stateless {
+		return nil
+	}
+
+	removeStalePendingReport(reportBasePath, o)
+	removeRemindLater(reportBasePath)
+	removeDraft(reportBasePath)
+	if o.history {
+		recordHistory(reportBasePath, data)
 	}
 
 	return saveMetrics(reportP, data)
 }
 
-func metricsCollectAndSend(m metrics.Metrics, r ReportType, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer) error {
+// prepareReport applies the field exclusion and pre-send hook set by options to data, and checks the result
+// can be sent. Field exclusion and report validation only apply to collected reports, not to opt-out messages.
+func prepareReport(o options, distro string, data []byte, collected bool) ([]byte, error) {
+	var err error
+	if collected {
+		if data, err = excludeFields(data, o.excludedFields); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.preSend != nil {
+		if data, err = o.preSend(data); err != nil {
+			return nil, errors.Wrapf(err, "report was rejected before sending it")
+		}
+	}
+
+	if collected {
+		if err := validateReport(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkSendable(o, distro, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// checkSendable refuses reports which must not reach the server: test reports, unless they are allowed,
+// and reports larger than the maximum body size.
+func checkSendable(o options, distro string, data []byte) error {
+	if !o.allowTest {
+		if reason := testReportReason(distro, data); reason != "" {
+			return errors.Errorf("report looks like test data (%s), refusing to send it unless test reports are allowed", reason)
+		}
+	}
+
+	if o.maxBodyBytes > 0 && len(data) > o.maxBodyBytes {
+		return &BodyTooLargeError{Size: len(data), Max: o.maxBodyBytes}
+	}
+	return nil
+}
+
+// postReport POST data to u, with the headers, compression, context and timeout set by options
+func postReport(o options, u string, data []byte) error {
+	var headers []sender.Header
+	keys := make([]string, 0, len(o.extraHeaders))
+	for k := range o.extraHeaders {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		headers = append(headers, sender.Header{Key: k, Value: o.extraHeaders[k]})
+	}
+	if o.digest {
+		d := sender.Digest(data)
+		headers = append(headers, sender.Header{Key: sender.DigestHeader, Value: d})
+		if o.digestOut != nil {
+			*o.digestOut = d
+		}
+	}
+	send := sender.SendWithContext
+	if o.compress {
+		send = sender.SendCompressedWithContext
+	}
+	return send(o.ctx, u, data, o.timeout, headers...)
+}
+
+// validateReport checks that data is a well-formed report, containing at least the mandatory field.
+// Malformed reports are never kept as pending, as retrying to send them would fail the same way.
+func validateReport(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return errors.Wrapf(err, "report is malformed, refusing to send it")
+	}
+	_, ok := fields[mandatoryReportField]
+	if _, snakeCase := fields[mandatorySnakeCaseReportField]; !ok && !snakeCase {
+		return errors.Errorf("report is missing the mandatory %q field, refusing to send it", mandatoryReportField)
+	}
+	return nil
+}
+
+// verifyReport checks data like validateReport, and that known fields can be decoded as a Report,
+// with installer and upgrader data being objects.
+func verifyReport(data []byte) error {
+	if err := validateReport(data); err != nil {
+		return err
+	}
+
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return errors.Wrapf(err, "report has a field of an unexpected type")
+	}
+	for _, f := range []struct {
+		name string
+		v    json.RawMessage
+	}{{"Install", r.Install}, {"Upgrade", r.Upgrade}} {
+		if len(f.v) == 0 || string(f.v) == "null" {
+			continue
+		}
+		var o map[string]json.RawMessage
+		if err := json.Unmarshal(f.v, &o); err != nil {
+			return errors.Wrapf(err, "%s data should be an object", f.name)
+		}
+	}
+	return nil
+}
+
+// excludeFields removes the top level fields from the report data.
+// data is returned as is if none of them are present.
+func excludeFields(data []byte, fields []string) ([]byte, error) {
+	if len(fields) == 0 {
+		return data, nil
+	}
+
+	var report map[string]json.RawMessage
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, errors.Wrapf(err, "report is malformed, couldn't exclude fields from it")
+	}
+	excluded := false
+	for _, f := range fields {
+		if f == mandatoryReportField || f == mandatorySnakeCaseReportField {
+			return nil, errors.Errorf("%q field is mandatory and can't be excluded", f)
+		}
+		if _, ok := report[f]; !ok {
+			continue
+		}
+		delete(report, f)
+		excluded = true
+	}
+	if !excluded {
+		return data, nil
+	}
+
+	d, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't format report without excluded fields")
+	}
+	return d, nil
+}
+
+// serverURL returns the server to send the report to: baseURL if set, then the one configured
+// on the metrics element, falling back to the default server.
+func serverURL(m metrics.Metrics, baseURL string) string {
+	if baseURL != "" {
+		return baseURL
+	}
+	if u := m.BaseURL(); u != "" {
+		return u
+	}
+	return sender.BaseURL
+}
+
+// testReportReason returns why the report looks like test or placeholder data, or an empty string
+func testReportReason(distro string, data []byte) string {
+	for _, d := range testDistros {
+		if distro == d {
+			return fmt.Sprintf("distribution is %q", distro)
+		}
+	}
+
+	var marker struct {
+		Test bool
+	}
+	if err := json.Unmarshal(data, &marker); err == nil && marker.Test {
+		return "report has a test marker"
+	}
+	return ""
+}
+
+// pendingReportPath returns where the pending report is stored, in the pending directory set by options if any
+func pendingReportPath(reportBasePath string, o options) (string, error) {
+	if o.pendingDir != "" {
+		return filepath.Join(o.pendingDir, "pending"), nil
+	}
+	return utils.PendingReportPath(reportBasePath)
+}
+
+// removeStalePendingReport deletes any leftover pending report after a successful direct send.
+// Pending reports are always sent for the current release, which is now reported.
+func removeStalePendingReport(reportBasePath string, o options) {
+	p, err := pendingReportPath(reportBasePath, o)
+	if err != nil {
+		log.Infof("couldn't get where pending reported metrics are stored on disk: "+utils.ErrFormat, err)
+		return
+	}
+	if err := os.Remove(p); err != nil {
+		if !os.IsNotExist(err) {
+			log.Infof("couldn't remove stale pending report: "+utils.ErrFormat, err)
+		}
+		return
+	}
+	log.Infof("removed stale pending report %s", p)
+}
+
+func metricsCollectAndSend(m metrics.Metrics, r ReportType, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
 	distro, version, err := m.GetIDS()
 	if err != nil {
-		return errors.Wrapf(err, "couldn't get mandatory information")
+		return withKind(ErrNoIDs, errors.Wrapf(err, "couldn't get mandatory information"))
 	}
 
-	if _, err := checkPreviousReport(distro, version, reportBasePath, alwaysReport); err != nil {
-		return err
+	// without any state on disk, previous reports and reminders can't be checked
+	if o.stateless {
+		alwaysReport = true
+	}
+
+	// an identical report is checked once collected
+	onlyIfChanged := o.onlyIfChanged && r == ReportAuto && !alwaysReport
+	var reportP string
+	// a dry run only previews the report, whether one was already sent or not
+	if !o.stateless && r != ReportDryRun {
+		if reportP, err = checkPreviousReport(distro, version, reportBasePath, alwaysReport || onlyIfChanged); err != nil {
+			return err
+		}
+	}
+
+	interactive := r == ReportInteractive || r == ReportInteractiveDiff
+	if interactive && !alwaysReport {
+		if until, deferred := remindLaterUntil(reportBasePath); deferred {
+			log.Infof("report was deferred by the user, not prompting again before %s", until.Format(time.RFC3339))
+			return nil
+		}
 	}
+	scanner := bufio.NewScanner(in)
 
 	var data []byte
-	if r != ReportOptOut {
-		if data, err = metricsCollect(m); err != nil {
+	// a draft was already reviewed by the user, and is sent as is
+	draft := interactive && o.draft && !o.stateless
+	fromDraft := false
+	if draft {
+		if data = loadDraft(version, reportBasePath); data != nil {
+			var answered bool
+			if fromDraft, answered = confirmDraft(scanner, out); !answered {
+				return nil
+			}
+			if !fromDraft {
+				data = nil
+				removeDraft(reportBasePath)
+			}
+		}
+	}
+	if r != ReportOptOut && !fromDraft {
+		if o.installID {
+			// the install ID is only kept once reports can be saved
+			id, err := installID(reportBasePath, !o.stateless && r != ReportDryRun)
+			if err != nil {
+				return err
+			}
+			if err := metrics.WithInstallID(id)(&m); err != nil {
+				return err
+			}
+		}
+		if data, err = metricsCollectWithContext(o.ctx, m); err != nil {
 			return errors.Wrapf(err, "couldn't collect system minimal info and format it")
 		}
+		// only show what will be sent
+		if data, err = excludeFields(data, o.excludedFields); err != nil {
+			return err
+		}
+	}
+
+	if onlyIfChanged {
+		previous, err := ioutil.ReadFile(reportP)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "couldn't read previous report")
+		}
+		if err == nil {
+			if strings.TrimSpace(string(previous)) == optOutJSON {
+				return withKind(ErrAlreadyReported, errors.Errorf("an opt-out message was already sent from this machine and can be found in: %s", reportP))
+			}
+			if sameReport(previous, data) {
+				return withKind(ErrUnchanged, errors.Errorf("report is identical to the one already sent in %s, not sending it again", reportP))
+			}
+			log.Debug("report changed since the last one, replacing it")
+			alwaysReport = true
+		}
 	}
 
 	sendMetrics := true
-	if r == ReportInteractive {
-		fmt.Fprintln(out, "This is the result of hardware and optional installer/upgrader that we collected:")
-		fmt.Fprintln(out, string(data))
+	if interactive {
+		if u := serverURL(m, baseURL); o.confirmServer && u != sender.BaseURL {
+			confirmed, err := confirmServer(u, scanner, out)
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				log.Debug("destination server wasn't confirmed")
+				return nil
+			}
+		}
+
+		if fromDraft {
+			return metricsSend(m, data, true, alwaysReport, baseURL, reportBasePath, in, out, opts...)
+		}
+
+		var diff []string
+		if r == ReportInteractiveDiff {
+			diff = diffWithLastReport(distro, reportBasePath, data)
+		}
+		if diff != nil {
+			fmt.Fprintln(out, "This is what changed in the hardware and optional installer/upgrader data since the last report:")
+			for _, l := range diff {
+				fmt.Fprintln(out, l)
+			}
+		} else {
+			fmt.Fprintln(out, "This is the result of hardware and optional installer/upgrader that we collected:")
+			fmt.Fprintln(out, string(data))
+		}
 
 		validAnswer := false
-		scanner := bufio.NewScanner(in)
 		for validAnswer != true {
-			fmt.Fprintf(out, "Do you agree to report this? [y (send metrics)/n (send opt out message)/Q (quit)] ")
+			fmt.Fprintf(out, "Do you agree to report this? [y (send metrics)/n (send opt out message)/l (remind me later)/Q (quit)] ")
 			if !scanner.Scan() {
 				log.Info("programm interrupted")
 				return nil
@@ -113,7 +483,16 @@ func metricsCollectAndSend(m metrics.Metrics, r ReportType, alwaysReport bool, b
 				log.Debug("sending report was accepted")
 				sendMetrics = true
 				validAnswer = true
+			} else if text == "l" || text == "later" {
+				log.Debug("sending report was deferred")
+				if o.stateless {
+					return errors.New("can't remind later without saving the reminder on disk")
+				}
+				return remindLater(reportBasePath)
 			} else if text == "q" || text == "quit" || text == "" {
+				if draft {
+					return saveDraft(reportBasePath, data)
+				}
 				return nil
 			}
 			if validAnswer != true {
@@ -123,18 +502,211 @@ func metricsCollectAndSend(m metrics.Metrics, r ReportType, alwaysReport bool, b
 	} else if r == ReportAuto {
 		log.Debug("auto report requested")
 		sendMetrics = true
+	} else if r == ReportSpool {
+		log.Debug("spool report requested")
+		if o.stateless {
+			return errors.New("can't spool the report without writing it on disk")
+		}
+		return metricsSpool(m, data, reportBasePath)
+	} else if r == ReportDryRun {
+		log.Debug("dry run report requested")
+		fmt.Fprintln(out, string(data))
+		return nil
 	} else {
 		log.Debug("opt-out report requested")
 		sendMetrics = false
 	}
 
-	return metricsSend(m, data, sendMetrics, alwaysReport, baseURL, reportBasePath, in, out)
+	return metricsSend(m, data, sendMetrics, alwaysReport, baseURL, reportBasePath, in, out, opts...)
+}
+
+// volatileReportFields change on almost every collection, without the machine itself changing
+var volatileReportFields = []string{
+	"UptimeBucket", "uptime_bucket",
+	"FailedUnitsCount", "failed_units_count",
+	"CollectionTimeBucket", "collection_time_bucket",
+}
+
+// sameReport returns if reports a and b only differ by their volatile fields
+func sameReport(a, b []byte) bool {
+	var fieldsA, fieldsB map[string]json.RawMessage
+	if err := json.Unmarshal(a, &fieldsA); err != nil {
+		return bytes.Equal(a, b)
+	}
+	if err := json.Unmarshal(b, &fieldsB); err != nil {
+		return false
+	}
+	for _, f := range volatileReportFields {
+		delete(fieldsA, f)
+		delete(fieldsB, f)
+	}
+	if len(fieldsA) != len(fieldsB) {
+		return false
+	}
+	for k, v := range fieldsA {
+		w, ok := fieldsB[k]
+		if !ok || compactJSON(v) != compactJSON(w) {
+			return false
+		}
+	}
+	return true
+}
+
+// confirmServer asks the user if the non default destination host is the expected one
+func confirmServer(baseURL string, scanner *bufio.Scanner, out io.Writer) (bool, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return false, errors.Wrapf(err, "report destination url is invalid")
+	}
+	host := u.Host
+	if host == "" {
+		host = baseURL
+	}
+
+	for {
+		fmt.Fprintf(out, "The report will be sent to %s, which isn't the default server. Do you want to continue? [y/N] ", host)
+		if !scanner.Scan() {
+			log.Info("programm interrupted")
+			return false, nil
+		}
+		text := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if text == "y" || text == "yes" {
+			return true, nil
+		} else if text == "n" || text == "no" || text == "" {
+			return false, nil
+		}
+		log.Error("we didn't understand your answer")
+	}
+}
+
+// remindLater records that the user deferred their decision, without sending anything
+func remindLater(reportBasePath string) error {
+	p, err := utils.RemindLaterPath(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where to save the reminder on disk")
+	}
+	if err := saveMetrics(p, []byte(time.Now().Format(time.RFC3339Nano))); err != nil {
+		return errors.Wrapf(err, "couldn't save the reminder on disk")
+	}
+	return nil
+}
+
+// remindLaterUntil returns until when the user asked to not be prompted again, if they deferred their decision
+func remindLaterUntil(reportBasePath string) (time.Time, bool) {
+	p, err := utils.RemindLaterPath(reportBasePath)
+	if err != nil {
+		log.Infof("couldn't get where the reminder is stored on disk: "+utils.ErrFormat, err)
+		return time.Time{}, false
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Infof("couldn't read the reminder: "+utils.ErrFormat, err)
+		}
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
+	if err != nil {
+		log.Infof("reminder %s isn't a valid time: "+utils.ErrFormat, p, err)
+		return time.Time{}, false
+	}
+	until := t.Add(remindLaterCooldown)
+	return until, time.Now().Before(until)
+}
+
+// removeRemindLater deletes the reminder once a report or opt-out was sent
+func removeRemindLater(reportBasePath string) {
+	p, err := utils.RemindLaterPath(reportBasePath)
+	if err != nil {
+		log.Infof("couldn't get where the reminder is stored on disk: "+utils.ErrFormat, err)
+		return
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		log.Infof("couldn't remove the reminder: "+utils.ErrFormat, err)
+	}
+}
+
+// saveDraft keeps the report reviewed by the user, to offer sending it on next interactive report
+func saveDraft(reportBasePath string, data []byte) error {
+	p, err := utils.DraftReportPath(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where to save the draft report on disk")
+	}
+	if err := saveMetrics(p, data); err != nil {
+		return errors.Wrapf(err, "couldn't save the draft report on disk")
+	}
+	return nil
+}
+
+// loadDraft returns the draft report saved on quit, if any and if it is for the current version
+func loadDraft(version, reportBasePath string) []byte {
+	p, err := utils.DraftReportPath(reportBasePath)
+	if err != nil {
+		log.Infof("couldn't get where the draft report is stored on disk: "+utils.ErrFormat, err)
+		return nil
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Infof("couldn't read the draft report: "+utils.ErrFormat, err)
+		}
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		log.Infof("draft report %s is malformed, discarding it: "+utils.ErrFormat, p, err)
+		removeDraft(reportBasePath)
+		return nil
+	}
+	v, ok := fields[mandatoryReportField]
+	if !ok {
+		v = fields[mandatorySnakeCaseReportField]
+	}
+	var draftVersion string
+	if err := json.Unmarshal(v, &draftVersion); err != nil || draftVersion != version {
+		log.Infof("draft report %s isn't for version %s, discarding it", p, version)
+		removeDraft(reportBasePath)
+		return nil
+	}
+	return data
+}
+
+// confirmDraft asks the user if the draft report they already reviewed should be sent.
+// answered is false if the program was interrupted before the user answered.
+func confirmDraft(scanner *bufio.Scanner, out io.Writer) (send, answered bool) {
+	for {
+		fmt.Fprintf(out, "A report you already reviewed was saved. Do you want to send it? [Y (send it)/n (collect a new report)] ")
+		if !scanner.Scan() {
+			log.Info("programm interrupted")
+			return false, false
+		}
+		text := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if text == "y" || text == "yes" || text == "" {
+			return true, true
+		} else if text == "n" || text == "no" {
+			return false, true
+		}
+		log.Error("we didn't understand your answer")
+	}
+}
+
+// removeDraft deletes the draft report once a report or opt-out was sent, or once it was discarded
+func removeDraft(reportBasePath string) {
+	p, err := utils.DraftReportPath(reportBasePath)
+	if err != nil {
+		log.Infof("couldn't get where the draft report is stored on disk: "+utils.ErrFormat, err)
+		return
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		log.Infof("couldn't remove the draft report: "+utils.ErrFormat, err)
+	}
 }
 
 func metricsCollectAndSendOnUpgrade(m metrics.Metrics, alwaysReport bool, baseURL string, reportBasePath string, in io.Reader, out io.Writer) error {
 	distro, version, err := m.GetIDS()
 	if err != nil {
-		return errors.Wrapf(err, "couldn't get mandatory information")
+		return withKind(ErrNoIDs, errors.Wrapf(err, "couldn't get mandatory information"))
 	}
 
 	if _, err := checkPreviousReport(distro, version, reportBasePath, alwaysReport); err != nil {
@@ -155,6 +727,11 @@ func metricsCollectAndSendOnUpgrade(m metrics.Metrics, alwaysReport bool, baseUR
 	if err != nil {
 		return errors.Wrapf(err, "not able to read latest report content")
 	}
+	if !json.Valid(b) {
+		// the previous answer is unknown: let the user be asked again on this version
+		log.Infof("latest report in %s is truncated or malformed, no upgrade report to generate then", latestReportFile)
+		return nil
+	}
 	if strings.TrimSpace(string(b)) != optOutJSON {
 		r = ReportAuto
 	}
@@ -162,6 +739,78 @@ func metricsCollectAndSendOnUpgrade(m metrics.Metrics, alwaysReport bool, baseUR
 	return metricsCollectAndSend(m, r, alwaysReport, baseURL, reportBasePath, in, out)
 }
 
+// diffWithLastReport returns a human readable diff, field by field, of data against the last sent report.
+// nil is returned if there is no previous report to compare with, or if it was an opt-out message.
+func diffWithLastReport(distro, reportBasePath string, data []byte) []string {
+	p, err := getLastReport(distro, reportBasePath, true)
+	if err != nil || p == "" {
+		log.Debug("no previous report to compare with")
+		return nil
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		log.Infof("couldn't read previous report: "+utils.ErrFormat, err)
+		return nil
+	}
+	if strings.TrimSpace(string(b)) == optOutJSON {
+		log.Debug("previous report was an opt-out message, nothing to compare with")
+		return nil
+	}
+
+	var previous, current map[string]json.RawMessage
+	if err := json.Unmarshal(b, &previous); err != nil {
+		log.Infof("couldn't parse previous report: "+utils.ErrFormat, err)
+		return nil
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		log.Infof("couldn't parse collected report: "+utils.ErrFormat, err)
+		return nil
+	}
+
+	keys := make(map[string]bool)
+	for k := range previous {
+		keys[k] = true
+	}
+	for k := range current {
+		keys[k] = true
+	}
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	diff := []string{}
+	unchanged := 0
+	for _, k := range sorted {
+		oldV, hadOld := previous[k]
+		newV, hasNew := current[k]
+		switch {
+		case !hadOld:
+			diff = append(diff, fmt.Sprintf("+ %s: %s", k, compactJSON(newV)))
+		case !hasNew:
+			diff = append(diff, fmt.Sprintf("- %s: %s", k, compactJSON(oldV)))
+		case compactJSON(oldV) != compactJSON(newV):
+			diff = append(diff, fmt.Sprintf("~ %s: %s -> %s", k, compactJSON(oldV), compactJSON(newV)))
+		default:
+			unchanged++
+		}
+	}
+	if len(diff) == 0 {
+		return []string{"Nothing changed since the last report."}
+	}
+	return append(diff, fmt.Sprintf("(%d unchanged fields)", unchanged))
+}
+
+// compactJSON returns v without insignificant spaces
+func compactJSON(v json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, v); err != nil {
+		return string(v)
+	}
+	return b.String()
+}
+
 func saveMetrics(p string, data []byte) error {
 	log.Debugf("save sent metrics to %s", p)
 
@@ -170,13 +819,141 @@ func saveMetrics(p string, data []byte) error {
 		return errors.Wrap(err, "couldn't create parent directory to save reported metrics")
 	}
 
-	if err := ioutil.WriteFile(p, data, 0666); err != nil {
+	// write to a temporary file renamed once complete, so that an interrupted write never leaves a truncated report
+	f, err := ioutil.TempFile(d, "."+filepath.Base(p)+".")
+	if err != nil {
+		return errors.Wrap(err, "couldn't save reported or pending metrics on disk")
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "couldn't save reported or pending metrics on disk")
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return errors.Wrap(err, "couldn't save reported or pending metrics on disk")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "couldn't save reported or pending metrics on disk")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "couldn't save reported or pending metrics on disk")
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
 		return errors.Wrap(err, "couldn't save reported or pending metrics on disk")
 	}
 
 	return nil
 }
 
+// appendHistory adds entry as a new line to the history log in p.
+// The log is rotated to only keep the last maxEntries entries.
+func appendHistory(p string, entry []byte, maxEntries int) error {
+	log.Debugf("append entry to history log %s", p)
+
+	var entries [][]byte
+	b, err := ioutil.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "couldn't read history log")
+	}
+	for _, e := range bytes.Split(b, []byte("\n")) {
+		if len(e) == 0 {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	entries = append(entries, bytes.TrimSpace(entry))
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+
+	return saveMetrics(p, append(bytes.Join(entries, []byte("\n")), '\n'))
+}
+
+// recordHistory appends data, along with the current date, as a single JSON line to the history log.
+// Failing to record it doesn't prevent the report from being considered as sent.
+func recordHistory(reportBasePath string, data []byte) {
+	p, err := utils.HistoryPath(reportBasePath)
+	if err != nil {
+		log.Infof("couldn't get where the reports history is stored on disk: "+utils.ErrFormat, err)
+		return
+	}
+	entry, err := json.Marshal(struct {
+		Date   time.Time
+		Report json.RawMessage
+	}{time.Now(), data})
+	if err != nil {
+		log.Infof("couldn't format report for the history: "+utils.ErrFormat, err)
+		return
+	}
+	if err := appendHistory(p, entry, maxHistoryEntries); err != nil {
+		log.Infof("couldn't append report to the history: "+utils.ErrFormat, err)
+	}
+}
+
+var installIDRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// installID returns the random install ID stored in the cache directory.
+// A new one is generated on first use, or if the stored one is invalid, and is only saved if save is true.
+func installID(reportBasePath string, save bool) (string, error) {
+	p, err := utils.InstallIDPath(reportBasePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't get where the install ID is stored on disk")
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err == nil {
+		id := strings.TrimSpace(string(b))
+		if installIDRegexp.MatchString(id) {
+			return id, nil
+		}
+		log.Infof("install ID in %s is invalid, generating a new one", p)
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrapf(err, "couldn't read install ID")
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	if !save {
+		return id, nil
+	}
+	if err := saveMetrics(p, []byte(id+"\n")); err != nil {
+		return "", errors.Wrapf(err, "couldn't save install ID")
+	}
+	return id, nil
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	u := make([]byte, 16)
+	if _, err := crand.Read(u); err != nil {
+		return "", errors.Wrapf(err, "couldn't generate a random ID")
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// metricsHasReported returns if a report or opt-out was already sent for the current distribution and version
+func metricsHasReported(m metrics.Metrics, reportBasePath string) (bool, error) {
+	distro, version, err := m.GetIDS()
+	if err != nil {
+		return false, withKind(ErrNoIDs, errors.Wrapf(err, "couldn't get mandatory information"))
+	}
+
+	p, err := utils.ReportPath(distro, version, reportBasePath)
+	if err != nil {
+		return false, errors.Wrapf(err, "couldn't get where to save reported metrics on disk")
+	}
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return false, nil
+	}
+	return true, nil
+}
+
 func checkPreviousReport(distro, version, reportBasePath string, alwaysReport bool) (string, error) {
 	p, err := utils.ReportPath(distro, version, reportBasePath)
 	if err != nil {
@@ -185,7 +962,7 @@ func checkPreviousReport(distro, version, reportBasePath string, alwaysReport bo
 	if _, err := os.Stat(p); !os.IsNotExist(err) {
 		log.Infof("previous report found in %s", p)
 		if !alwaysReport {
-			return "", errors.Errorf("metrics from this machine have already been reported and can be found in: %s", p)
+			return "", withKind(ErrAlreadyReported, errors.Errorf("metrics from this machine have already been reported and can be found in: %s", p))
 		}
 		log.Debug("ignore previous report requested")
 	}
@@ -211,10 +988,12 @@ func getLastReport(distro, reportBasePath string, alwaysReport bool) (string, er
 	return newestReport, nil
 }
 
-func metricsSendPendingReport(m metrics.Metrics, baseURL, reportBasePath string, in io.Reader, out io.Writer) error {
+func metricsSendPendingReport(m metrics.Metrics, baseURL, reportBasePath string, in io.Reader, out io.Writer, opts ...Option) error {
+	o := newOptions(opts)
+
 	distro, version, err := m.GetIDS()
 	if err != nil {
-		return errors.Wrapf(err, "couldn't get mandatory information")
+		return withKind(ErrNoIDs, errors.Wrapf(err, "couldn't get mandatory information"))
 	}
 
 	reportP, err := utils.ReportPath(distro, version, reportBasePath)
@@ -222,39 +1001,359 @@ func metricsSendPendingReport(m metrics.Metrics, baseURL, reportBasePath string,
 		return errors.Wrapf(err, "couldn't get where to save reported metrics on disk")
 	}
 
-	pending, err := utils.PendingReportPath(reportBasePath)
+	pending, err := pendingReportPath(reportBasePath, o)
 	if err != nil {
 		return errors.Wrapf(err, "couldn't get where to previous reported metrics are on disk")
 	}
 	data, err := ioutil.ReadFile(pending)
+	if os.IsNotExist(err) {
+		return withKind(ErrNoPendingReport, errors.Wrapf(err, "no pending report found"))
+	} else if err != nil {
+		return errors.Wrapf(err, "couldn't read pending report")
+	}
+
+	u, err := sender.GetURL(serverURL(m, baseURL), distro, version)
 	if err != nil {
-		return errors.Wrapf(err, "no pending report found")
+		return errors.Wrapf(err, "report destination url is invalid")
 	}
 
-	if baseURL == "" {
-		baseURL = sender.BaseURL
+	lastSendP, err := utils.LastSendPath(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where to store last sending time on disk")
 	}
-	u, err := sender.GetURL(baseURL, distro, version)
+	if next, limited := nextPendingSend(lastSendP); limited {
+		return withKind(ErrRateLimited, errors.Errorf("a pending report was sent recently, not sending again before %s", next.Format(time.RFC3339)))
+	}
+
+	retryP, err := utils.RetryStatePath(reportBasePath)
 	if err != nil {
-		return errors.Wrapf(err, "report destination url is invalid")
+		return errors.Wrapf(err, "couldn't get where to store retry state on disk")
+	}
+
+	if err := sendWithBackoff(o.ctx, func() error { return postReport(o, u, data) }, retryP, o.maxAttempts); err != nil {
+		return withKind(ErrPendingWritten, errors.Wrapf(err, "pending report kept for a later automated report"))
+	}
+	if err := saveMetrics(lastSendP, []byte(time.Now().Format(time.RFC3339Nano))); err != nil {
+		log.Infof("couldn't save last sending time: "+utils.ErrFormat, err)
+	}
+
+	if err := os.Remove(pending); err != nil {
+		return errors.Wrapf(err, "couldn't remove pending report after a successful report")
+	}
+	return saveMetrics(reportP, data)
+}
+
+// nextPendingSend returns when the next pending report can be sent, and if it's still in the future
+func nextPendingSend(lastSendP string) (time.Time, bool) {
+	b, err := ioutil.ReadFile(lastSendP)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Infof("couldn't read last sending time: "+utils.ErrFormat, err)
+		}
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
+	if err != nil {
+		log.Infof("last sending time in %s isn't a valid time: "+utils.ErrFormat, lastSendP, err)
+		return time.Time{}, false
+	}
+	now := time.Now()
+	if t.After(now) {
+		log.Infof("last sending time %s is in the future, system clock probably changed", t.Format(time.RFC3339))
+		return time.Time{}, false
+	}
+	next := t.Add(minPendingSendInterval)
+	return next, now.Before(next)
+}
+
+// sendWithBackoff calls send, exponentially backing off until it succeeds,
+// maxAttempts were made or ctx is done. 0 or less means retrying until it succeeds.
+// The next allowed attempt time is persisted in retryP so that subsequent invocations
+// don't try before it, if the process was killed in between or gave up.
+func sendWithBackoff(ctx context.Context, send func() error, retryP string, maxAttempts int) error {
+	if next, err := loadNextRetry(retryP); err == nil {
+		if time.Now().Before(next) {
+			return errors.Errorf("previous sending attempt failed, not retrying before %s", next.Format(time.RFC3339))
+		}
+	} else if !os.IsNotExist(errors.Cause(err)) {
+		log.Infof("ignoring invalid retry state: "+utils.ErrFormat, err)
 	}
 
 	wait := time.Duration(initialReportTimeoutDuration)
-	for {
-		if err := sender.Send(u, data); err != nil {
-			log.Errorf("data were not delivered successfully to metrics server, retrying in %ds", wait/(1000*1000*1000))
-			time.Sleep(wait)
+	for attempt := 1; ; attempt++ {
+		if err := send(); err != nil {
+			d := wait + time.Duration(rand.Float64()*reportTimeoutJitter*float64(wait))
+			// saved even when giving up, so that the next invocation waits too
+			if err := saveMetrics(retryP, []byte(time.Now().Add(d).Format(time.RFC3339Nano))); err != nil {
+				log.Infof("couldn't save retry state: "+utils.ErrFormat, err)
+			}
+			if maxAttempts > 0 && attempt >= maxAttempts {
+				return errors.Wrapf(err, "data were not delivered successfully to metrics server after %d attempts", attempt)
+			}
+			if ctx.Err() != nil {
+				return errors.Wrapf(err, "data were not delivered successfully to metrics server before cancellation")
+			}
+			log.Errorf("data were not delivered successfully to metrics server, retrying in %ds", d/(1000*1000*1000))
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				return errors.Wrapf(ctx.Err(), "sending was cancelled while backing off")
+			}
 			wait = wait * 2
-			if wait > time.Duration(30*time.Minute) {
-				wait = time.Duration(30 * time.Minute)
+			if wait > maxReportTimeoutDuration {
+				wait = maxReportTimeoutDuration
 			}
 			continue
 		}
-		break
+		if err := os.Remove(retryP); err != nil && !os.IsNotExist(err) {
+			log.Infof("couldn't remove retry state: "+utils.ErrFormat, err)
+		}
+		return nil
 	}
+}
 
-	if err := os.Remove(pending); err != nil {
-		return errors.Wrapf(err, "couldn't remove pending report after a successful report")
+// sendPrepared sends data to u, backing off like sendWithBackoff. In stateless mode, it's sent only
+// once without reading nor writing any retry state.
+func sendPrepared(o options, u string, data []byte, retryP string) error {
+	if o.stateless {
+		return postReport(o, u, data)
 	}
-	return saveMetrics(reportP, data)
+	return sendWithBackoff(o.ctx, func() error { return postReport(o, u, data) }, retryP, o.maxAttempts)
+}
+
+// loadNextRetry returns the next allowed sending attempt time stored in p
+func loadNextRetry(p string) (time.Time, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "couldn't read retry state")
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(b)))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "retry state %s isn't a valid time", p)
+	}
+	return t, nil
+}
+
+// spoolMetadata is stored as the first line of each spooled report
+type spoolMetadata struct {
+	Distro  string
+	Version string
+	Date    time.Time
+}
+
+func metricsSpool(m metrics.Metrics, data []byte, reportBasePath string) error {
+	distro, version, err := m.GetIDS()
+	if err != nil {
+		return withKind(ErrNoIDs, errors.Wrapf(err, "couldn't get mandatory information"))
+	}
+
+	d, err := utils.SpoolDir(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where spooled reports should be stored on disk")
+	}
+
+	now := time.Now()
+	meta, err := json.Marshal(spoolMetadata{Distro: distro, Version: version, Date: now})
+	if err != nil {
+		return errors.Wrapf(err, "couldn't serialize spooled report metadata")
+	}
+
+	p := filepath.Join(d, fmt.Sprintf("%s.%s.%d", distro, version, now.UnixNano()))
+	return saveMetrics(p, append(append(meta, '\n'), data...))
+}
+
+func metricsFlushSpool(m metrics.Metrics, baseURL, reportBasePath string, opts ...Option) error {
+	o := newOptions(opts)
+
+	d, err := utils.SpoolDir(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where spooled reports are on disk")
+	}
+
+	files, err := ioutil.ReadDir(d)
+	if os.IsNotExist(err) {
+		log.Info("no spooled report to send")
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "couldn't list spooled reports")
+	}
+
+	baseURL = serverURL(m, baseURL)
+	retryP, err := utils.SpoolRetryStatePath(reportBasePath)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get where to store retry state on disk")
+	}
+
+	for _, f := range files {
+		// skip reports still being written, or left over by an interrupted write
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		p := filepath.Join(d, f.Name())
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't read spooled report %s", p)
+		}
+		meta, data, err := parseSpooledReport(b)
+		if err != nil {
+			log.Errorf("ignoring invalid spooled report %s: "+utils.ErrFormat, p, err)
+			continue
+		}
+
+		u, err := sender.GetURL(baseURL, meta.Distro, meta.Version)
+		if err != nil {
+			return errors.Wrapf(err, "report destination url is invalid")
+		}
+		reportP, err := utils.ReportPath(meta.Distro, meta.Version, reportBasePath)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't get where to save reported metrics on disk")
+		}
+
+		collected := strings.TrimSpace(string(data)) != optOutJSON
+		if data, err = prepareReport(o, meta.Distro, data, collected); err != nil {
+			log.Errorf("ignoring spooled report %s: "+utils.ErrFormat, p, err)
+			continue
+		}
+		if err := sendPrepared(o, u, data, retryP); err != nil {
+			return errors.Wrapf(err, "spooled report %s kept for a later flush", p)
+		}
+
+		if err := os.Remove(p); err != nil {
+			return errors.Wrapf(err, "couldn't remove spooled report after a successful report")
+		}
+		if o.stateless {
+			continue
+		}
+		if err := saveMetrics(reportP, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func metricsSendSpool(m metrics.Metrics, dir, baseURL, reportBasePath string, opts ...Option) (int, error) {
+	o := newOptions(opts)
+	// keep failing reports for the next call instead of retrying forever on the first one
+	if o.maxAttempts <= 0 {
+		o.maxAttempts = 1
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "couldn't list reports to send")
+	}
+
+	baseURL = serverURL(m, baseURL)
+	if _, err := sender.GetURL(baseURL, "", ""); err != nil {
+		return 0, errors.Wrapf(err, "report destination url is invalid")
+	}
+	retryP, err := utils.SpoolRetryStatePath(reportBasePath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "couldn't get where to store retry state on disk")
+	}
+
+	var sent, failed int
+	for _, f := range files {
+		// skip reports still being written, or left over by an interrupted write
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		p := filepath.Join(dir, f.Name())
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			log.Errorf("couldn't read report %s: "+utils.ErrFormat, p, err)
+			failed++
+			continue
+		}
+		meta, data := readSpooledReport(b)
+		// bare reports are sent for the distribution of this machine
+		distro := meta.Distro
+		if distro == "" {
+			if distro, _, err = m.GetIDS(); err != nil {
+				log.Errorf("keeping report %s without distribution: "+utils.ErrFormat, p, err)
+				failed++
+				continue
+			}
+		}
+		collected := strings.TrimSpace(string(data)) != optOutJSON
+		if data, err = prepareReport(o, distro, data, collected); err != nil {
+			log.Errorf("keeping report %s: "+utils.ErrFormat, p, err)
+			failed++
+			continue
+		}
+		version := meta.Version
+		if version == "" {
+			version = reportVersion(data)
+		}
+		if version == "" {
+			log.Errorf("keeping report %s: "+utils.ErrFormat, p, errors.New("couldn't find the distribution version it was collected on"))
+			failed++
+			continue
+		}
+		u, err := sender.GetURL(baseURL, distro, version)
+		if err != nil {
+			return sent, errors.Wrapf(err, "report destination url is invalid")
+		}
+		if err := sendPrepared(o, u, data, retryP); err != nil {
+			log.Errorf("report %s kept for a later try: "+utils.ErrFormat, p, err)
+			failed++
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			return sent, errors.Wrapf(err, "couldn't remove report %s after a successful report", p)
+		}
+		sent++
+	}
+
+	if failed > 0 {
+		return sent, errors.Errorf("%d reports couldn't be sent and were kept in %s", failed, dir)
+	}
+	return sent, nil
+}
+
+// reportVersion returns the distribution version data was collected on, from its mandatory field.
+// An empty string is returned if it can't be found.
+func reportVersion(data []byte) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ""
+	}
+	v, ok := fields[mandatoryReportField]
+	if !ok {
+		v = fields[mandatorySnakeCaseReportField]
+	}
+	var version string
+	if err := json.Unmarshal(v, &version); err != nil {
+		return ""
+	}
+	return version
+}
+
+// readSpooledReport returns the report of a spool file, stripping the metadata header of reports
+// spooled by ReportSpool. Other files, like reports copied from other machines, are returned as is
+// with empty metadata.
+func readSpooledReport(b []byte) (spoolMetadata, []byte) {
+	meta, data, err := parseSpooledReport(b)
+	if err != nil {
+		return spoolMetadata{}, b
+	}
+	return meta, data
+}
+
+func parseSpooledReport(b []byte) (spoolMetadata, []byte, error) {
+	var meta spoolMetadata
+
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return meta, nil, errors.New("no metadata header found")
+	}
+	if err := json.Unmarshal(b[:i], &meta); err != nil {
+		return meta, nil, errors.Wrapf(err, "metadata header isn't valid")
+	}
+	if meta.Distro == "" || meta.Version == "" {
+		return meta, nil, errors.Errorf("distribution '%s' or version '%s' information missing", meta.Distro, meta.Version)
+	}
+
+	return meta, b[i+1:], nil
 }
@@ -3,22 +3,37 @@ package sysmetrics
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ubuntu/ubuntu-report/internal/helper"
 	"github.com/ubuntu/ubuntu-report/internal/metrics"
+	"github.com/ubuntu/ubuntu-report/internal/sender"
 )
 
 var Update = flag.Bool("update", false, "update golden files")
@@ -102,6 +117,97 @@ func TestMetricsCollect(t *testing.T) {
 	}
 }
 
+func TestMetricsMarshalReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		opts []func(*metrics.Metrics) error
+	}{
+		{"regular", nil},
+		{"snake case", []func(*metrics.Metrics) error{metrics.WithSnakeCase()}},
+		{"extra fields", []func(*metrics.Metrics) error{metrics.WithExtraFields(map[string]interface{}{"Fleet": "a"})}},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			newMetrics := func() (metrics.Metrics, func()) {
+				m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+					cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t, "testdata/good",
+					"one gpu", "regular", "one screen", "one partition", "regular", "regular", "regular", nil)
+				for _, opt := range tc.opts {
+					if err := opt(&m); err != nil {
+						t.Fatal("couldn't set metrics option", err)
+					}
+				}
+				return m, func() {
+					cancelGPU()
+					cancelCPU()
+					cancelScreen()
+					cancelPartition()
+					cancelArchitecture()
+					cancelLibc6()
+					cancelHwCap()
+				}
+			}
+			m, cancel := newMetrics()
+			defer cancel()
+			want, err := metricsCollect(m)
+			if err != nil {
+				t.Fatal("couldn't collect report", err)
+			}
+
+			m, cancel = newMetrics()
+			defer cancel()
+			got, err := metricsMarshalReport(m, m.CollectReport())
+
+			a.CheckWantedErr(err, false)
+			a.Equal(string(got), string(want))
+		})
+	}
+}
+
+func TestMetricsSelfTest(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		root string
+
+		wantIDsStatus string
+		wantErr       bool
+	}{
+		{"regular", "testdata/good", "ok", false},
+		{"missing os-release", "testdata/no-ids", "failed", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics(tc.root, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			got, err := metricsSelfTest(m)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if len(got) < 1 {
+				t.Fatal("expected collectors status, got none")
+			}
+			a.Equal(got[0].Name, "IDs")
+			a.Equal(got[0].Mandatory, true)
+			a.Equal(got[0].Status, tc.wantIDsStatus)
+			for _, c := range got[1:] {
+				if c.Mandatory {
+					t.Errorf("only IDs collector should be mandatory, got %s", c.Name)
+				}
+			}
+		})
+	}
+}
+
 func TestMetricsSend(t *testing.T) {
 	t.Parallel()
 
@@ -119,23 +225,35 @@ func TestMetricsSend(t *testing.T) {
 		wantErr         bool
 	}{
 		{"send data",
-			"testdata/good", []byte(`{ "some-data": true }`), true, "",
+			"testdata/good", []byte(`{ "Version": "18.04", "some-data": true }`), true, "",
 			"ubuntu-report/ubuntu.18.04", "", true, "/ubuntu/desktop/18.04", false},
 		{"nack send data",
-			"testdata/good", []byte(`{ "some-data": true }`), false, "",
+			"testdata/good", []byte(`{ "Version": "18.04", "some-data": true }`), false, "",
 			"ubuntu-report/ubuntu.18.04", "", true, "/ubuntu/desktop/18.04", false},
+		{"derivative distribution",
+			"testdata/derivative", []byte(`{ "Version": "18.04", "some-data": true }`), true, "",
+			"ubuntu-report/neon.22.04", "", true, "/neon/desktop/22.04", false},
 		{"no IDs (mandatory)",
-			"testdata/no-ids", []byte(`{ "some-data": true }`), true, "",
+			"testdata/no-ids", []byte(`{ "Version": "18.04", "some-data": true }`), true, "",
 			"ubuntu-report", "", false, "", true},
 		{"no network",
-			"testdata/good", []byte(`{ "some-data": true }`), true, "http://localhost:4299",
+			"testdata/good", []byte(`{ "Version": "18.04", "some-data": true }`), true, "http://localhost:4299",
 			"ubuntu-report", "ubuntu-report/pending", false, "", true},
 		{"invalid URL",
-			"testdata/good", []byte(`{ "some-data": true }`), true, "http://a b.com/",
+			"testdata/good", []byte(`{ "Version": "18.04", "some-data": true }`), true, "http://a b.com/",
 			"ubuntu-report", "", false, "", true},
 		{"unwritable path",
-			"testdata/good", []byte(`{ "some-data": true }`), true, "",
+			"testdata/good", []byte(`{ "Version": "18.04", "some-data": true }`), true, "",
 			"/unwritable/cache/path", "", true, "/ubuntu/desktop/18.04", true},
+		{"malformed data",
+			"testdata/good", []byte(`{ "Version": "18.04", "some-data": `), true, "",
+			"ubuntu-report", "", false, "", true},
+		{"missing mandatory field",
+			"testdata/good", []byte(`{ "some-data": true }`), true, "",
+			"ubuntu-report", "", false, "", true},
+		{"nack malformed data",
+			"testdata/good", []byte(`{ "some-data": `), false, "",
+			"ubuntu-report/ubuntu.18.04", "", true, "/ubuntu/desktop/18.04", false},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -205,119 +323,284 @@ func TestMetricsSend(t *testing.T) {
 	}
 }
 
-func TestMultipleMetricsSend(t *testing.T) {
+func TestMetricsSendErrorKinds(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		name         string
-		alwaysReport bool
+		name            string
+		root            string
+		manualServerURL string
+		alreadyReported bool
 
-		cacheReportP    string
-		shouldHitServer bool
-		sHitHat         string
-		wantErr         bool
+		want error
 	}{
-		{"fail report twice", false, "ubuntu-report/ubuntu.18.04", false, "/ubuntu/desktop/18.04", true},
-		{"forcing report twice", true, "ubuntu-report/ubuntu.18.04", true, "/ubuntu/desktop/18.04", false},
+		{"already reported", "testdata/good", "", true, ErrAlreadyReported},
+		{"no network", "testdata/good", "http://localhost:4299", false, ErrPendingWritten},
+		{"no IDs", "testdata/no-ids", "", false, ErrNoIDs},
+		{"invalid URL", "testdata/good", "http://a b.com/", false, nil},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			a := helper.Asserter{T: t}
 
-			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			m := metrics.NewTestMetrics(tc.root, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
-			serverHitAt := ""
-			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				serverHitAt = r.URL.String()
-			}))
+			if tc.alreadyReported {
+				if err := saveMetrics(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"), []byte(`{ "Version": "18.04" }`)); err != nil {
+					t.Fatal("couldn't seed previous report", err)
+				}
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 			defer ts.Close()
-
-			err := metricsSend(m, []byte(`{ "some-data": true }`), true, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
-			if err != nil {
-				t.Fatal("Didn't expect first call to fail")
+			url := tc.manualServerURL
+			if url == "" {
+				url = ts.URL
 			}
 
-			// second call, reset server
-			serverHitAt = ""
-			m = metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
-			err = metricsSend(m, []byte(`{ "some-data": true }`), true, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+			err := metricsSend(m, []byte(`{ "Version": "18.04", "some-data": true }`), true, false, url, out, os.Stdout, os.Stdin)
 
-			a.CheckWantedErr(err, tc.wantErr)
-			// check we didn't do too much work on error
-			if err != nil {
-				if !tc.shouldHitServer {
-					a.Equal(serverHitAt, "")
-				}
-				if tc.shouldHitServer && serverHitAt == "" {
-					t.Error("we should have hit the local server and we didn't")
-				}
-				return
-			}
-			a.Equal(serverHitAt, tc.sHitHat)
-			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
-			if err != nil {
-				t.Fatal("didn't generate a report file on disk", err)
+			if err == nil {
+				t.Fatal("we expected an error and got none")
 			}
-			got, err := ioutil.ReadAll(gotF)
-			if err != nil {
-				t.Fatal("couldn't read generated report file", err)
+			for _, kind := range []error{ErrAlreadyReported, ErrPendingWritten, ErrNoIDs} {
+				if got := errors.Is(err, kind); got != (kind == tc.want) {
+					t.Errorf("errors.Is(%v, %v) = %t, expected %t", err, kind, got, !got)
+				}
 			}
-			want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata/good", "gold", fmt.Sprintf("metricssend_twice.%s", strings.Replace(tc.name, " ", "_", -1))), got, *Update)
-			a.Equal(got, want)
 		})
 	}
 }
 
-func TestMetricsCollectAndSend(t *testing.T) {
+func TestMetricsCollectAndSendDryRun(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+		cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t, "testdata/good",
+		"one gpu", "regular", "one screen", "one partition",
+		"regular", "regular", "regular",
+		map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12"})
+	defer cancelGPU()
+	defer cancelCPU()
+	defer cancelScreen()
+	defer cancelPartition()
+	defer cancelArchitecture()
+	defer cancelLibc6()
+	defer cancelHwCap()
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	serverHit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	defer ts.Close()
+	var stdout bytes.Buffer
+
+	err := metricsCollectAndSend(m, ReportDryRun, false, ts.URL, out, os.Stdin, &stdout)
+
+	if err != nil {
+		t.Fatal("we didn't expect an error on dry run and got:", err)
+	}
+	want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata/good", "gold", "metricsdryrun"), stdout.Bytes(), *Update)
+	a.Equal(stdout.Bytes(), want)
+	a.Equal(serverHit, false)
+	if _, err := os.Stat(filepath.Join(out, "ubuntu-report")); !os.IsNotExist(err) {
+		t.Errorf("we expected no report nor pending report to be saved, got: %v", err)
+	}
+}
+
+func TestMetricsCollectAndSendDryRunAlreadyReported(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+		cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t, "testdata/good",
+		"one gpu", "regular", "one screen", "one partition",
+		"regular", "regular", "regular",
+		map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12"})
+	defer cancelGPU()
+	defer cancelCPU()
+	defer cancelScreen()
+	defer cancelPartition()
+	defer cancelArchitecture()
+	defer cancelLibc6()
+	defer cancelHwCap()
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	reportP := filepath.Join(out, "ubuntu-report", "ubuntu.18.04")
+	if err := saveMetrics(reportP, []byte(optOutJSON)); err != nil {
+		t.Fatal("couldn't create previous report", err)
+	}
+	serverHit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	defer ts.Close()
+	var stdout bytes.Buffer
+
+	err := metricsCollectAndSend(m, ReportDryRun, false, ts.URL, out, os.Stdin, &stdout)
+
+	if err != nil {
+		t.Fatal("we didn't expect an error on dry run with a previous report and got:", err)
+	}
+	want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata/good", "gold", "metricsdryrun"), stdout.Bytes(), false)
+	a.Equal(stdout.Bytes(), want)
+	a.Equal(serverHit, false)
+	got, err := ioutil.ReadFile(reportP)
+	if err != nil {
+		t.Fatal("couldn't read previous report", err)
+	}
+	a.Equal(string(got), optOutJSON)
+}
+
+func TestMetricsSendTimeout(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	closehandler := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		case <-closehandler:
+		}
+	}))
+	defer ts.Close()
+	data := []byte(`{ "Version": "18.04", "some-data": true }`)
+
+	err := metricsSend(m, data, true, false, ts.URL, out, os.Stdin, os.Stdout, WithTimeout(100*time.Millisecond))
+	close(closehandler)
+
+	a.CheckWantedErr(err, true)
+	got, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "pending"))
+	if err != nil {
+		t.Fatal("we expected the report to be saved as pending after a timeout:", err)
+	}
+	a.Equal(got, data)
+	if _, err := os.Stat(filepath.Join(out, "ubuntu-report", "ubuntu.18.04")); !os.IsNotExist(err) {
+		t.Errorf("we expected no report to be saved as sent, got: %v", err)
+	}
+}
+
+func TestMetricsSendWithContext(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	closehandler := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		case <-closehandler:
+		}
+	}))
+	defer ts.Close()
+	data := []byte(`{ "Version": "18.04", "some-data": true }`)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	err := metricsSend(m, data, true, false, ts.URL, out, os.Stdin, os.Stdout, withContext(ctx))
+	close(closehandler)
+
+	a.CheckWantedErr(err, true)
+	got, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "pending"))
+	if err != nil {
+		t.Fatal("we expected the report to be saved as pending after cancellation:", err)
+	}
+	a.Equal(got, data)
+}
+
+func TestMetricsCollectAndSendWithContext(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+		cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t, "testdata/good",
+		"one gpu", "regular", "one screen", "one partition",
+		"regular", "regular", "regular",
+		map[string]string{"LANG": "fr_FR.UTF-8"})
+	defer cancelGPU()
+	defer cancelCPU()
+	defer cancelScreen()
+	defer cancelPartition()
+	defer cancelArchitecture()
+	defer cancelLibc6()
+	defer cancelHwCap()
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	serverHit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := metricsCollectAndSend(m, ReportAuto, false, ts.URL, out, os.Stdin, os.Stdout, withContext(ctx))
+
+	a.CheckWantedErr(err, true)
+	a.Equal(serverHit, false)
+	if _, err := os.Stat(filepath.Join(out, "ubuntu-report")); !os.IsNotExist(err) {
+		t.Errorf("we expected no report nor pending report to be saved, got: %v", err)
+	}
+}
+
+func TestMetricsSendPendingReportWithContext(t *testing.T) {
+	t.Parallel()
+	initialReportTimeoutDuration = 0
+	a := helper.Asserter{T: t}
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	data := []byte(`{ "Version": "18.04", "some-data": true }`)
+	pendingP := filepath.Join(out, "ubuntu-report", "pending")
+	if err := saveMetrics(pendingP, data); err != nil {
+		t.Fatal("couldn't create pending report", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// no attempts limit: only the cancellation stops retrying
+	err := metricsSendPendingReport(m, ts.URL, out, os.Stdin, os.Stdout, withContext(ctx))
+
+	a.CheckWantedErr(err, true)
+	got, err := ioutil.ReadFile(pendingP)
+	if err != nil {
+		t.Fatal("we expected the pending report to be kept after cancellation:", err)
+	}
+	a.Equal(got, data)
+}
+
+func TestMetricsSendTestReport(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		name             string
-		root             string
-		caseGPU          string
-		caseCPU          string
-		caseScreen       string
-		casePartition    string
-		caseArchitecture string
-		caseLibc6        string
-		caseHwCap        string
-		env              map[string]string
-		r                ReportType
-		manualServerURL  string
+		name      string
+		root      string
+		data      []byte
+		allowTest bool
 
-		cacheReportP    string
-		pendingReportP  string
 		shouldHitServer bool
-		sHitHat         string
 		wantErr         bool
 	}{
-		{"regular report auto",
-			"testdata/good", "one gpu", "regular", "one screen",
-			"one partition", "regular", "regular", "regular",
-			map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
-			ReportAuto, "",
-			"ubuntu-report/ubuntu.18.04", "", true, "/ubuntu/desktop/18.04", false},
-		{"regular report OptOut",
-			"testdata/good", "one gpu", "regular", "one screen",
-			"one partition", "regular", "regular", "regular",
-			map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
-			ReportOptOut, "",
-			"ubuntu-report/ubuntu.18.04", "", true, "/ubuntu/desktop/18.04", false},
-		{"no network",
-			"testdata/good", "", "", "", "", "", "", "", nil, ReportAuto,
-			"http://localhost:4299", "ubuntu-report", "ubuntu-report/pending", false, "", true},
-		{"No IDs (mandatory)",
-			"testdata/no-ids", "", "", "", "", "", "", "", nil, ReportAuto,
-			"", "ubuntu-report", "", false, "", true},
-		{"Invalid URL",
-			"testdata/good", "", "", "", "", "", "", "", nil, ReportAuto,
-			"http://a b.com/", "ubuntu-report", "", false, "", true},
-		{"Unwritable path",
-			"testdata/good", "", "", "", "", "", "", "", nil, ReportAuto,
-			"", "/unwritable/cache/path", "", true, "/ubuntu/desktop/18.04", true},
+		{"regular report", "testdata/good", []byte(`{ "Version": "18.04", "some-data": true }`), false, true, false},
+		{"test marker refused", "testdata/good", []byte(`{ "Version": "18.04", "Test": true }`), false, false, true},
+		{"test marker allowed", "testdata/good", []byte(`{ "Version": "18.04", "Test": true }`), true, true, false},
+		{"test distro refused", "testdata/test-distro", []byte(`{ "Version": "18.04", "some-data": true }`), false, false, true},
+		{"test distro allowed", "testdata/test-distro", []byte(`{ "Version": "18.04", "some-data": true }`), true, true, false},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -325,91 +608,42 @@ func TestMetricsCollectAndSend(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
-				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t, tc.root,
-				tc.caseGPU, tc.caseCPU, tc.caseScreen, tc.casePartition,
-				tc.caseArchitecture, tc.caseLibc6, tc.caseHwCap, tc.env)
-			defer cancelGPU()
-			defer cancelCPU()
-			defer cancelScreen()
-			defer cancelPartition()
-			defer cancelArchitecture()
-			defer cancelLibc6()
-			defer cancelHwCap()
+			m := metrics.NewTestMetrics(tc.root, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
-			if strings.HasPrefix(tc.cacheReportP, "/") {
-				// absolute path, override temporary one
-				out = tc.cacheReportP
-			}
-			serverHitAt := ""
+			serverHit := false
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				serverHitAt = r.URL.String()
+				serverHit = true
 			}))
 			defer ts.Close()
-			url := tc.manualServerURL
-			if url == "" {
-				url = ts.URL
+			var opts []Option
+			if tc.allowTest {
+				opts = append(opts, WithTestReportsAllowed())
 			}
 
-			err := metricsCollectAndSend(m, tc.r, false, url, out, os.Stdout, os.Stdin)
+			err := metricsSend(m, tc.data, true, false, ts.URL, out, os.Stdin, os.Stdout, opts...)
 
 			a.CheckWantedErr(err, tc.wantErr)
-			// check we didn't do too much work on error
-			if err != nil {
-				if !tc.shouldHitServer {
-					a.Equal(serverHitAt, "")
-				}
-				if tc.shouldHitServer && serverHitAt == "" {
-					t.Error("we should have hit the local server and it didn't")
-				}
-				if tc.pendingReportP == "" {
-					if _, err := os.Stat(filepath.Join(out, tc.cacheReportP)); !os.IsNotExist(err) {
-						t.Errorf("we didn't expect finding a cache report path as we erroring out")
-					}
-				} else {
-					gotF, err := os.Open(filepath.Join(out, tc.pendingReportP))
-					if err != nil {
-						t.Fatal("didn't generate a pending report file on disk", err)
-					}
-					got, err := ioutil.ReadAll(gotF)
-					if err != nil {
-						t.Fatal("couldn't read generated pending report file", err)
-					}
-					want := helper.LoadOrUpdateGolden(t, filepath.Join(tc.root, "gold", fmt.Sprintf("pendingreport.ReportType%d", int(tc.r))), got, *Update)
-					a.Equal(got, want)
-				}
-				return
-			}
-			a.Equal(serverHitAt, tc.sHitHat)
-			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
-			if err != nil {
-				t.Fatal("didn't generate a report file on disk", err)
-			}
-			got, err := ioutil.ReadAll(gotF)
-			if err != nil {
-				t.Fatal("couldn't read generated report file", err)
-			}
-			want := helper.LoadOrUpdateGolden(t, filepath.Join(tc.root, "gold", fmt.Sprintf("cachereport.ReportType%d", int(tc.r))), got, *Update)
-			a.Equal(got, want)
+			a.Equal(serverHit, tc.shouldHitServer)
 		})
 	}
 }
 
-func TestMultipleMetricsCollectAndSend(t *testing.T) {
+func TestMetricsSendMaxBodyBytes(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		name         string
-		alwaysReport bool
+		name            string
+		maxBodyBytes    int
+		acknowledgement bool
 
-		cacheReportP    string
 		shouldHitServer bool
-		sHitHat         string
 		wantErr         bool
 	}{
-		{"fail report twice", false, "ubuntu-report/ubuntu.18.04", false, "/ubuntu/desktop/18.04", true},
-		{"forcing report twice", true, "ubuntu-report/ubuntu.18.04", true, "/ubuntu/desktop/18.04", false},
+		{"report under the limit", 1024, true, true, false},
+		{"no limit", 0, true, true, false},
+		{"report over the limit", 5, true, false, true},
+		{"opt out over the limit", 5, false, false, true},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -417,38 +651,2511 @@ func TestMultipleMetricsCollectAndSend(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
-				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
-				"testdata/good", "one gpu", "regular", "one screen",
-				"one partition", "regular", "regular", "regular",
-				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
-			defer cancelGPU()
-			defer cancelCPU()
-			defer cancelScreen()
-			defer cancelPartition()
-			defer cancelArchitecture()
-			defer cancelLibc6()
-			defer cancelHwCap()
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
-			serverHitAt := ""
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			err := metricsSend(m, []byte(`{ "Version": "18.04", "some-data": true }`), tc.acknowledgement, false, ts.URL, out, os.Stdin, os.Stdout, WithMaxBodyBytes(tc.maxBodyBytes))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(serverHit, tc.shouldHitServer)
+			if !tc.wantErr {
+				return
+			}
+			if _, ok := err.(*BodyTooLargeError); !ok {
+				t.Errorf("we expected a *BodyTooLargeError, got: %T (%v)", err, err)
+			}
+			if _, err := os.Stat(filepath.Join(out, "ubuntu-report")); !os.IsNotExist(err) {
+				t.Errorf("we expected no report nor pending report to be saved, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestMetricsSendCompression(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		compress bool
+
+		wantEncoding string
+	}{
+		{"uncompressed by default", false, ""},
+		{"compressed", true, "gzip"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			var gotEncoding string
+			var got []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotEncoding = r.Header.Get("Content-Encoding")
+				body := io.Reader(r.Body)
+				if gotEncoding == "gzip" {
+					zr, err := gzip.NewReader(r.Body)
+					if err != nil {
+						t.Errorf("couldn't decompress request body: %v", err)
+						return
+					}
+					body = zr
+				}
+				got, _ = ioutil.ReadAll(body)
+			}))
+			defer ts.Close()
+
+			var opts []Option
+			if tc.compress {
+				opts = append(opts, WithCompression())
+			}
+			data := []byte(`{ "Version": "18.04", "some-data": true }`)
+
+			err := metricsSend(m, data, true, false, ts.URL, out, os.Stdin, os.Stdout, opts...)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(gotEncoding, tc.wantEncoding)
+			a.Equal(got, data)
+
+			// saved report is never compressed
+			saved, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if err != nil {
+				t.Fatal("couldn't read saved report", err)
+			}
+			a.Equal(saved, data)
+		})
+	}
+}
+
+func TestMetricsSendDigestHeader(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		digest       bool
+		compress     bool
+		returnDigest bool
+
+		wantHeader bool
+	}{
+		{"no digest by default", false, false, false, false},
+		{"digest", true, false, false, true},
+		{"digest of uncompressed report", true, true, false, true},
+		{"digest returned to caller", true, false, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			var gotHeader, wantHeader string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotHeader = r.Header.Get("X-Report-SHA256")
+				body := io.Reader(r.Body)
+				if r.Header.Get("Content-Encoding") == "gzip" {
+					zr, err := gzip.NewReader(r.Body)
+					if err != nil {
+						t.Errorf("couldn't decompress request body: %v", err)
+						return
+					}
+					body = zr
+				}
+				b, _ := ioutil.ReadAll(body)
+				sum := sha256.Sum256(b)
+				wantHeader = hex.EncodeToString(sum[:])
+			}))
+			defer ts.Close()
+
+			var opts []Option
+			var digest string
+			if tc.digest {
+				var d *string
+				if tc.returnDigest {
+					d = &digest
+				}
+				opts = append(opts, WithDigestHeader(d))
+			}
+			if tc.compress {
+				opts = append(opts, WithCompression())
+			}
+
+			err := metricsSend(m, []byte(`{ "Version": "18.04", "some-data": true }`), true, false, ts.URL, out, os.Stdin, os.Stdout, opts...)
+
+			a.CheckWantedErr(err, false)
+			if !tc.wantHeader {
+				a.Equal(gotHeader, "")
+				return
+			}
+			a.Equal(gotHeader, wantHeader)
+			if tc.returnDigest {
+				a.Equal(digest, wantHeader)
+			}
+		})
+	}
+}
+
+func TestMetricsSendExtraHeaders(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		headers map[string]string
+		digest  bool
+
+		want map[string]string
+	}{
+		{"no extra headers", nil, false, map[string]string{"X-Tenant": ""}},
+		{"one header", map[string]string{"X-Tenant": "fleet-a"}, false, map[string]string{"X-Tenant": "fleet-a"}},
+		{"multiple headers", map[string]string{"X-Tenant": "fleet-a", "X-Site": "paris"}, false,
+			map[string]string{"X-Tenant": "fleet-a", "X-Site": "paris"}},
+		{"report headers take precedence", map[string]string{"X-Report-SHA256": "forged"}, true,
+			map[string]string{"X-Report-SHA256": sender.Digest([]byte(`{ "Version": "18.04", "some-data": true }`))}},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			var got http.Header
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header
+			}))
+			defer ts.Close()
+
+			opts := []Option{WithExtraHeaders(tc.headers)}
+			if tc.digest {
+				opts = append(opts, WithDigestHeader(nil))
+			}
+
+			err := metricsSend(m, []byte(`{ "Version": "18.04", "some-data": true }`), true, false, ts.URL, out, os.Stdin, os.Stdout, opts...)
+
+			a.CheckWantedErr(err, false)
+			for k, v := range tc.want {
+				a.Equal(got.Get(k), v)
+			}
+			a.Equal(got.Get("Content-Type"), "application/json")
+		})
+	}
+}
+
+func TestMetricsSendPendingDir(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	pendingDir, tearDown := helper.TempDir(t)
+	defer tearDown()
+	pendingDir = filepath.Join(pendingDir, "custom")
+
+	// report can't be sent and is saved in the custom pending directory
+	data := []byte(`{ "Version": "18.04", "some-data": true }`)
+	err := metricsSend(m, data, true, false, "http://localhost:4299", out, os.Stdin, os.Stdout, WithPendingDir(pendingDir))
+
+	a.CheckWantedErr(err, true)
+	got, err := ioutil.ReadFile(filepath.Join(pendingDir, "pending"))
+	if err != nil {
+		t.Fatal("didn't generate a pending report file in the custom directory", err)
+	}
+	a.Equal(got, data)
+	if _, err := os.Stat(filepath.Join(out, "ubuntu-report", "pending")); !os.IsNotExist(err) {
+		t.Errorf("we didn't expect a pending report in the cache directory")
+	}
+
+	// pending report is read back from the custom pending directory
+	serverHit := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	defer ts.Close()
+
+	err = metricsSendPendingReport(m, ts.URL, out, os.Stdin, os.Stdout, WithPendingDir(pendingDir))
+
+	a.CheckWantedErr(err, false)
+	a.Equal(serverHit, true)
+	if _, err := os.Stat(filepath.Join(pendingDir, "pending")); !os.IsNotExist(err) {
+		t.Errorf("we expected the pending report to be removed once sent")
+	}
+	got, err = ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+	if err != nil {
+		t.Fatal("couldn't read saved report", err)
+	}
+	a.Equal(got, data)
+
+	// nothing is pending anymore in the custom pending directory
+	err = metricsSendPendingReport(m, ts.URL, out, os.Stdin, os.Stdout, WithPendingDir(pendingDir))
+
+	if !errors.Is(err, ErrNoPendingReport) {
+		t.Errorf("expected ErrNoPendingReport, got %v", err)
+	}
+}
+
+func TestMetricsSendHistory(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		history bool
+
+		wantEntries int
+	}{
+		{"no history by default", false, 0},
+		{"history", true, 2},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+
+			var opts []Option
+			if tc.history {
+				opts = append(opts, WithHistory())
+			}
+			first := []byte(`{ "Version": "18.04", "some-data": true }`)
+			second := []byte("{\n  \"Version\": \"18.04\",\n  \"some-data\": false\n}")
+
+			err := metricsSend(m, first, true, false, ts.URL, out, os.Stdin, os.Stdout, opts...)
+			a.CheckWantedErr(err, false)
+			err = metricsSend(m, second, true, true, ts.URL, out, os.Stdin, os.Stdout, opts...)
+			a.CheckWantedErr(err, false)
+
+			// latest report is still saved as is
+			saved, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if err != nil {
+				t.Fatal("couldn't read saved report", err)
+			}
+			a.Equal(saved, second)
+
+			b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "history"))
+			if tc.wantEntries == 0 {
+				if !os.IsNotExist(err) {
+					t.Fatalf("no history file expected, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("couldn't read history", err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			a.Equal(len(lines), tc.wantEntries)
+			for i, want := range []string{`{"Version":"18.04","some-data":true}`, `{"Version":"18.04","some-data":false}`} {
+				var entry struct {
+					Date   time.Time
+					Report json.RawMessage
+				}
+				if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+					t.Fatalf("history line %d isn't valid JSON: %v", i, err)
+				}
+				if entry.Date.IsZero() {
+					t.Errorf("history line %d has no date", i)
+				}
+				a.Equal(string(entry.Report), want)
+			}
+		})
+	}
+}
+
+func TestMetricsSendPreSendHook(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`{ "Version": "18.04", "some-data": true }`)
+	rewritten := []byte(`{ "Version": "18.04", "some-data": false }`)
+	testCases := []struct {
+		name string
+		ack  bool
+		hook func([]byte) ([]byte, error)
+
+		wantHookData []byte
+		want         []byte
+		wantErr      bool
+	}{
+		{"unchanged", true, func(d []byte) ([]byte, error) { return d, nil }, data, data, false},
+		{"rewrite", true, func(d []byte) ([]byte, error) { return rewritten, nil }, data, rewritten, false},
+		{"reject", true, func(d []byte) ([]byte, error) { return nil, errors.New("rejected") }, data, nil, true},
+		{"opt out", false, func(d []byte) ([]byte, error) { return d, nil }, []byte(optOutJSON), []byte(optOutJSON), false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			var got []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = ioutil.ReadAll(r.Body)
+			}))
+			defer ts.Close()
+
+			var gotHookData []byte
+			hook := func(d []byte) ([]byte, error) {
+				gotHookData = d
+				return tc.hook(d)
+			}
+
+			err := metricsSend(m, data, tc.ack, false, ts.URL, out, os.Stdin, os.Stdout, WithPreSendHook(hook))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(gotHookData, tc.wantHookData)
+			a.Equal(got, tc.want)
+			if err != nil {
+				if _, err := os.Stat(filepath.Join(out, "ubuntu-report")); !os.IsNotExist(err) {
+					t.Errorf("we didn't expect any saved or pending report as the hook rejected it")
+				}
+				return
+			}
+			saved, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if err != nil {
+				t.Fatal("couldn't read saved report", err)
+			}
+			a.Equal(saved, tc.want)
+		})
+	}
+}
+
+func TestMetricsSendExcludedFields(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`{ "Version": "18.04", "Autologin": false, "OEM": { "Vendor": "DID" }, "RAM": 8 }`)
+	testCases := []struct {
+		name     string
+		ack      bool
+		excluded []string
+
+		wantFields []string
+		wantErr    bool
+	}{
+		{"nothing excluded", true, nil, []string{"Autologin", "OEM", "RAM", "Version"}, false},
+		{"exclude some fields", true, []string{"Autologin", "OEM"}, []string{"RAM", "Version"}, false},
+		{"exclude missing field", true, []string{"Screens"}, []string{"Autologin", "OEM", "RAM", "Version"}, false},
+		{"opt out", false, []string{"Autologin"}, []string{"OptOut"}, false},
+		{"mandatory field can't be excluded", true, []string{"Autologin", "Version"}, nil, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHit := false
+			var got []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+				got, _ = ioutil.ReadAll(r.Body)
+			}))
+			defer ts.Close()
+
+			err := metricsSend(m, data, tc.ack, false, ts.URL, out, os.Stdin, os.Stdout, WithExcludedFields(tc.excluded))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			if err != nil {
+				a.Equal(serverHit, false)
+				return
+			}
+			var report map[string]json.RawMessage
+			if err := json.Unmarshal(got, &report); err != nil {
+				t.Fatalf("sent report isn't valid JSON: %v", err)
+			}
+			var gotFields []string
+			for k := range report {
+				gotFields = append(gotFields, k)
+			}
+			sort.Strings(gotFields)
+			a.Equal(gotFields, tc.wantFields)
+		})
+	}
+}
+
+func TestMetricsSendBaseURL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		configuredURL   bool
+		manualServerURL bool
+
+		wantConfiguredHit bool
+		wantManualHit     bool
+	}{
+		{"configured server", true, false, true, false},
+		{"parameter takes precedence", true, true, false, true},
+		{"parameter only", false, true, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			configuredHitAt, manualHitAt := "", ""
+			configured := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				configuredHitAt = r.URL.String()
+			}))
+			defer configured.Close()
+			manual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				manualHitAt = r.URL.String()
+			}))
+			defer manual.Close()
+
+			if tc.configuredURL {
+				if err := metrics.WithBaseURL(configured.URL)(&m); err != nil {
+					t.Fatal("couldn't configure server url", err)
+				}
+			}
+			url := ""
+			if tc.manualServerURL {
+				url = manual.URL
+			}
+
+			err := metricsSend(m, []byte(`{ "Version": "18.04", "some-data": true }`), true, false, url, out, os.Stdin, os.Stdout)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(configuredHitAt != "", tc.wantConfiguredHit)
+			a.Equal(manualHitAt != "", tc.wantManualHit)
+			if tc.wantConfiguredHit {
+				a.Equal(configuredHitAt, "/ubuntu/desktop/18.04")
+			}
+		})
+	}
+}
+
+func TestMetricsSendStalePendingReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		manualServerURL string
+
+		wantPendingReport []byte
+		wantErr           bool
+	}{
+		{"stale pending report removed", "", nil, false},
+		{"pending report replaced on failure", "http://localhost:4299", []byte(`{ "Version": "18.04", "some-data": true }`), true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			pendingP := filepath.Join(out, "ubuntu-report", "pending")
+			if err := saveMetrics(pendingP, []byte(`{ "stale-data": true }`)); err != nil {
+				t.Fatal("couldn't seed stale pending report", err)
+			}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+			url := tc.manualServerURL
+			if url == "" {
+				url = ts.URL
+			}
+
+			err := metricsSend(m, []byte(`{ "Version": "18.04", "some-data": true }`), true, false, url, out, os.Stdout, os.Stdin)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			got, err := ioutil.ReadFile(pendingP)
+			if tc.wantPendingReport == nil {
+				if !os.IsNotExist(err) {
+					t.Errorf("we expected the stale pending report to be removed, got: %s (%v)", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("couldn't read pending report", err)
+			}
+			a.Equal(got, tc.wantPendingReport)
+		})
+	}
+}
+
+func TestMetricsSendTruncatedReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		previousReportP string
+		previousReport  string
+		alwaysReport    bool
+		upgrade         bool
+
+		shouldHitServer bool
+		wantErr         bool
+	}{
+		{"truncated report is overwritten", "ubuntu.18.04", `{ "Version": "18`, true, false, true, false},
+		{"empty report is overwritten", "ubuntu.18.04", "", true, false, true, false},
+		{"truncated report still counts as reported", "ubuntu.18.04", `{ "Version": "18`, false, false, false, true},
+		{"truncated previous version report isn't an opt-in on upgrade", "ubuntu.14.04", `{ "OptO`, false, true, false, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			reportDir := filepath.Join(out, "ubuntu-report")
+			if err := os.MkdirAll(reportDir, 0700); err != nil {
+				t.Fatal("couldn't create report directory", err)
+			}
+			// simulate a write interrupted by a previous version
+			if err := ioutil.WriteFile(filepath.Join(reportDir, tc.previousReportP), []byte(tc.previousReport), 0644); err != nil {
+				t.Fatal("couldn't seed truncated report", err)
+			}
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			data := []byte(`{ "Version": "18.04", "some-data": true }`)
+			var err error
+			if tc.upgrade {
+				err = metricsCollectAndSendOnUpgrade(m, tc.alwaysReport, ts.URL, out, os.Stdin, os.Stdout)
+			} else {
+				err = metricsSend(m, data, true, tc.alwaysReport, ts.URL, out, os.Stdin, os.Stdout)
+			}
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(serverHit, tc.shouldHitServer)
+			got, err := ioutil.ReadFile(filepath.Join(reportDir, "ubuntu.18.04"))
+			if !tc.shouldHitServer {
+				if tc.upgrade && !os.IsNotExist(err) {
+					t.Errorf("we didn't expect any report for the new version, got: %s (%v)", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("couldn't read report", err)
+			}
+			a.Equal(got, data)
+		})
+	}
+}
+
+func TestSaveMetrics(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	p := filepath.Join(out, "ubuntu-report", "ubuntu.18.04")
+
+	if err := saveMetrics(p, []byte(`{ "Version": "18.04", "some-data": true }`)); err != nil {
+		t.Fatal("couldn't save report", err)
+	}
+	if err := saveMetrics(p, []byte(`{ "Version": "18.04" }`)); err != nil {
+		t.Fatal("couldn't overwrite report", err)
+	}
+
+	got, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal("couldn't read report", err)
+	}
+	a.Equal(string(got), `{ "Version": "18.04" }`)
+	// no temporary file is left behind
+	files, err := ioutil.ReadDir(filepath.Dir(p))
+	if err != nil {
+		t.Fatal("couldn't list report directory", err)
+	}
+	a.Equal(len(files), 1)
+}
+
+func TestMetricsSendClockSkew(t *testing.T) {
+	// not parallel as we capture logs
+	a := helper.Asserter{T: t}
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+
+	serverHit := false
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverHit = true
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{notYetValidCert(t)}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	logs, restoreLogs := helper.CaptureLogs(t)
+	defer restoreLogs()
+	var gotLogs bytes.Buffer
+	logsRead := make(chan struct{})
+	go func() {
+		io.Copy(&gotLogs, logs)
+		close(logsRead)
+	}()
+
+	data := []byte(`{ "Version": "18.04", "some-data": true }`)
+	err := metricsSend(m, data, true, false, ts.URL, out, os.Stdout, os.Stdin)
+	restoreLogs()
+	<-logsRead
+
+	a.CheckWantedErr(err, true)
+	a.Equal(serverHit, false)
+	if !strings.Contains(gotLogs.String(), "system clock") {
+		t.Errorf("expected a log about the system clock being wrong, got: %s", gotLogs.String())
+	}
+	if _, err := os.Stat(filepath.Join(out, "ubuntu-report/ubuntu.18.04")); !os.IsNotExist(err) {
+		t.Errorf("we didn't expect finding a cache report path as we erroring out")
+	}
+	got, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report/pending"))
+	if err != nil {
+		t.Fatal("didn't generate a pending report file on disk", err)
+	}
+	a.Equal(got, data)
+}
+
+func TestMetricsSendServerAnswer(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		answer string
+
+		wantPendingReport bool
+		wantErr           bool
+	}{
+		{"ok answer", `{"status": "ok"}`, false, false},
+		{"error answer", `{"error": "database unavailable"}`, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.answer)
+			}))
+			defer ts.Close()
+
+			data := []byte(`{ "Version": "18.04", "some-data": true }`)
+			err := metricsSend(m, data, true, false, ts.URL, out, os.Stdout, os.Stdin)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			_, err = os.Stat(filepath.Join(out, "ubuntu-report/ubuntu.18.04"))
+			a.Equal(os.IsNotExist(err), tc.wantPendingReport)
+			got, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report/pending"))
+			if !tc.wantPendingReport {
+				if !os.IsNotExist(err) {
+					t.Errorf("we didn't expect any pending report, got: %s (%v)", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("didn't generate a pending report file on disk", err)
+			}
+			a.Equal(got, data)
+		})
+	}
+}
+
+func TestMetricsHasReported(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		root            string
+		previousReports map[string]string
+
+		want    bool
+		wantErr bool
+	}{
+		{"no previous report", "testdata/good", nil, false, false},
+		{"already reported", "testdata/good", map[string]string{"ubuntu.18.04": `{ "Version": "18.04" }`}, true, false},
+		{"already opted out", "testdata/good", map[string]string{"ubuntu.18.04": optOutJSON}, true, false},
+		{"reported on previous release", "testdata/good", map[string]string{"ubuntu.17.10": `{ "Version": "17.10" }`}, false, false},
+		{"reported on another distribution", "testdata/derivative", map[string]string{"ubuntu.22.04": `{ "Version": "22.04" }`}, false, false},
+		{"no IDs (mandatory)", "testdata/no-ids", nil, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics(tc.root, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			for name, content := range tc.previousReports {
+				if err := saveMetrics(filepath.Join(out, "ubuntu-report", name), []byte(content)); err != nil {
+					t.Fatalf("couldn't set up previous report: %v", err)
+				}
+			}
+
+			got, err := metricsHasReported(m, out)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestMultipleMetricsSend(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		firstRoot    string
+		secondRoot   string
+		alwaysReport bool
+
+		cacheReportP    string
+		shouldHitServer bool
+		sHitHat         string
+		wantErr         bool
+	}{
+		{"fail report twice", "testdata/good", "testdata/good", false, "ubuntu-report/ubuntu.18.04", false, "/ubuntu/desktop/18.04", true},
+		{"forcing report twice", "testdata/good", "testdata/good", true, "ubuntu-report/ubuntu.18.04", true, "/ubuntu/desktop/18.04", false},
+		{"fail report twice on derivative", "testdata/derivative", "testdata/derivative", false, "ubuntu-report/neon.22.04", false, "/neon/desktop/22.04", true},
+		{"changed distribution", "testdata/good", "testdata/derivative", false, "ubuntu-report/neon.22.04", true, "/neon/desktop/22.04", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics(tc.firstRoot, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHitAt := ""
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHitAt = r.URL.String()
+			}))
+			defer ts.Close()
+
+			err := metricsSend(m, []byte(`{ "Version": "18.04", "some-data": true }`), true, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+			if err != nil {
+				t.Fatal("Didn't expect first call to fail")
+			}
+
+			// second call, reset server
+			serverHitAt = ""
+			m = metrics.NewTestMetrics(tc.secondRoot, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err = metricsSend(m, []byte(`{ "Version": "18.04", "some-data": true }`), true, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			// check we didn't do too much work on error
+			if err != nil {
+				if !tc.shouldHitServer {
+					a.Equal(serverHitAt, "")
+				}
+				if tc.shouldHitServer && serverHitAt == "" {
+					t.Error("we should have hit the local server and we didn't")
+				}
+				return
+			}
+			a.Equal(serverHitAt, tc.sHitHat)
+			if tc.firstRoot != tc.secondRoot {
+				// previous report from the other distribution is kept
+				if _, err := os.Stat(filepath.Join(out, "ubuntu-report", "ubuntu.18.04")); err != nil {
+					t.Errorf("expected previous distribution report to be kept: %v", err)
+				}
+			}
+			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
+			if err != nil {
+				t.Fatal("didn't generate a report file on disk", err)
+			}
+			got, err := ioutil.ReadAll(gotF)
+			if err != nil {
+				t.Fatal("couldn't read generated report file", err)
+			}
+			want := helper.LoadOrUpdateGolden(t, filepath.Join(tc.secondRoot, "gold", fmt.Sprintf("metricssend_twice.%s", strings.Replace(tc.name, " ", "_", -1))), got, *Update)
+			a.Equal(got, want)
+		})
+	}
+}
+
+func TestMetricsCollectAndSend(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name             string
+		root             string
+		caseGPU          string
+		caseCPU          string
+		caseScreen       string
+		casePartition    string
+		caseArchitecture string
+		caseLibc6        string
+		caseHwCap        string
+		env              map[string]string
+		r                ReportType
+		manualServerURL  string
+
+		cacheReportP    string
+		pendingReportP  string
+		shouldHitServer bool
+		sHitHat         string
+		wantErr         bool
+	}{
+		{"regular report auto",
+			"testdata/good", "one gpu", "regular", "one screen",
+			"one partition", "regular", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			ReportAuto, "",
+			"ubuntu-report/ubuntu.18.04", "", true, "/ubuntu/desktop/18.04", false},
+		{"regular report OptOut",
+			"testdata/good", "one gpu", "regular", "one screen",
+			"one partition", "regular", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			ReportOptOut, "",
+			"ubuntu-report/ubuntu.18.04", "", true, "/ubuntu/desktop/18.04", false},
+		{"derivative with unquoted version",
+			"testdata/derivative-unquoted", "one gpu", "regular", "one screen",
+			"one partition", "regular", "regular", "regular",
+			map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"},
+			ReportAuto, "",
+			"ubuntu-report/pop.22.04", "", true, "/pop/desktop/22.04", false},
+		{"no network",
+			"testdata/good", "", "", "", "", "", "", "", nil, ReportAuto,
+			"http://localhost:4299", "ubuntu-report", "ubuntu-report/pending", false, "", true},
+		{"No IDs (mandatory)",
+			"testdata/no-ids", "", "", "", "", "", "", "", nil, ReportAuto,
+			"", "ubuntu-report", "", false, "", true},
+		{"Invalid URL",
+			"testdata/good", "", "", "", "", "", "", "", nil, ReportAuto,
+			"http://a b.com/", "ubuntu-report", "", false, "", true},
+		{"Unwritable path",
+			"testdata/good", "", "", "", "", "", "", "", nil, ReportAuto,
+			"", "/unwritable/cache/path", "", true, "/ubuntu/desktop/18.04", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t, tc.root,
+				tc.caseGPU, tc.caseCPU, tc.caseScreen, tc.casePartition,
+				tc.caseArchitecture, tc.caseLibc6, tc.caseHwCap, tc.env)
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			if strings.HasPrefix(tc.cacheReportP, "/") {
+				// absolute path, override temporary one
+				out = tc.cacheReportP
+			}
+			serverHitAt := ""
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHitAt = r.URL.String()
+			}))
+			defer ts.Close()
+			url := tc.manualServerURL
+			if url == "" {
+				url = ts.URL
+			}
+
+			err := metricsCollectAndSend(m, tc.r, false, url, out, os.Stdout, os.Stdin)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			// check we didn't do too much work on error
+			if err != nil {
+				if !tc.shouldHitServer {
+					a.Equal(serverHitAt, "")
+				}
+				if tc.shouldHitServer && serverHitAt == "" {
+					t.Error("we should have hit the local server and it didn't")
+				}
+				if tc.pendingReportP == "" {
+					if _, err := os.Stat(filepath.Join(out, tc.cacheReportP)); !os.IsNotExist(err) {
+						t.Errorf("we didn't expect finding a cache report path as we erroring out")
+					}
+				} else {
+					gotF, err := os.Open(filepath.Join(out, tc.pendingReportP))
+					if err != nil {
+						t.Fatal("didn't generate a pending report file on disk", err)
+					}
+					got, err := ioutil.ReadAll(gotF)
+					if err != nil {
+						t.Fatal("couldn't read generated pending report file", err)
+					}
+					want := helper.LoadOrUpdateGolden(t, filepath.Join(tc.root, "gold", fmt.Sprintf("pendingreport.ReportType%d", int(tc.r))), got, *Update)
+					a.Equal(got, want)
+				}
+				return
+			}
+			a.Equal(serverHitAt, tc.sHitHat)
+			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
+			if err != nil {
+				t.Fatal("didn't generate a report file on disk", err)
+			}
+			got, err := ioutil.ReadAll(gotF)
+			if err != nil {
+				t.Fatal("couldn't read generated report file", err)
+			}
+			want := helper.LoadOrUpdateGolden(t, filepath.Join(tc.root, "gold", fmt.Sprintf("cachereport.ReportType%d", int(tc.r))), got, *Update)
+			a.Equal(got, want)
+		})
+	}
+}
+
+func TestMultipleMetricsCollectAndSend(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		alwaysReport bool
+
+		cacheReportP    string
+		shouldHitServer bool
+		sHitHat         string
+		wantErr         bool
+	}{
+		{"fail report twice", false, "ubuntu-report/ubuntu.18.04", false, "/ubuntu/desktop/18.04", true},
+		{"forcing report twice", true, "ubuntu-report/ubuntu.18.04", true, "/ubuntu/desktop/18.04", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHitAt := ""
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHitAt = r.URL.String()
+			}))
+			defer ts.Close()
+
+			err := metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+			if err != nil {
+				t.Fatal("Didn't expect first call to fail")
+			}
+
+			// second call, reset server
+			serverHitAt = ""
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap = newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			err = metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			// check we didn't do too much work on error
+			if err != nil {
+				if !tc.shouldHitServer {
+					a.Equal(serverHitAt, "")
+				}
+				if tc.shouldHitServer && serverHitAt == "" {
+					t.Error("we should have hit the local server and we didn't")
+				}
+				return
+			}
+			a.Equal(serverHitAt, tc.sHitHat)
+			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
+			if err != nil {
+				t.Fatal("didn't generate a report file on disk", err)
+			}
+			got, err := ioutil.ReadAll(gotF)
+			if err != nil {
+				t.Fatal("couldn't read generated report file", err)
+			}
+			want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata/good", "gold", fmt.Sprintf("cachereport-twice.ReportType%d", int(ReportAuto))), got, *Update)
+			a.Equal(got, want)
+		})
+	}
+}
+
+func TestMultipleMetricsCollectAndSendOnlyIfChanged(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		firstReport  ReportType
+		secondLang   string
+		alwaysReport bool
+
+		shouldHitServer bool
+		wantErr         error
+	}{
+		{"unchanged report isn't sent", ReportAuto, "fr_FR.UTF-8", false, false, ErrUnchanged},
+		{"changed report is sent", ReportAuto, "en_US.UTF-8", false, true, nil},
+		{"forcing report twice sends an unchanged report", ReportAuto, "fr_FR.UTF-8", true, true, nil},
+		{"previous opt-out is respected", ReportOptOut, "en_US.UTF-8", false, false, ErrAlreadyReported},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"LANG": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			err := metricsCollectAndSend(m, tc.firstReport, false, ts.URL, out, os.Stdout, os.Stdin, WithOnlyIfChanged())
+			if err != nil {
+				t.Fatal("Didn't expect first call to fail", err)
+			}
+
+			// second call, reset server
+			serverHit = false
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap = newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"LANG": tc.secondLang})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			err = metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin, WithOnlyIfChanged())
+
+			a.CheckWantedErr(err, tc.wantErr != nil)
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected error to be %v, got: %v", tc.wantErr, err)
+			}
+			a.Equal(serverHit, tc.shouldHitServer)
+			if !tc.shouldHitServer {
+				return
+			}
+			got, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			if err != nil {
+				t.Fatal("couldn't read generated report file", err)
+			}
+			if !strings.Contains(string(got), tc.secondLang[:5]) {
+				t.Errorf("expected the cache report to be replaced by the new one, got: %s", got)
+			}
+		})
+	}
+}
+
+func TestSameReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		a    string
+		b    string
+
+		want bool
+	}{
+		{"identical", `{"Version": "18.04", "RAM": 8}`, `{"Version": "18.04", "RAM": 8}`, true},
+		{"formatting differs", `{"Version": "18.04", "RAM": 8}`, `{"RAM":8,"Version":"18.04"}`, true},
+		{"volatile fields differ", `{"Version": "18.04", "UptimeBucket": "under-1h", "FailedUnitsCount": 0, "CollectionTimeBucket": "fast"}`,
+			`{"Version": "18.04", "UptimeBucket": "over-1w", "FailedUnitsCount": 2}`, true},
+		{"snake_case volatile fields differ", `{"version": "18.04", "uptime_bucket": "under-1h"}`, `{"version": "18.04", "uptime_bucket": "under-1d"}`, true},
+		{"field changed", `{"Version": "18.04", "RAM": 8}`, `{"Version": "18.04", "RAM": 16}`, false},
+		{"field added", `{"Version": "18.04"}`, `{"Version": "18.04", "RAM": 16}`, false},
+		{"field removed", `{"Version": "18.04", "RAM": 8}`, `{"Version": "18.04"}`, false},
+		{"malformed previous report", `{"Version": "18.04",`, `{"Version": "18.04"}`, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			a.Equal(sameReport([]byte(tc.a), []byte(tc.b)), tc.want)
+		})
+	}
+}
+
+func TestMetricsCollectAndSendStateless(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		r          ReportType
+		cacheState string
+		serverDown bool
+
+		wantHits int
+		wantErr  bool
+	}{
+		{"auto report twice", ReportAuto, "", false, 2, false},
+		{"opt-out twice", ReportOptOut, "", false, 2, false},
+		{"previous report is ignored", ReportAuto, "previous report", false, 2, false},
+		{"unwritable path", ReportAuto, "unwritable", false, 2, false},
+		{"report isn't kept on failure", ReportAuto, "", true, 2, true},
+		{"spooling isn't possible", ReportSpool, "", false, 0, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			var wantFiles []string
+			switch tc.cacheState {
+			case "previous report":
+				if err := saveMetrics(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"), []byte(optOutJSON)); err != nil {
+					t.Fatal("couldn't create previous report", err)
+				}
+				wantFiles = []string{"ubuntu.18.04"}
+			case "unwritable":
+				// a cache directory under a file can't be created, even by root
+				if err := ioutil.WriteFile(filepath.Join(out, "file"), nil, 0644); err != nil {
+					t.Fatal("couldn't create file", err)
+				}
+			}
+			cacheDir := out
+			if tc.cacheState == "unwritable" {
+				cacheDir = filepath.Join(out, "file")
+			}
+
+			serverHits := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHits++
+				if tc.serverDown {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer ts.Close()
+
+			for i := 0; i < 2; i++ {
+				m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+					cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+					"testdata/good", "one gpu", "regular", "one screen",
+					"one partition", "regular", "regular", "regular",
+					map[string]string{"LANG": "fr_FR.UTF-8"})
+				defer cancelGPU()
+				defer cancelCPU()
+				defer cancelScreen()
+				defer cancelPartition()
+				defer cancelArchitecture()
+				defer cancelLibc6()
+				defer cancelHwCap()
+
+				err := metricsCollectAndSend(m, tc.r, false, ts.URL, cacheDir, os.Stdout, os.Stdin, WithStateless(true))
+
+				a.CheckWantedErr(err, tc.wantErr)
+				if errors.Is(err, ErrPendingWritten) {
+					t.Error("no pending report should be written in stateless mode")
+				}
+			}
+
+			a.Equal(serverHits, tc.wantHits)
+			files, err := ioutil.ReadDir(filepath.Join(out, "ubuntu-report"))
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal("couldn't list cache directory", err)
+			}
+			var got []string
+			for _, f := range files {
+				got = append(got, f.Name())
+			}
+			a.Equal(got, wantFiles)
+		})
+	}
+}
+
+func TestMetricsCollectAndSendOnUpgrade(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		previousReportP string
+
+		cacheReportP    string
+		shouldHitServer bool
+		wantOptOut      bool
+		wantErr         bool
+	}{
+		{"without previous report",
+			"",
+			"", false, false, false},
+		{"with previous report, current release",
+			"testdata/previous_reports/current_release",
+			"", false, false, true},
+		{"with previous report, previous release opt in",
+			"testdata/previous_reports/previous_release_optin",
+			"ubuntu-report/ubuntu.18.04", true, false, false},
+		{"with previous report, previous release opt out",
+			"testdata/previous_reports/previous_release_optout",
+			"ubuntu-report/ubuntu.18.04", true, true, false},
+		{"with two previous reports, latest previous release opt in",
+			"testdata/previous_reports/latest_previous_release_optin",
+			"ubuntu-report/ubuntu.18.04", true, false, false},
+		{"with two previous reports, latest previous release opt out",
+			"testdata/previous_reports/latest_previous_release_optout",
+			"ubuntu-report/ubuntu.18.04", true, true, false},
+		{"with different distro reports, current optin, other distro more recent opt out",
+			"testdata/previous_reports/previous_with_different_distros",
+			"ubuntu-report/ubuntu.18.04", true, false, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession",
+					"XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+
+			if tc.previousReportP != "" {
+				reportDir := filepath.Join(out, "ubuntu-report")
+				if err := os.MkdirAll(reportDir, 0700); err != nil {
+					t.Fatalf("couldn't create report directory: %v", err)
+				}
+				files, err := ioutil.ReadDir(tc.previousReportP)
+				if err != nil {
+					t.Fatalf("couldn't list files under %s: %v", tc.previousReportP, err)
+				}
+				for _, file := range files {
+					data, err := ioutil.ReadFile(filepath.Join(tc.previousReportP, file.Name()))
+					if err != nil {
+						t.Fatalf("couldn't read report file: %v", err)
+					}
+					if err = ioutil.WriteFile(filepath.Join(reportDir, file.Name()), data, 0644); err != nil {
+						t.Fatalf("couldn't write to destination report file in setup: %v", err)
+					}
+				}
+			}
+
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+			url := ts.URL
+
+			err := metricsCollectAndSendOnUpgrade(m, false, url, out, os.Stdout, os.Stdin)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			// check we didn't do too much work on error
+			if err != nil {
+				if tc.shouldHitServer && serverHit == false {
+					t.Error("we should have hit the local server and we didn't")
+				}
+				if !tc.shouldHitServer && serverHit == true {
+					t.Error("we have hit the local server when we shouldn't have")
+				}
+				return
+			}
+			a.Equal(serverHit, tc.shouldHitServer)
+			// case with no report to generate (no previous answer)
+			if tc.cacheReportP == "" {
+				files, err := ioutil.ReadDir(filepath.Join(out, "ubuntu-report"))
+				if err != nil {
+					return
+				}
+				if len(files) != 0 {
+					t.Fatalf("we expected no report to be generated but we found some")
+				}
+				return
+			}
+
+			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
+			if err != nil {
+				t.Fatal("didn't generate a report file on disk", err)
+			}
+			got, err := ioutil.ReadAll(gotF)
+			if err != nil {
+				t.Fatal("couldn't read generated report file", err)
+			}
+			isOptOut := strings.Contains(string(got), optOutJSON)
+
+			if tc.wantOptOut && !isOptOut {
+				t.Errorf("we wanted an opt out as we opted out in previous release but got some data in: %s", got)
+			} else if !tc.wantOptOut && isOptOut {
+				t.Errorf("we wanted some data which are not opt out information, but got opt out content instead")
+			}
+		})
+	}
+}
+
+func TestInteractiveMetricsCollectAndSend(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		answers []string
+
+		cacheReportP       string
+		wantWriteAndUpload bool
+	}{
+		{"yes", []string{"yes"}, "ubuntu-report/ubuntu.18.04", true},
+		{"y", []string{"y"}, "ubuntu-report/ubuntu.18.04", true},
+		{"YES", []string{"YES"}, "ubuntu-report/ubuntu.18.04", true},
+		{"Y", []string{"Y"}, "ubuntu-report/ubuntu.18.04", true},
+		{"no", []string{"no"}, "ubuntu-report/ubuntu.18.04", true},
+		{"n", []string{"n"}, "ubuntu-report/ubuntu.18.04", true},
+		{"NO", []string{"NO"}, "ubuntu-report/ubuntu.18.04", true},
+		{"n", []string{"N"}, "ubuntu-report/ubuntu.18.04", true},
+		{"quit", []string{"quit"}, "ubuntu-report/ubuntu.18.04", false},
+		{"q", []string{"q"}, "ubuntu-report/ubuntu.18.04", false},
+		{"QUIT", []string{"QUIT"}, "ubuntu-report/ubuntu.18.04", false},
+		{"Q", []string{"Q"}, "ubuntu-report/ubuntu.18.04", false},
+		{"default-quit", []string{""}, "ubuntu-report/ubuntu.18.04", false},
+		{"garbage-then-quit", []string{"garbage", "yesgarbage", "nogarbage", "quitgarbage", "Q"}, "ubuntu-report/ubuntu.18.04", false},
+		{"ctrl-c-input", []string{"CTRL-C"}, "ubuntu-report/ubuntu.18.04", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHitAt := ""
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHitAt = r.URL.String()
+			}))
+			defer ts.Close()
+
+			stdin, stdinW := io.Pipe()
+			stdout, stdoutW := io.Pipe()
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error { return metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, stdin, stdoutW) })
+
+			gotJSONReport := false
+			answerIndex := 0
+			scanner := bufio.NewScanner(stdout)
+			scanner.Split(ScanLinesOrQuestion)
+			for scanner.Scan() {
+				txt := scanner.Text()
+				// first, we should have a known element
+				if strings.Contains(txt, ExpectedReportItem) {
+					gotJSONReport = true
+				}
+				if !strings.Contains(txt, "Do you agree to report this?") {
+					continue
+				}
+				a := tc.answers[answerIndex]
+				if a == "CTRL-C" {
+					stdinW.Close()
+					break
+				} else {
+					stdinW.Write([]byte(tc.answers[answerIndex] + "\n"))
+				}
+				answerIndex = answerIndex + 1
+				// all answers have be provided
+				if answerIndex >= len(tc.answers) {
+					stdinW.Close()
+					break
+				}
+			}
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("didn't expect to get an error, got:", err)
+			}
+			a.Equal(gotJSONReport, true)
+
+			// check we didn't do too much work on error
+			if !tc.wantWriteAndUpload {
+				a.Equal(serverHitAt, "")
+				if _, err := os.Stat(filepath.Join(out, tc.cacheReportP)); !os.IsNotExist(err) {
+					t.Errorf("we didn't expect finding a cache report path as we said to quit")
+				}
+				return
+			}
+			if serverHitAt == "" {
+				t.Error("we should have hit the local server and we didn't")
+			}
+			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
+			if err != nil {
+				t.Fatal("didn't generate a report file on disk", err)
+			}
+			got, err := ioutil.ReadAll(gotF)
+			if err != nil {
+				t.Fatal("couldn't read generated report file", err)
+			}
+            
+            // To avoid case-insensitive file name collisions, append command case to golden file name.
+            cmdCase := "lc"
+            if 'A' <= tc.name[0] && tc.name[0] <= 'Z' {
+                cmdCase = "uc"
+            }
+
+			want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata/good", "gold", fmt.Sprintf("cachereport-twice.ReportType%d-%s-%s", int(ReportInteractive), strings.Replace(tc.name, " ", "-", -1), cmdCase)), got, *Update)
+			a.Equal(got, want)
+		})
+	}
+}
+
+func TestInteractiveMetricsCollectAndSendDiff(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		previousReport string
+
+		wantDiff       bool
+		wantFullReport bool
+	}{
+		{"diff against previous release report", `{"Version": "17.10", "Arch": "amd64", "Removed": true}`, true, false},
+		{"full report without previous report", "", false, true},
+		{"full report after opt-out", `{"OptOut": true}`, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			if tc.previousReport != "" {
+				if err := saveMetrics(filepath.Join(out, "ubuntu-report", "ubuntu.17.10"), []byte(tc.previousReport)); err != nil {
+					t.Fatal("couldn't seed previous report", err)
+				}
+			}
+
+			stdin, stdinW := io.Pipe()
+			stdout, stdoutW := io.Pipe()
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				return metricsCollectAndSend(m, ReportInteractiveDiff, false, "http://localhost:4299", out, stdin, stdoutW)
+			})
+
+			var gotOutput []string
+			scanner := bufio.NewScanner(stdout)
+			scanner.Split(ScanLinesOrQuestion)
+			for scanner.Scan() {
+				txt := scanner.Text()
+				gotOutput = append(gotOutput, txt)
+				if strings.Contains(txt, "Do you agree to report this?") {
+					stdinW.Write([]byte("q\n"))
+					stdinW.Close()
+					break
+				}
+			}
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("didn't expect to get an error, got:", err)
+			}
+			got := strings.Join(gotOutput, "\n")
+			a.Equal(strings.Contains(got, "what changed"), tc.wantDiff)
+			a.Equal(strings.Contains(got, "result of hardware"), tc.wantFullReport)
+			if tc.wantFullReport && !strings.Contains(got, ExpectedReportItem) {
+				t.Errorf("expected the full report to be printed, got:\n%s", got)
+			}
+			if tc.wantDiff {
+				for _, want := range []string{`~ Version: "17.10" -> "18.04"`, "- Removed: true", "+ CPU: {"} {
+					if !strings.Contains(got, want) {
+						t.Errorf("expected %q in diff, got:\n%s", want, got)
+					}
+				}
+				if strings.Contains(got, "Arch:") {
+					t.Errorf("we didn't expect unchanged Arch field in diff, got:\n%s", got)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffWithLastReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		previousReport string
+		data           string
+
+		want []string
+	}{
+		{"changed fields", `{"Version": "17.10", "Arch": "amd64", "RAM": 8}`, `{"Version": "18.04", "Arch": "amd64", "Kernel": "5.4"}`,
+			[]string{"- RAM: 8", `~ Version: "17.10" -> "18.04"`, `+ Kernel: "5.4"`, "(1 unchanged fields)"}},
+		{"nothing changed", `{"Version": "18.04", "GPU": [ {"Vendor": "8086"} ]}`, `{"Version":"18.04","GPU":[{"Vendor":"8086"}]}`,
+			[]string{"Nothing changed since the last report."}},
+		{"no previous report", "", `{"Version": "18.04"}`, nil},
+		{"previous opt-out", `{"OptOut": true}`, `{"Version": "18.04"}`, nil},
+		{"malformed previous report", `{"Version": `, `{"Version": "18.04"}`, nil},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			if tc.previousReport != "" {
+				if err := saveMetrics(filepath.Join(out, "ubuntu-report", "ubuntu.17.10"), []byte(tc.previousReport)); err != nil {
+					t.Fatal("couldn't seed previous report", err)
+				}
+			}
+
+			got := diffWithLastReport("ubuntu", out, []byte(tc.data))
+
+			sort.Strings(got)
+			sort.Strings(tc.want)
+			a.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestInteractiveMetricsCollectAndSendConfirmServer(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		confirmServer bool
+		answers       []string
+
+		wantConfirmation   bool
+		wantWriteAndUpload bool
+	}{
+		{"confirm then yes", true, []string{"yes", "yes"}, true, true},
+		{"confirm then no", true, []string{"y", "no"}, true, true},
+		{"confirm then quit", true, []string{"yes", "q"}, true, false},
+		{"deny server", true, []string{"no"}, true, false},
+		{"deny server by default", true, []string{""}, true, false},
+		{"garbage then confirm", true, []string{"garbage", "yes", "yes"}, true, true},
+		{"ctrl-c-input", true, []string{"CTRL-C"}, true, false},
+		{"no confirmation requested", false, []string{"yes"}, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHitAt := ""
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHitAt = r.URL.String()
+			}))
+			defer ts.Close()
+			host := strings.TrimPrefix(ts.URL, "http://")
+
+			var opts []Option
+			if tc.confirmServer {
+				opts = append(opts, WithServerConfirmation())
+			}
+
+			stdin, stdinW := io.Pipe()
+			stdout, stdoutW := io.Pipe()
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				return metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, stdin, stdoutW, opts...)
+			})
+
+			gotConfirmation := false
+			gotJSONReport := false
+			answerIndex := 0
+			scanner := bufio.NewScanner(stdout)
+			scanner.Split(ScanLinesOrQuestion)
+			for scanner.Scan() {
+				txt := scanner.Text()
+				if strings.Contains(txt, ExpectedReportItem) {
+					gotJSONReport = true
+				}
+				isConfirmation := strings.Contains(txt, "which isn't the default server")
+				if isConfirmation {
+					if !strings.Contains(txt, host) {
+						t.Errorf("expected destination host %s in confirmation question, got: %s", host, txt)
+					}
+					if gotJSONReport {
+						t.Error("destination server confirmation should be asked before showing the report")
+					}
+					gotConfirmation = true
+				}
+				if !isConfirmation && !strings.Contains(txt, "Do you agree to report this?") {
+					continue
+				}
+				a := tc.answers[answerIndex]
+				if a == "CTRL-C" {
+					stdinW.Close()
+					break
+				} else {
+					stdinW.Write([]byte(tc.answers[answerIndex] + "\n"))
+				}
+				answerIndex = answerIndex + 1
+				// all answers have be provided
+				if answerIndex >= len(tc.answers) {
+					stdinW.Close()
+					break
+				}
+			}
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("didn't expect to get an error, got:", err)
+			}
+			a.Equal(gotConfirmation, tc.wantConfirmation)
+
+			if !tc.wantWriteAndUpload {
+				a.Equal(serverHitAt, "")
+				if _, err := os.Stat(filepath.Join(out, "ubuntu-report/ubuntu.18.04")); !os.IsNotExist(err) {
+					t.Errorf("we didn't expect finding a cache report path as we said to quit")
+				}
+				return
+			}
+			a.Equal(gotJSONReport, true)
+			if serverHitAt == "" {
+				t.Error("we should have hit the local server and we didn't")
+			}
+		})
+	}
+}
+
+func TestInteractiveMetricsCollectAndSendRemindLater(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		answers      []string
+		remindedAgo  time.Duration
+		alwaysReport bool
+
+		wantPrompt         bool
+		wantWriteAndUpload bool
+		wantReminder       bool
+	}{
+		{"later", []string{"later"}, 0, false, true, false, true},
+		{"l", []string{"l"}, 0, false, true, false, true},
+		{"LATER", []string{"LATER"}, 0, false, true, false, true},
+		{"garbage then later", []string{"garbage", "l"}, 0, false, true, false, true},
+		{"deferred recently", nil, time.Hour, false, false, false, true},
+		{"deferred recently but forced", []string{"yes"}, time.Hour, true, true, true, false},
+		{"deferral expired", []string{"yes"}, remindLaterCooldown + time.Hour, false, true, true, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHitAt := ""
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHitAt = r.URL.String()
+			}))
+			defer ts.Close()
+
+			reminderP := filepath.Join(out, "ubuntu-report/remind-later")
+			if tc.remindedAgo != 0 {
+				if err := os.MkdirAll(filepath.Dir(reminderP), 0700); err != nil {
+					t.Fatal("couldn't create parent directory of reminder", err)
+				}
+				if err := ioutil.WriteFile(reminderP, []byte(time.Now().Add(-tc.remindedAgo).Format(time.RFC3339Nano)), 0600); err != nil {
+					t.Fatal("couldn't setup reminder", err)
+				}
+			}
+
+			stdin, stdinW := io.Pipe()
+			stdout, stdoutW := io.Pipe()
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				err := metricsCollectAndSend(m, ReportInteractive, tc.alwaysReport, ts.URL, out, stdin, stdoutW)
+				stdoutW.Close()
+				return err
+			})
+
+			gotPrompt := false
+			answerIndex := 0
+			scanner := bufio.NewScanner(stdout)
+			scanner.Split(ScanLinesOrQuestion)
+			for scanner.Scan() {
+				txt := scanner.Text()
+				if !strings.Contains(txt, "Do you agree to report this?") {
+					continue
+				}
+				gotPrompt = true
+				stdinW.Write([]byte(tc.answers[answerIndex] + "\n"))
+				answerIndex = answerIndex + 1
+				// all answers have be provided
+				if answerIndex >= len(tc.answers) {
+					stdinW.Close()
+					break
+				}
+			}
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("didn't expect to get an error, got:", err)
+			}
+			a.Equal(gotPrompt, tc.wantPrompt)
+
+			_, err := os.Stat(reminderP)
+			a.Equal(err == nil, tc.wantReminder)
+
+			if !tc.wantWriteAndUpload {
+				a.Equal(serverHitAt, "")
+				if _, err := os.Stat(filepath.Join(out, "ubuntu-report/ubuntu.18.04")); !os.IsNotExist(err) {
+					t.Errorf("we didn't expect finding a report nor an opt-out as the decision was deferred")
+				}
+				return
+			}
+			if serverHitAt == "" {
+				t.Error("we should have hit the local server and we didn't")
+			}
+		})
+	}
+}
+
+func TestInteractiveMetricsCollectAndSendDraft(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		draft   string
+		noDraft bool
+		answers []string
+
+		wantDraftPrompt bool
+		wantUpload      bool
+		wantSentDraft   bool
+		wantDraftKept   bool
+	}{
+		{"quit saves a draft", "", false, []string{"q"}, false, false, false, true},
+		{"quit without drafts", "", true, []string{"q"}, false, false, false, false},
+		{"draft is sent", `{"Version": "18.04", "Draft": true}`, false, []string{"y"}, true, true, true, false},
+		{"draft is sent by default", `{"Version": "18.04", "Draft": true}`, false, []string{""}, true, true, true, false},
+		{"garbage then draft is sent", `{"Version": "18.04", "Draft": true}`, false, []string{"garbage", "yes"}, true, true, true, false},
+		{"draft is discarded", `{"Version": "18.04", "Draft": true}`, false, []string{"n", "y"}, true, true, false, false},
+		{"draft is discarded then quit saves a new one", `{"Version": "18.04", "Draft": true}`, false, []string{"n", "q"}, true, false, false, true},
+		{"draft for another version is discarded", `{"Version": "17.10", "Draft": true}`, false, []string{"y"}, false, true, false, false},
+		{"malformed draft is discarded", `{"Version": "18.04",`, false, []string{"y"}, false, true, false, false},
+		{"draft is ignored without drafts, and obsolete once sent", `{"Version": "18.04", "Draft": true}`, true, []string{"y"}, false, true, false, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
+				"testdata/good", "one gpu", "regular", "one screen",
+				"one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+			defer cancelGPU()
+			defer cancelCPU()
+			defer cancelScreen()
+			defer cancelPartition()
+			defer cancelArchitecture()
+			defer cancelLibc6()
+			defer cancelHwCap()
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			serverHitAt := ""
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHitAt = r.URL.String()
+			}))
+			defer ts.Close()
+
+			draftP := filepath.Join(out, "ubuntu-report/draft")
+			if tc.draft != "" {
+				if err := saveMetrics(draftP, []byte(tc.draft)); err != nil {
+					t.Fatal("couldn't setup draft report", err)
+				}
+			}
+
+			stdin, stdinW := io.Pipe()
+			stdout, stdoutW := io.Pipe()
+
+			cmdErrs := helper.RunFunctionWithTimeout(t, func() error {
+				err := metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, stdin, stdoutW, WithDraft(!tc.noDraft))
+				stdoutW.Close()
+				return err
+			})
+
+			gotDraftPrompt := false
+			answerIndex := 0
+			scanner := bufio.NewScanner(stdout)
+			scanner.Split(ScanLinesOrQuestion)
+			for scanner.Scan() {
+				txt := scanner.Text()
+				if strings.Contains(txt, "Do you want to send it?") {
+					gotDraftPrompt = true
+				} else if !strings.Contains(txt, "Do you agree to report this?") {
+					continue
+				}
+				stdinW.Write([]byte(tc.answers[answerIndex] + "\n"))
+				answerIndex = answerIndex + 1
+				// all answers have be provided
+				if answerIndex >= len(tc.answers) {
+					stdinW.Close()
+					break
+				}
+			}
+
+			if err := <-cmdErrs; err != nil {
+				t.Fatal("didn't expect to get an error, got:", err)
+			}
+			a.Equal(gotDraftPrompt, tc.wantDraftPrompt)
+
+			draft, err := ioutil.ReadFile(draftP)
+			a.Equal(err == nil, tc.wantDraftKept)
+			if tc.wantDraftKept && tc.draft == "" {
+				// the collected report was saved as is
+				a.Equal(strings.Contains(string(draft), `"Version": "18.04"`), true)
+			}
+
+			if !tc.wantUpload {
+				a.Equal(serverHitAt, "")
+				return
+			}
+			if serverHitAt == "" {
+				t.Error("we should have hit the local server and we didn't")
+			}
+			sent, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report/ubuntu.18.04"))
+			if err != nil {
+				t.Fatal("couldn't read sent report", err)
+			}
+			a.Equal(string(sent) == tc.draft, tc.wantSentDraft)
+		})
+	}
+}
+
+func TestMetricsSendPendingReport(t *testing.T) {
+	t.Parallel()
+	initialReportTimeoutDuration = 0
+
+	testCases := []struct {
+		name            string
+		root            string
+		manualServerURL string
+
+		cacheReportP      string
+		pendingReportP    string
+		pendingReportKept bool
+		numHitServer      int
+		sHitHat           string
+		wantErr           bool
+	}{
+		{"send previous report",
+			"testdata/good", "",
+			"ubuntu-report/ubuntu.18.04", "ubuntu-report/pending", false, 1, "/ubuntu/desktop/18.04", false},
+		{"no previous report",
+			"testdata/good", "",
+			"", "", false, 0, "", true},
+		{"send previous report after backoff",
+			"testdata/good", "",
+			"ubuntu-report/ubuntu.18.04", "ubuntu-report/pending", false, 2, "/ubuntu/desktop/18.04", false},
+		{"no IDs (mandatory)",
+			"testdata/no-ids", "",
+			"", "", false, 0, "", true},
+		{"invalid URL",
+			"testdata/good", "http://a b.com/",
+			"", "", false, 0, "", true},
+		{"unwritable path",
+			"testdata/good", "",
+			"", "ubuntu-report/pending", true, 1, "/ubuntu/desktop/18.04", true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics(tc.root, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			if strings.HasPrefix(tc.cacheReportP, "/") {
+				// absolute path, override temporary one
+				out = tc.cacheReportP
+			}
+			var pendingReportData []byte
+			var err error
+			resetwritable := func() {}
+			if tc.pendingReportP != "" {
+				if pendingReportData, err = ioutil.ReadFile(filepath.Join(tc.root, tc.pendingReportP)); err != nil {
+					t.Fatalf("couldn't open pending report file: %v", err)
+				}
+				tc.pendingReportP = filepath.Join(out, tc.pendingReportP)
+				d := filepath.Dir(tc.pendingReportP)
+				if err := os.MkdirAll(d, 0700); err != nil {
+					t.Fatal("couldn't create parent directory of pending report", err)
+				}
+				if err := ioutil.WriteFile(tc.pendingReportP, pendingReportData, 0644); err != nil {
+					t.Fatalf("couldn't copy pending report file to cache directory: %v", err)
+				}
+				// switch back mode to unwritable
+				if strings.HasPrefix(tc.name, "unwritable") {
+					if err := os.Chmod(d, 0500); err != nil {
+						t.Fatalf("couldn't switch %s to not being writable: %v", d, err)
+					}
+					resetwritable = func() {
+						if err := os.Chmod(d, 0700); err != nil {
+							t.Fatalf("couldn't switch %s back to being writable: %v", d, err)
+						}
+					}
+					defer resetwritable()
+				}
+			}
+
+			serverHitAt := ""
+			numHitServer := 0
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				numHitServer++
+				if numHitServer < tc.numHitServer {
+					http.NotFound(w, r)
+					return
+				}
 				serverHitAt = r.URL.String()
 			}))
 			defer ts.Close()
+			url := tc.manualServerURL
+			if url == "" {
+				url = ts.URL
+			}
+
+			err = metricsSendPendingReport(m, url, out, os.Stdout, os.Stdin)
+
+			// restore directory state for checking
+			resetwritable()
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(numHitServer, tc.numHitServer)
+			a.Equal(serverHitAt, tc.sHitHat)
+
+			_, pendingReportErr := os.Stat(tc.pendingReportP)
+			if !tc.pendingReportKept && os.IsExist(pendingReportErr) {
+				t.Errorf("we expected the pending report to be removed and it wasn't")
+			} else if tc.pendingReportKept && os.IsNotExist(pendingReportErr) {
+				t.Errorf("we expected the pending report to be kept and it was removed")
+			}
+
+			// check we didn't do too much work on error
+			if err != nil {
+				if _, err := os.Stat(filepath.Join(out, tc.cacheReportP)); os.IsExist(err) {
+					t.Errorf("we didn't expect finding a cache report path as we erroring out")
+				}
+				return
+			}
+
+			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
+			if err != nil {
+				t.Fatal("didn't generate a report file on disk", err)
+			}
+			got, err := ioutil.ReadAll(gotF)
+			if err != nil {
+				t.Fatal("couldn't read generated report file", err)
+			}
+			a.Equal(got, pendingReportData)
+		})
+	}
+}
+
+func TestMetricsSendPendingReportBaseURL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		configuredURL   bool
+		manualServerURL bool
+
+		wantConfiguredHit bool
+		wantManualHit     bool
+	}{
+		{"configured server", true, false, true, false},
+		{"parameter takes precedence", true, true, false, true},
+		{"parameter only", false, true, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			if err := saveMetrics(filepath.Join(out, "ubuntu-report", "pending"), []byte(`{ "Version": "18.04", "some-data": true }`)); err != nil {
+				t.Fatal("couldn't create pending report", err)
+			}
+			configuredHitAt, manualHitAt := "", ""
+			configured := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				configuredHitAt = r.URL.String()
+			}))
+			defer configured.Close()
+			manual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				manualHitAt = r.URL.String()
+			}))
+			defer manual.Close()
+
+			if tc.configuredURL {
+				if err := metrics.WithBaseURL(configured.URL)(&m); err != nil {
+					t.Fatal("couldn't configure server url", err)
+				}
+			}
+			url := ""
+			if tc.manualServerURL {
+				url = manual.URL
+			}
+
+			err := metricsSendPendingReport(m, url, out, os.Stdin, os.Stdout)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(configuredHitAt != "", tc.wantConfiguredHit)
+			a.Equal(manualHitAt != "", tc.wantManualHit)
+			if tc.wantConfiguredHit {
+				a.Equal(configuredHitAt, "/ubuntu/desktop/18.04")
+			}
+		})
+	}
+}
+
+func TestMetricsSendPendingReportMaxAttempts(t *testing.T) {
+	t.Parallel()
+	initialReportTimeoutDuration = 0
+
+	testCases := []struct {
+		name         string
+		maxAttempts  int
+		failuresLeft int
+
+		wantHits          int
+		pendingReportKept bool
+		wantErr           bool
+	}{
+		{"sent before exhausting attempts", 3, 2, 3, false, false},
+		{"attempts exhausted", 3, 10, 3, true, true},
+		{"single attempt", 1, 10, 1, true, true},
+		{"no limit", 0, 4, 5, false, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			pendingReportData, err := ioutil.ReadFile(filepath.Join("testdata/good", "ubuntu-report/pending"))
+			if err != nil {
+				t.Fatalf("couldn't open pending report file: %v", err)
+			}
+			pendingP := filepath.Join(out, "ubuntu-report/pending")
+			if err := os.MkdirAll(filepath.Dir(pendingP), 0700); err != nil {
+				t.Fatal("couldn't create parent directory of pending report", err)
+			}
+			if err := ioutil.WriteFile(pendingP, pendingReportData, 0644); err != nil {
+				t.Fatalf("couldn't copy pending report file to cache directory: %v", err)
+			}
+
+			numHitServer := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				numHitServer++
+				if numHitServer <= tc.failuresLeft {
+					http.NotFound(w, r)
+					return
+				}
+			}))
+			defer ts.Close()
+
+			err = metricsSendPendingReport(m, ts.URL, out, os.Stdin, os.Stdout, WithMaxAttempts(tc.maxAttempts))
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(numHitServer, tc.wantHits)
+			got, err := ioutil.ReadFile(pendingP)
+			if !tc.pendingReportKept {
+				if !os.IsNotExist(err) {
+					t.Errorf("we expected the pending report to be removed, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("we expected the pending report to be kept", err)
+			}
+			a.Equal(got, pendingReportData)
+		})
+	}
+}
+
+func TestSendWithBackoffGiveUp(t *testing.T) {
+	// we change the backoff duration: not parallelizable tests
+	a := helper.Asserter{T: t}
+	defer func(d time.Duration) { initialReportTimeoutDuration = d }(initialReportTimeoutDuration)
+	initialReportTimeoutDuration = time.Hour
+
+	out, tearDown := helper.TempDir(t)
+	defer tearDown()
+	retryP := filepath.Join(out, "next-retry")
+	attempts := 0
+	send := func() error {
+		attempts++
+		return errors.New("server is down")
+	}
+
+	err := sendWithBackoff(context.Background(), send, retryP, 1)
+	a.CheckWantedErr(err, true)
+	a.Equal(attempts, 1)
+	next, err := loadNextRetry(retryP)
+	if err != nil {
+		t.Fatal("we expected the next retry time to be saved when giving up", err)
+	}
+	if !next.After(time.Now()) {
+		t.Errorf("we expected the next retry time to be in the future, got: %v", next)
+	}
+
+	err = sendWithBackoff(context.Background(), send, retryP, 1)
+	a.CheckWantedErr(err, true)
+	a.Equal(attempts, 1)
+}
+
+func TestMetricsSendPendingReportRetryState(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name           string
+		nextRetryDelay time.Duration
+		invalidState   bool
+
+		shouldHitServer bool
+	}{
+		{"next retry in the future", time.Hour, false, false},
+		{"next retry in the past", -time.Hour, false, true},
+		{"invalid retry state", 0, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			pendingP := filepath.Join(out, "ubuntu-report", "pending")
+			if err := saveMetrics(pendingP, []byte(`{ "some-data": true }`)); err != nil {
+				t.Fatal("couldn't create pending report", err)
+			}
+			state := []byte(time.Now().Add(tc.nextRetryDelay).Format(time.RFC3339Nano))
+			if tc.invalidState {
+				state = []byte("not a date")
+			}
+			retryP := filepath.Join(out, "ubuntu-report", "next-retry")
+			if err := saveMetrics(retryP, state); err != nil {
+				t.Fatal("couldn't create retry state", err)
+			}
+
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			start := time.Now()
+			err := metricsSendPendingReport(m, ts.URL, out, os.Stdout, os.Stdin)
+
+			a.Equal(serverHit, tc.shouldHitServer)
+			if d := time.Since(start); d > 5*time.Second {
+				t.Errorf("we expected to return without waiting for the next retry, but took %v", d)
+			}
+			if !tc.shouldHitServer {
+				if !errors.Is(err, ErrPendingWritten) {
+					t.Errorf("we expected the pending report to be kept for a later try, got: %v", err)
+				}
+				if _, err := os.Stat(pendingP); err != nil {
+					t.Errorf("we expected the pending report to be kept: %v", err)
+				}
+				if _, err := os.Stat(retryP); err != nil {
+					t.Errorf("we expected the retry state to be kept: %v", err)
+				}
+				return
+			}
+			a.CheckWantedErr(err, false)
+			if _, err := os.Stat(retryP); !os.IsNotExist(err) {
+				t.Errorf("we expected the retry state to be removed after a successful send, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestMetricsSendPendingReportRateLimit(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name         string
+		lastSendAgo  time.Duration
+		noLastSend   bool
+		invalidState bool
+
+		shouldHitServer bool
+	}{
+		{"first pending report", 0, true, false, true},
+		{"pending report sent recently", time.Hour, false, false, false},
+		{"pending report sent a while ago", 25 * time.Hour, false, false, true},
+		{"last send in the future", -time.Hour, false, false, true},
+		{"invalid last send state", 0, false, true, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			pendingP := filepath.Join(out, "ubuntu-report", "pending")
+			if err := saveMetrics(pendingP, []byte(`{ "some-data": true }`)); err != nil {
+				t.Fatal("couldn't create pending report", err)
+			}
+			lastSendP := filepath.Join(out, "ubuntu-report", "last-send")
+			if !tc.noLastSend {
+				state := []byte(time.Now().Add(-tc.lastSendAgo).Format(time.RFC3339Nano))
+				if tc.invalidState {
+					state = []byte("not a date")
+				}
+				if err := saveMetrics(lastSendP, state); err != nil {
+					t.Fatal("couldn't create last send state", err)
+				}
+			}
+
+			serverHit := false
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHit = true
+			}))
+			defer ts.Close()
+
+			start := time.Now()
+			err := metricsSendPendingReport(m, ts.URL, out, os.Stdout, os.Stdin)
+
+			a.Equal(serverHit, tc.shouldHitServer)
+			if !tc.shouldHitServer {
+				if !errors.Is(err, ErrRateLimited) {
+					t.Errorf("expected a rate limited error, got: %v", err)
+				}
+				if _, err := os.Stat(pendingP); err != nil {
+					t.Errorf("we expected the pending report to be kept, got: %v", err)
+				}
+				return
+			}
+			a.CheckWantedErr(err, false)
+			b, err := ioutil.ReadFile(lastSendP)
+			if err != nil {
+				t.Fatal("couldn't read last send state", err)
+			}
+			lastSend, err := time.Parse(time.RFC3339Nano, string(b))
+			if err != nil {
+				t.Fatal("last send state isn't a valid time", err)
+			}
+			if lastSend.Before(start) {
+				t.Errorf("we expected the last send time to be updated, got: %v", lastSend)
+			}
+		})
+	}
+}
+
+func TestInstallID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		existing string
 
-			err := metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+		wantReused bool
+	}{
+		{"generated on first use", "", false},
+		{"reused on subsequent runs", "0f8fad5b-d9cb-469f-a165-70867728950e\n", true},
+		{"invalid install id is replaced", "not an id", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			p := filepath.Join(out, "ubuntu-report", "install-id")
+			if tc.existing != "" {
+				if err := saveMetrics(p, []byte(tc.existing)); err != nil {
+					t.Fatal("couldn't create install id", err)
+				}
+			}
+
+			got, err := installID(out, true)
 			if err != nil {
-				t.Fatal("Didn't expect first call to fail")
+				t.Fatal("didn't expect getting the install id to fail", err)
 			}
 
-			// second call, reset server
-			serverHitAt = ""
+			if tc.wantReused {
+				a.Equal(got, strings.TrimSpace(tc.existing))
+			}
+			if !installIDRegexp.MatchString(got) {
+				t.Errorf("install id %q isn't a random UUID", got)
+			}
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				t.Fatal("install id wasn't saved", err)
+			}
+			a.Equal(strings.TrimSpace(string(b)), got)
+
+			again, err := installID(out, true)
+			if err != nil {
+				t.Fatal("didn't expect getting the install id a second time to fail", err)
+			}
+			a.Equal(again, got)
+		})
+	}
+}
+
+func TestMetricsCollectAndSendInstallID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		r    ReportType
+		opts []Option
+
+		wantSaved bool
+	}{
+		{"saved on send", ReportAuto, nil, true},
+		{"not saved in stateless mode", ReportAuto, []Option{WithStateless(true)}, false},
+		{"not saved on dry run", ReportDryRun, nil, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
 			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
-				cancelArchitecture, cancelLibc6, cancelHwCap = newTestMetricsWithCommands(t,
-				"testdata/good", "one gpu", "regular", "one screen",
-				"one partition", "regular", "regular", "regular",
-				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t, "testdata/good",
+				"one gpu", "regular", "one screen", "one partition",
+				"regular", "regular", "regular",
+				map[string]string{"LANG": "fr_FR.UTF-8"})
 			defer cancelGPU()
 			defer cancelCPU()
 			defer cancelScreen()
@@ -456,67 +3163,120 @@ func TestMultipleMetricsCollectAndSend(t *testing.T) {
 			defer cancelArchitecture()
 			defer cancelLibc6()
 			defer cancelHwCap()
-			err = metricsCollectAndSend(m, ReportAuto, tc.alwaysReport, ts.URL, out, os.Stdout, os.Stdin)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			var sent []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent, _ = ioutil.ReadAll(r.Body)
+			}))
+			defer ts.Close()
+			var stdout bytes.Buffer
+
+			err := metricsCollectAndSend(m, tc.r, false, ts.URL, out, os.Stdin, &stdout, append(tc.opts, WithInstallID(true))...)
 
-			a.CheckWantedErr(err, tc.wantErr)
-			// check we didn't do too much work on error
 			if err != nil {
-				if !tc.shouldHitServer {
-					a.Equal(serverHitAt, "")
-				}
-				if tc.shouldHitServer && serverHitAt == "" {
-					t.Error("we should have hit the local server and we didn't")
+				t.Fatal("we didn't expect an error and got:", err)
+			}
+			report := sent
+			if tc.r == ReportDryRun {
+				report = stdout.Bytes()
+			}
+			var got struct{ InstallID string }
+			if err := json.Unmarshal(report, &got); err != nil {
+				t.Fatal("couldn't parse report", err)
+			}
+			if !installIDRegexp.MatchString(got.InstallID) {
+				t.Errorf("install id %q isn't a random UUID", got.InstallID)
+			}
+			b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "install-id"))
+			a.Equal(err == nil, tc.wantSaved)
+			if tc.wantSaved {
+				a.Equal(strings.TrimSpace(string(b)), got.InstallID)
+			}
+		})
+	}
+}
+
+func TestInstallIDIsRandom(t *testing.T) {
+	t.Parallel()
+
+	out1, tearDown := helper.TempDir(t)
+	defer tearDown()
+	out2, tearDown := helper.TempDir(t)
+	defer tearDown()
+
+	id1, err := installID(out1, true)
+	if err != nil {
+		t.Fatal("didn't expect getting the install id to fail", err)
+	}
+	id2, err := installID(out2, true)
+	if err != nil {
+		t.Fatal("didn't expect getting the install id to fail", err)
+	}
+	if id1 == id2 {
+		t.Errorf("install ids of 2 different installs should differ, got %q twice", id1)
+	}
+}
+
+func TestAppendHistory(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		existing   string
+		numEntries int
+		maxEntries int
+
+		want string
+	}{
+		{"first entry", "", 1, 5, "entry 0\n"},
+		{"below cap", "", 3, 5, "entry 0\nentry 1\nentry 2\n"},
+		{"exactly at cap", "", 5, 5, "entry 0\nentry 1\nentry 2\nentry 3\nentry 4\n"},
+		{"above cap keeps most recent", "", 8, 5, "entry 3\nentry 4\nentry 5\nentry 6\nentry 7\n"},
+		{"existing log above cap is trimmed", "old 0\nold 1\nold 2\nold 3\nold 4\nold 5\n", 1, 3, "old 4\nold 5\nentry 0\n"},
+		{"existing log without trailing newline", "old 0", 1, 5, "old 0\nentry 0\n"},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			p := filepath.Join(out, "ubuntu-report", "history")
+			if tc.existing != "" {
+				if err := saveMetrics(p, []byte(tc.existing)); err != nil {
+					t.Fatal("couldn't create existing history log", err)
 				}
-				return
 			}
-			a.Equal(serverHitAt, tc.sHitHat)
-			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
-			if err != nil {
-				t.Fatal("didn't generate a report file on disk", err)
+
+			for i := 0; i < tc.numEntries; i++ {
+				if err := appendHistory(p, []byte(fmt.Sprintf("entry %d", i)), tc.maxEntries); err != nil {
+					t.Fatal("got an error when expecting none:", err)
+				}
 			}
-			got, err := ioutil.ReadAll(gotF)
+
+			got, err := ioutil.ReadFile(p)
 			if err != nil {
-				t.Fatal("couldn't read generated report file", err)
+				t.Fatal("couldn't read history log", err)
 			}
-			want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata/good", "gold", fmt.Sprintf("cachereport-twice.ReportType%d", int(ReportAuto))), got, *Update)
-			a.Equal(got, want)
+			a.Equal(string(got), tc.want)
 		})
 	}
 }
 
-func TestMetricsCollectAndSendOnUpgrade(t *testing.T) {
+func TestMetricsSpool(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		name            string
-		previousReportP string
+		name string
+		root string
 
-		cacheReportP    string
-		shouldHitServer bool
-		wantOptOut      bool
-		wantErr         bool
+		wantErr bool
 	}{
-		{"without previous report",
-			"",
-			"", false, false, false},
-		{"with previous report, current release",
-			"testdata/previous_reports/current_release",
-			"", false, false, true},
-		{"with previous report, previous release opt in",
-			"testdata/previous_reports/previous_release_optin",
-			"ubuntu-report/ubuntu.18.04", true, false, false},
-		{"with previous report, previous release opt out",
-			"testdata/previous_reports/previous_release_optout",
-			"ubuntu-report/ubuntu.18.04", true, true, false},
-		{"with two previous reports, latest previous release opt in",
-			"testdata/previous_reports/latest_previous_release_optin",
-			"ubuntu-report/ubuntu.18.04", true, false, false},
-		{"with two previous reports, latest previous release opt out",
-			"testdata/previous_reports/latest_previous_release_optout",
-			"ubuntu-report/ubuntu.18.04", true, true, false},
-		{"with different distro reports, current optin, other distro more recent opt out",
-			"testdata/previous_reports/previous_with_different_distros",
-			"ubuntu-report/ubuntu.18.04", true, false, false},
+		{"regular spool", "testdata/good", false},
+		{"no IDs (mandatory)", "testdata/no-ids", true},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -525,11 +3285,9 @@ func TestMetricsCollectAndSendOnUpgrade(t *testing.T) {
 			a := helper.Asserter{T: t}
 
 			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
-				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
-				"testdata/good", "one gpu", "regular", "one screen",
-				"one partition", "regular", "regular", "regular",
-				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession",
-					"XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
+				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t, tc.root,
+				"one gpu", "regular", "one screen", "one partition", "regular", "regular", "regular",
+				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
 			defer cancelGPU()
 			defer cancelCPU()
 			defer cancelScreen()
@@ -539,104 +3297,251 @@ func TestMetricsCollectAndSendOnUpgrade(t *testing.T) {
 			defer cancelHwCap()
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
-
-			if tc.previousReportP != "" {
-				reportDir := filepath.Join(out, "ubuntu-report")
-				if err := os.MkdirAll(reportDir, 0700); err != nil {
-					t.Fatalf("couldn't create report directory: %v", err)
-				}
-				files, err := ioutil.ReadDir(tc.previousReportP)
-				if err != nil {
-					t.Fatalf("couldn't list files under %s: %v", tc.previousReportP, err)
-				}
-				for _, file := range files {
-					data, err := ioutil.ReadFile(filepath.Join(tc.previousReportP, file.Name()))
-					if err != nil {
-						t.Fatalf("couldn't read report file: %v", err)
-					}
-					if err = ioutil.WriteFile(filepath.Join(reportDir, file.Name()), data, 0644); err != nil {
-						t.Fatalf("couldn't write to destination report file in setup: %v", err)
-					}
-				}
-			}
-
 			serverHit := false
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				serverHit = true
 			}))
 			defer ts.Close()
-			url := ts.URL
 
-			err := metricsCollectAndSendOnUpgrade(m, false, url, out, os.Stdout, os.Stdin)
+			err := metricsCollectAndSend(m, ReportSpool, false, ts.URL, out, os.Stdout, os.Stdin)
 
 			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(serverHit, false)
+			if _, err := os.Stat(filepath.Join(out, "ubuntu-report", "ubuntu.18.04")); !os.IsNotExist(err) {
+				t.Errorf("we didn't expect finding a cache report path as the report was only spooled")
+			}
+			files, _ := ioutil.ReadDir(filepath.Join(out, "ubuntu-report", "spool"))
 			// check we didn't do too much work on error
+			if tc.wantErr {
+				a.Equal(len(files), 0)
+				return
+			}
+			if len(files) != 1 {
+				t.Fatalf("expected one spooled report, got %d", len(files))
+			}
+			b, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "spool", files[0].Name()))
 			if err != nil {
-				if tc.shouldHitServer && serverHit == false {
-					t.Error("we should have hit the local server and we didn't")
+				t.Fatal("couldn't read spooled report", err)
+			}
+			meta, data, err := parseSpooledReport(b)
+			if err != nil {
+				t.Fatal("spooled report isn't valid", err)
+			}
+			a.Equal(meta.Distro, "ubuntu")
+			a.Equal(meta.Version, "18.04")
+			if !strings.Contains(string(data), ExpectedReportItem) {
+				t.Errorf("we expected to find %s in spooled report, got: %s", ExpectedReportItem, data)
+			}
+		})
+	}
+}
+
+func TestMetricsFlushSpool(t *testing.T) {
+	t.Parallel()
+	initialReportTimeoutDuration = 0
+
+	testCases := []struct {
+		name      string
+		spooled   map[string]string
+		nextRetry string
+
+		wantHits    []string
+		wantReports map[string]string
+		wantKept    []string
+		wantErr     bool
+	}{
+		{"multiple reports",
+			map[string]string{
+				"ubuntu.18.04.1": `{"Distro":"ubuntu","Version":"18.04"}` + "\n" + `{ "Version": "18.04", "some-data": true }`,
+				"ubuntu.18.10.2": `{"Distro":"ubuntu","Version":"18.10"}` + "\n" + optOutJSON}, "",
+			[]string{"/ubuntu/desktop/18.04", "/ubuntu/desktop/18.10"},
+			map[string]string{"ubuntu.18.04": `{ "Version": "18.04", "some-data": true }`, "ubuntu.18.10": optOutJSON},
+			nil, false},
+		{"invalid report is kept",
+			map[string]string{
+				"ubuntu.18.04.1": `{"Distro":"ubuntu","Version":"18.04"}` + "\n" + `{ "Version": "18.04", "some-data": true }`,
+				"garbage":        "no metadata"}, "",
+			[]string{"/ubuntu/desktop/18.04"},
+			map[string]string{"ubuntu.18.04": `{ "Version": "18.04", "some-data": true }`},
+			[]string{"garbage"}, false},
+		{"spool retry state delays flush",
+			map[string]string{
+				"ubuntu.18.04.1": `{"Distro":"ubuntu","Version":"18.04"}` + "\n" + `{ "Version": "18.04", "some-data": true }`}, "spool-next-retry",
+			nil, nil, []string{"ubuntu.18.04.1"}, true},
+		{"pending retry state doesn't delay flush",
+			map[string]string{
+				"ubuntu.18.04.1": `{"Distro":"ubuntu","Version":"18.04"}` + "\n" + `{ "Version": "18.04", "some-data": true }`}, "next-retry",
+			[]string{"/ubuntu/desktop/18.04"},
+			map[string]string{"ubuntu.18.04": `{ "Version": "18.04", "some-data": true }`},
+			nil, false},
+		{"nothing spooled", nil, "", nil, nil, nil, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			spoolDir := filepath.Join(out, "ubuntu-report", "spool")
+			if tc.spooled != nil {
+				if err := os.MkdirAll(spoolDir, 0700); err != nil {
+					t.Fatal("couldn't create spool directory", err)
 				}
-				if !tc.shouldHitServer && serverHit == true {
-					t.Error("we have hit the local server when we shouldn't have")
+			}
+			for name, content := range tc.spooled {
+				if err := ioutil.WriteFile(filepath.Join(spoolDir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("couldn't create spooled report %s: %v", name, err)
 				}
-				return
 			}
-			a.Equal(serverHit, tc.shouldHitServer)
-			// case with no report to generate (no previous answer)
-			if tc.cacheReportP == "" {
-				files, err := ioutil.ReadDir(filepath.Join(out, "ubuntu-report"))
+
+			if tc.nextRetry != "" {
+				if err := saveMetrics(filepath.Join(out, "ubuntu-report", tc.nextRetry), []byte(time.Now().Add(time.Hour).Format(time.RFC3339Nano))); err != nil {
+					t.Fatal("couldn't create retry state", err)
+				}
+			}
+
+			var serverHits []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHits = append(serverHits, r.URL.String())
+			}))
+			defer ts.Close()
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			err := metricsFlushSpool(m, ts.URL, out)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(serverHits, tc.wantHits)
+			for name, want := range tc.wantReports {
+				got, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", name))
 				if err != nil {
-					return
+					t.Fatalf("couldn't read report file %s: %v", name, err)
 				}
-				if len(files) != 0 {
-					t.Fatalf("we expected no report to be generated but we found some")
+				a.Equal(string(got), want)
+			}
+			files, _ := ioutil.ReadDir(spoolDir)
+			var kept []string
+			for _, f := range files {
+				kept = append(kept, f.Name())
+			}
+			a.Equal(kept, tc.wantKept)
+		})
+	}
+}
+
+func TestMetricsFlushSpoolBaseURL(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name            string
+		configuredURL   bool
+		manualServerURL bool
+
+		wantConfiguredHit bool
+		wantManualHit     bool
+	}{
+		{"configured server", true, false, true, false},
+		{"parameter takes precedence", true, true, false, true},
+		{"parameter only", false, true, false, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			out, tearDown := helper.TempDir(t)
+			defer tearDown()
+			if err := saveMetrics(filepath.Join(out, "ubuntu-report", "spool", "ubuntu.18.04.1"),
+				[]byte(`{"Distro":"ubuntu","Version":"18.04"}`+"\n"+`{ "Version": "18.04", "some-data": true }`)); err != nil {
+				t.Fatal("couldn't create spooled report", err)
+			}
+			configuredHitAt, manualHitAt := "", ""
+			configured := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				configuredHitAt = r.URL.String()
+			}))
+			defer configured.Close()
+			manual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				manualHitAt = r.URL.String()
+			}))
+			defer manual.Close()
+
+			if tc.configuredURL {
+				if err := metrics.WithBaseURL(configured.URL)(&m); err != nil {
+					t.Fatal("couldn't configure server url", err)
 				}
-				return
 			}
+			url := ""
+			if tc.manualServerURL {
+				url = manual.URL
+			}
+
+			err := metricsFlushSpool(m, url, out)
+
+			a.CheckWantedErr(err, false)
+			a.Equal(configuredHitAt != "", tc.wantConfiguredHit)
+			a.Equal(manualHitAt != "", tc.wantManualHit)
+			if tc.wantConfiguredHit {
+				a.Equal(configuredHitAt, "/ubuntu/desktop/18.04")
+			}
+		})
+	}
+}
+
+func TestVerifyReport(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		data string
+
+		wantErr bool
+	}{
+		{"regular", `{"Version": "18.04", "CPU": {"Vendor": "Genuine"}, "Install": {"Type": "GTK"}, "Upgrade": {"From": "17.10"}}`, false},
+		{"unknown fields are accepted", `{"Version": "18.04", "some-data": true}`, false},
+		{"null sub-objects", `{"Version": "18.04", "Install": null}`, false},
+		{"snake_case fields", `{"report_version": 1, "version": "18.04", "install": {"type": "GTK"}}`, false},
+		{"missing version", `{"CPU": {"Vendor": "Genuine"}}`, true},
+		{"snake_case install isn't an object", `{"version": "18.04", "install": "GTK"}`, true},
+		{"opt-out", optOutJSON, true},
+		{"malformed json", `{"Version": "18.04",`, true},
+		{"not an object", `["Version"]`, true},
+		{"sub-object of the wrong type", `{"Version": "18.04", "CPU": "Genuine"}`, true},
+		{"field of the wrong type", `{"Version": 18.04}`, true},
+		{"install isn't an object", `{"Version": "18.04", "Install": "GTK"}`, true},
+		{"upgrade isn't an object", `{"Version": "18.04", "Upgrade": [1337]}`, true},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
 
-			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
-			if err != nil {
-				t.Fatal("didn't generate a report file on disk", err)
-			}
-			got, err := ioutil.ReadAll(gotF)
-			if err != nil {
-				t.Fatal("couldn't read generated report file", err)
-			}
-			isOptOut := strings.Contains(string(got), optOutJSON)
+			err := ValidateReport([]byte(tc.data))
 
-			if tc.wantOptOut && !isOptOut {
-				t.Errorf("we wanted an opt out as we opted out in previous release but got some data in: %s", got)
-			} else if !tc.wantOptOut && isOptOut {
-				t.Errorf("we wanted some data which are not opt out information, but got opt out content instead")
-			}
+			a.CheckWantedErr(err, tc.wantErr)
 		})
 	}
 }
 
-func TestInteractiveMetricsCollectAndSend(t *testing.T) {
+func TestMetricsFlushSpoolOptions(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		name    string
-		answers []string
+		name string
+		opts []Option
 
-		cacheReportP       string
-		wantWriteAndUpload bool
+		wantBody  string
+		wantSaved bool
 	}{
-		{"yes", []string{"yes"}, "ubuntu-report/ubuntu.18.04", true},
-		{"y", []string{"y"}, "ubuntu-report/ubuntu.18.04", true},
-		{"YES", []string{"YES"}, "ubuntu-report/ubuntu.18.04", true},
-		{"Y", []string{"Y"}, "ubuntu-report/ubuntu.18.04", true},
-		{"no", []string{"no"}, "ubuntu-report/ubuntu.18.04", true},
-		{"n", []string{"n"}, "ubuntu-report/ubuntu.18.04", true},
-		{"NO", []string{"NO"}, "ubuntu-report/ubuntu.18.04", true},
-		{"n", []string{"N"}, "ubuntu-report/ubuntu.18.04", true},
-		{"quit", []string{"quit"}, "ubuntu-report/ubuntu.18.04", false},
-		{"q", []string{"q"}, "ubuntu-report/ubuntu.18.04", false},
-		{"QUIT", []string{"QUIT"}, "ubuntu-report/ubuntu.18.04", false},
-		{"Q", []string{"Q"}, "ubuntu-report/ubuntu.18.04", false},
-		{"default-quit", []string{""}, "ubuntu-report/ubuntu.18.04", false},
-		{"garbage-then-quit", []string{"garbage", "yesgarbage", "nogarbage", "quitgarbage", "Q"}, "ubuntu-report/ubuntu.18.04", false},
-		{"ctrl-c-input", []string{"CTRL-C"}, "ubuntu-report/ubuntu.18.04", false},
+		{"no option", nil, `{"Version":"18.04","Autologin":true,"some-data":true}`, true},
+		{"excluded fields", []Option{WithExcludedFields([]string{"Autologin"})}, `{"Version":"18.04","some-data":true}`, true},
+		{"pre-send hook", []Option{WithPreSendHook(func(data []byte) ([]byte, error) {
+			return []byte(`{"Version":"18.04","hooked":true}`), nil
+		})}, `{"Version":"18.04","hooked":true}`, true},
+		{"stateless", []Option{WithStateless(true)}, `{"Version":"18.04","Autologin":true,"some-data":true}`, false},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -644,130 +3549,175 @@ func TestInteractiveMetricsCollectAndSend(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m, cancelGPU, cancelCPU, cancelScreen, cancelPartition,
-				cancelArchitecture, cancelLibc6, cancelHwCap := newTestMetricsWithCommands(t,
-				"testdata/good", "one gpu", "regular", "one screen",
-				"one partition", "regular", "regular", "regular",
-				map[string]string{"XDG_CURRENT_DESKTOP": "some:thing", "XDG_SESSION_DESKTOP": "ubuntusession", "XDG_SESSION_TYPE": "x12", "LANG": "fr_FR.UTF-8", "LANGUAGE": "fr_FR.UTF-8"})
-			defer cancelGPU()
-			defer cancelCPU()
-			defer cancelScreen()
-			defer cancelPartition()
-			defer cancelArchitecture()
-			defer cancelLibc6()
-			defer cancelHwCap()
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
 			out, tearDown := helper.TempDir(t)
 			defer tearDown()
-			serverHitAt := ""
+			if err := metricsSpool(m, []byte(`{"Version":"18.04","Autologin":true,"some-data":true}`), out); err != nil {
+				t.Fatal("couldn't spool report", err)
+			}
+
+			var got []byte
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				serverHitAt = r.URL.String()
+				got, _ = ioutil.ReadAll(r.Body)
 			}))
 			defer ts.Close()
 
-			stdin, stdinW := io.Pipe()
-			stdout, stdoutW := io.Pipe()
-
-			cmdErrs := helper.RunFunctionWithTimeout(t, func() error { return metricsCollectAndSend(m, ReportInteractive, false, ts.URL, out, stdin, stdoutW) })
+			err := metricsFlushSpool(m, ts.URL, out, tc.opts...)
 
-			gotJSONReport := false
-			answerIndex := 0
-			scanner := bufio.NewScanner(stdout)
-			scanner.Split(ScanLinesOrQuestion)
-			for scanner.Scan() {
-				txt := scanner.Text()
-				// first, we should have a known element
-				if strings.Contains(txt, ExpectedReportItem) {
-					gotJSONReport = true
-				}
-				if !strings.Contains(txt, "Do you agree to report this?") {
-					continue
-				}
-				a := tc.answers[answerIndex]
-				if a == "CTRL-C" {
-					stdinW.Close()
-					break
-				} else {
-					stdinW.Write([]byte(tc.answers[answerIndex] + "\n"))
-				}
-				answerIndex = answerIndex + 1
-				// all answers have be provided
-				if answerIndex >= len(tc.answers) {
-					stdinW.Close()
-					break
-				}
+			a.CheckWantedErr(err, false)
+			a.Equal(compactJSON(got), compactJSON([]byte(tc.wantBody)))
+			saved, err := ioutil.ReadFile(filepath.Join(out, "ubuntu-report", "ubuntu.18.04"))
+			a.Equal(err == nil, tc.wantSaved)
+			if tc.wantSaved {
+				a.Equal(compactJSON(saved), compactJSON([]byte(tc.wantBody)))
 			}
+		})
+	}
+}
 
-			if err := <-cmdErrs; err != nil {
-				t.Fatal("didn't expect to get an error, got:", err)
-			}
-			a.Equal(gotJSONReport, true)
+func TestMetricsSendSpool(t *testing.T) {
+	t.Parallel()
 
-			// check we didn't do too much work on error
-			if !tc.wantWriteAndUpload {
-				a.Equal(serverHitAt, "")
-				if _, err := os.Stat(filepath.Join(out, tc.cacheReportP)); !os.IsNotExist(err) {
-					t.Errorf("we didn't expect finding a cache report path as we said to quit")
+	testCases := []struct {
+		name       string
+		reports    map[string]string
+		serverDown bool
+
+		wantSent int
+		wantHits int
+		wantKept []string
+		wantErr  bool
+	}{
+		{"valid and malformed reports",
+			map[string]string{
+				"report1":   `{"Version":"18.04","some-data":true}`,
+				"report2":   `{"Version":"18.10","some-data":true}`,
+				"malformed": `{"Version":"18.04",`},
+			false, 2, 2, []string{"malformed"}, true},
+		{"report without version is kept",
+			map[string]string{
+				"report1":    `{"Version":"18.04","some-data":true}`,
+				"no-version": `{"some-data":true}`},
+			false, 1, 1, []string{"no-version"}, true},
+		{"reports being written are ignored",
+			map[string]string{
+				"report1":     `{"Version":"18.04","some-data":true}`,
+				".report2.42": `{"Version":"18.04",`},
+			false, 1, 1, []string{".report2.42"}, false},
+		{"reports spooled with metadata",
+			map[string]string{
+				"ubuntu.18.04.1": `{"Distro":"ubuntu","Version":"18.04"}` + "\n" + `{"Version":"18.04","some-data":true}`,
+				"report2":        `{"Version":"18.10","some-data":true}`},
+			false, 2, 2, nil, false},
+		{"spooled report without version is kept",
+			map[string]string{
+				"ubuntu.18.04.1": `{"Distro":"ubuntu","Version":"18.04"}` + "\n" + `{"some-data":true}`},
+			false, 0, 0, []string{"ubuntu.18.04.1"}, true},
+		{"test reports are kept",
+			map[string]string{
+				"report1":     `{"Version":"18.04","some-data":true}`,
+				"test-report": `{"Version":"18.04","Test":true}`},
+			false, 1, 1, []string{"test-report"}, true},
+		{"failed reports are kept",
+			map[string]string{
+				"report1": `{"Version":"18.04","some-data":true}`,
+				"report2": `{"Version":"18.10","some-data":true}`},
+			true, 0, 2, []string{"report1", "report2"}, true},
+		{"empty directory", map[string]string{}, false, 0, 0, nil, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // capture range variable for parallel execution
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			a := helper.Asserter{T: t}
+
+			dir, tearDown := helper.TempDir(t)
+			defer tearDown()
+			for name, content := range tc.reports {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("couldn't create report %s: %v", name, err)
 				}
-				return
-			}
-			if serverHitAt == "" {
-				t.Error("we should have hit the local server and we didn't")
-			}
-			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
-			if err != nil {
-				t.Fatal("didn't generate a report file on disk", err)
-			}
-			got, err := ioutil.ReadAll(gotF)
-			if err != nil {
-				t.Fatal("couldn't read generated report file", err)
 			}
-            
-            // To avoid case-insensitive file name collisions, append command case to golden file name.
-            cmdCase := "lc"
-            if 'A' <= tc.name[0] && tc.name[0] <= 'Z' {
-                cmdCase = "uc"
-            }
 
-			want := helper.LoadOrUpdateGolden(t, filepath.Join("testdata/good", "gold", fmt.Sprintf("cachereport-twice.ReportType%d-%s-%s", int(ReportInteractive), strings.Replace(tc.name, " ", "-", -1), cmdCase)), got, *Update)
-			a.Equal(got, want)
+			var serverHits int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				serverHits++
+				if tc.serverDown {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer ts.Close()
+
+			cache, tearDownCache := helper.TempDir(t)
+			defer tearDownCache()
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+			sent, err := metricsSendSpool(m, dir, ts.URL, cache)
+
+			a.CheckWantedErr(err, tc.wantErr)
+			a.Equal(sent, tc.wantSent)
+			a.Equal(serverHits, tc.wantHits)
+			files, _ := ioutil.ReadDir(dir)
+			var kept []string
+			for _, f := range files {
+				kept = append(kept, f.Name())
+			}
+			a.Equal(kept, tc.wantKept)
 		})
 	}
 }
 
-func TestMetricsSendPendingReport(t *testing.T) {
+func TestMetricsSendSpoolOptions(t *testing.T) {
+	t.Parallel()
+	a := helper.Asserter{T: t}
+
+	data := `{"Version":"18.04","some-data":true}`
+	dir, tearDown := helper.TempDir(t)
+	defer tearDown()
+	if err := ioutil.WriteFile(filepath.Join(dir, "report1"), []byte(data), 0644); err != nil {
+		t.Fatal("couldn't create report", err)
+	}
+	cache, tearDownCache := helper.TempDir(t)
+	defer tearDownCache()
+
+	var got http.Header
+	var gotBody []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		gotBody, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	sent, err := metricsSendSpool(m, dir, ts.URL, cache,
+		WithExtraHeaders(map[string]string{"X-Tenant": "fleet-a"}), WithDigestHeader(nil),
+		WithExcludedFields([]string{"some-data"}))
+
+	a.CheckWantedErr(err, false)
+	a.Equal(sent, 1)
+	a.Equal(got.Get("X-Tenant"), "fleet-a")
+	a.Equal(compactJSON(gotBody), `{"Version":"18.04"}`)
+	a.Equal(got.Get(sender.DigestHeader), sender.Digest(gotBody))
+}
+
+func TestMetricsSendSpoolURL(t *testing.T) {
 	t.Parallel()
-	initialReportTimeoutDuration = 0
 
 	testCases := []struct {
 		name            string
-		root            string
+		report          string
+		configuredURL   bool
 		manualServerURL string
 
-		cacheReportP      string
-		pendingReportP    string
-		pendingReportKept bool
-		numHitServer      int
-		sHitHat           string
-		wantErr           bool
+		wantHitAt string
+		wantErr   bool
 	}{
-		{"send previous report",
-			"testdata/good", "",
-			"ubuntu-report/ubuntu.18.04", "ubuntu-report/pending", false, 1, "/ubuntu/desktop/18.04", false},
-		{"no previous report",
-			"testdata/good", "",
-			"", "", false, 0, "", true},
-		{"send previous report after backoff",
-			"testdata/good", "",
-			"ubuntu-report/ubuntu.18.04", "ubuntu-report/pending", false, 2, "/ubuntu/desktop/18.04", false},
-		{"no IDs (mandatory)",
-			"testdata/no-ids", "",
-			"", "", false, 0, "", true},
-		{"invalid URL",
-			"testdata/good", "http://a b.com/",
-			"", "", false, 0, "", true},
-		{"unwritable path",
-			"testdata/good", "",
-			"", "ubuntu-report/pending", true, 1, "/ubuntu/desktop/18.04", true},
+		{"spooled report", `{"Distro":"debian","Version":"12"}` + "\n" + `{"Version":"12","some-data":true}`, false, "",
+			"/debian/desktop/12", false},
+		{"bare report", `{"Version":"18.10","some-data":true}`, false, "", "/ubuntu/desktop/18.10", false},
+		{"snake case bare report", `{"version":"18.10","some-data":true}`, false, "", "/ubuntu/desktop/18.10", false},
+		{"configured server", `{"Version":"18.04","some-data":true}`, true, "", "/ubuntu/desktop/18.04", false},
+		{"invalid URL", `{"Version":"18.04","some-data":true}`, false, "http://a b.com/", "", true},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable for parallel execution
@@ -775,92 +3725,48 @@ func TestMetricsSendPendingReport(t *testing.T) {
 			t.Parallel()
 			a := helper.Asserter{T: t}
 
-			m := metrics.NewTestMetrics(tc.root, nil, nil, nil, nil, nil, nil, nil, os.Getenv)
-			out, tearDown := helper.TempDir(t)
+			dir, tearDown := helper.TempDir(t)
 			defer tearDown()
-			if strings.HasPrefix(tc.cacheReportP, "/") {
-				// absolute path, override temporary one
-				out = tc.cacheReportP
-			}
-			var pendingReportData []byte
-			var err error
-			resetwritable := func() {}
-			if tc.pendingReportP != "" {
-				if pendingReportData, err = ioutil.ReadFile(filepath.Join(tc.root, tc.pendingReportP)); err != nil {
-					t.Fatalf("couldn't open pending report file: %v", err)
-				}
-				tc.pendingReportP = filepath.Join(out, tc.pendingReportP)
-				d := filepath.Dir(tc.pendingReportP)
-				if err := os.MkdirAll(d, 0700); err != nil {
-					t.Fatal("couldn't create parent directory of pending report", err)
-				}
-				if err := ioutil.WriteFile(tc.pendingReportP, pendingReportData, 0644); err != nil {
-					t.Fatalf("couldn't copy pending report file to cache directory: %v", err)
-				}
-				// switch back mode to unwritable
-				if strings.HasPrefix(tc.name, "unwritable") {
-					if err := os.Chmod(d, 0500); err != nil {
-						t.Fatalf("couldn't switch %s to not being writable: %v", d, err)
-					}
-					resetwritable = func() {
-						if err := os.Chmod(d, 0700); err != nil {
-							t.Fatalf("couldn't switch %s back to being writable: %v", d, err)
-						}
-					}
-					defer resetwritable()
-				}
+			if err := ioutil.WriteFile(filepath.Join(dir, "report1"), []byte(tc.report), 0644); err != nil {
+				t.Fatal("couldn't create report", err)
 			}
+			cache, tearDownCache := helper.TempDir(t)
+			defer tearDownCache()
 
-			serverHitAt := ""
-			numHitServer := 0
+			hitAt := ""
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				numHitServer++
-				if numHitServer < tc.numHitServer {
-					http.NotFound(w, r)
-					return
-				}
-				serverHitAt = r.URL.String()
+				hitAt = r.URL.String()
 			}))
 			defer ts.Close()
+
+			m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
 			url := tc.manualServerURL
-			if url == "" {
+			if tc.configuredURL {
+				if err := metrics.WithBaseURL(ts.URL)(&m); err != nil {
+					t.Fatal("couldn't configure server url", err)
+				}
+			} else if url == "" {
 				url = ts.URL
 			}
 
-			err = metricsSendPendingReport(m, url, out, os.Stdout, os.Stdin)
-
-			// restore directory state for checking
-			resetwritable()
+			_, err := metricsSendSpool(m, dir, url, cache)
 
 			a.CheckWantedErr(err, tc.wantErr)
-			a.Equal(numHitServer, tc.numHitServer)
-			a.Equal(serverHitAt, tc.sHitHat)
-
-			_, pendingReportErr := os.Stat(tc.pendingReportP)
-			if !tc.pendingReportKept && os.IsExist(pendingReportErr) {
-				t.Errorf("we expected the pending report to be removed and it wasn't")
-			} else if tc.pendingReportKept && os.IsNotExist(pendingReportErr) {
-				t.Errorf("we expected the pending report to be kept and it was removed")
-			}
+			a.Equal(hitAt, tc.wantHitAt)
+		})
+	}
+}
 
-			// check we didn't do too much work on error
-			if err != nil {
-				if _, err := os.Stat(filepath.Join(out, tc.cacheReportP)); os.IsExist(err) {
-					t.Errorf("we didn't expect finding a cache report path as we erroring out")
-				}
-				return
-			}
+func TestMetricsSendSpoolNoDir(t *testing.T) {
+	t.Parallel()
 
-			gotF, err := os.Open(filepath.Join(out, tc.cacheReportP))
-			if err != nil {
-				t.Fatal("didn't generate a report file on disk", err)
-			}
-			got, err := ioutil.ReadAll(gotF)
-			if err != nil {
-				t.Fatal("couldn't read generated report file", err)
-			}
-			a.Equal(got, pendingReportData)
-		})
+	m := metrics.NewTestMetrics("testdata/good", nil, nil, nil, nil, nil, nil, nil, os.Getenv)
+	sent, err := metricsSendSpool(m, "/nonexistent/spool", "http://localhost", "")
+	if err == nil {
+		t.Error("expected an error on a nonexistent directory, got none")
+	}
+	if sent != 0 {
+		t.Errorf("expected no report to be sent, got %d", sent)
 	}
 }
 
@@ -913,3 +3819,27 @@ func dropCR(data []byte) []byte {
 	}
 	return data
 }
+
+// notYetValidCert returns a self-signed certificate only valid from tomorrow
+func notYetValidCert(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("couldn't generate private key", err)
+	}
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"ubuntu-report tests"}},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(24 * time.Hour),
+		NotAfter:     time.Now().Add(48 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("couldn't create certificate", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}